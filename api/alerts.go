@@ -0,0 +1,270 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	AlertFormatJSON  = "json"
+	AlertFormatSlack = "slack"
+
+	// DefaultAlertFlushInterval is how often pending failures are sent when alert_flush_interval is not set
+	DefaultAlertFlushInterval = time.Minute
+	// DefaultAlertDedupWindow is how long a group is not sent again when alert_dedup_window is not set
+	DefaultAlertDedupWindow = time.Hour
+	// alertSlackMaxLines bounds the groups listed in a slack message, the rest are summarized
+	alertSlackMaxLines  = 20
+	alertRequestTimeout = 30 * time.Second
+)
+
+// AlertSink is a webhook failure summaries are posted to, format is json or slack
+type AlertSink struct {
+	URL    string `mapstructure:"url"`
+	Format string `mapstructure:"format"`
+}
+
+// AlertOptions configure when failures are sent
+type AlertOptions struct {
+	// Threshold is the failures a group needs before it is sent
+	Threshold int
+	// FlushInterval is how often pending groups are sent
+	FlushInterval time.Duration
+	// DedupWindow is how long a sent group waits before its new failures are sent
+	DedupWindow time.Duration
+}
+
+// Alert summarizes the failures of a check with the same address and failure category, Message is the first one
+type Alert struct {
+	Check       string `json:"check"`
+	Address     string `json:"address,omitempty"`
+	Category    string `json:"category"`
+	StartHeight int64  `json:"start_height"`
+	EndHeight   int64  `json:"end_height"`
+	Failures    int    `json:"failures"`
+	Message     string `json:"message"`
+}
+
+// AlertPayload is the body posted to json sinks
+type AlertPayload struct {
+	App    string  `json:"app"`
+	Alerts []Alert `json:"alerts"`
+}
+
+type alertKey struct {
+	check    string
+	address  string
+	category string
+}
+
+// Alerter batches failures per check, address and category and posts them to the sinks every flush interval
+type Alerter struct {
+	sinks   []AlertSink
+	options AlertOptions
+	client  *http.Client
+	log     *zap.Logger
+
+	mu      sync.Mutex
+	pending map[alertKey]*Alert
+	// sent is when each group was last sent
+	sent map[alertKey]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	activeAlerterMu sync.Mutex
+	activeAlerter   *Alerter
+)
+
+func NewAlerter(sinks []AlertSink, options AlertOptions) *Alerter {
+	return &Alerter{
+		sinks:   sinks,
+		options: options,
+		client:  &http.Client{Timeout: alertRequestTimeout},
+		log:     zap.L(),
+		pending: map[alertKey]*Alert{},
+		sent:    map[alertKey]time.Time{},
+	}
+}
+
+// StartAlerts sends the failures recorded by RecordFailure to the sinks until StopAlerts is called
+func StartAlerts(sinks []AlertSink, options AlertOptions) {
+	activeAlerterMu.Lock()
+	defer activeAlerterMu.Unlock()
+	if activeAlerter != nil {
+		return
+	}
+	activeAlerter = NewAlerter(sinks, options)
+	activeAlerter.start()
+}
+
+// StopAlerts sends the pending failures and stops the alerts started by StartAlerts
+func StopAlerts(ctx context.Context) {
+	activeAlerterMu.Lock()
+	alerter := activeAlerter
+	activeAlerter = nil
+	activeAlerterMu.Unlock()
+	if alerter != nil {
+		alerter.Stop(ctx)
+	}
+}
+
+// RecordFailure adds a failure of check to its alert group, a no-op when alerts are not started
+func RecordFailure(check, address string, height int64, category, message string) {
+	activeAlerterMu.Lock()
+	alerter := activeAlerter
+	activeAlerterMu.Unlock()
+	if alerter != nil {
+		alerter.Record(check, address, height, category, message)
+	}
+}
+
+func (a *Alerter) Record(check, address string, height int64, category, message string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := alertKey{check: check, address: address, category: category}
+	alert, ok := a.pending[key]
+	if !ok {
+		a.pending[key] = &Alert{
+			Check:       check,
+			Address:     address,
+			Category:    category,
+			StartHeight: height,
+			EndHeight:   height,
+			Failures:    1,
+			Message:     message,
+		}
+		return
+	}
+	alert.StartHeight = min(alert.StartHeight, height)
+	alert.EndHeight = max(alert.EndHeight, height)
+	alert.Failures++
+}
+
+func (a *Alerter) start() {
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go func() {
+		defer close(a.done)
+		ticker := time.NewTicker(a.options.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stop:
+				return
+			case <-ticker.C:
+				a.Flush(context.Background())
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic flushes and sends the pending groups
+func (a *Alerter) Stop(ctx context.Context) {
+	if a.stop != nil {
+		close(a.stop)
+		<-a.done
+	}
+	a.Flush(ctx)
+}
+
+// Flush sends the groups that reached the threshold and were not sent within the dedup window, the others stay
+// pending and keep counting
+func (a *Alerter) Flush(ctx context.Context) {
+	alerts := a.due(time.Now())
+	if len(alerts) == 0 {
+		return
+	}
+	for _, sink := range a.sinks {
+		if err := a.send(ctx, sink, alerts); err != nil {
+			a.log.Error("failed to send alerts", zap.Error(err), zap.String("format", sink.Format), zap.Int("alerts", len(alerts)))
+		}
+	}
+}
+
+// due removes the groups to send from pending, sorted by check, address and height
+func (a *Alerter) due(now time.Time) []Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	alerts := []Alert{}
+	for key, alert := range a.pending {
+		if alert.Failures < a.options.Threshold {
+			continue
+		}
+		if sent, ok := a.sent[key]; ok && now.Sub(sent) < a.options.DedupWindow {
+			continue
+		}
+		alerts = append(alerts, *alert)
+		a.sent[key] = now
+		delete(a.pending, key)
+	}
+	slices.SortFunc(alerts, func(x, y Alert) int {
+		if c := strings.Compare(x.Check, y.Check); c != 0 {
+			return c
+		}
+		if c := strings.Compare(x.Address, y.Address); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.StartHeight, y.StartHeight)
+	})
+	return alerts
+}
+
+func (a *Alerter) send(ctx context.Context, sink AlertSink, alerts []Alert) error {
+	var payload any = AlertPayload{App: MetricsAppName, Alerts: alerts}
+	if sink.Format == AlertFormatSlack {
+		payload = map[string]string{"text": slackAlertText(alerts)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not encode alerts: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not post alerts: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// slackAlertText lists one line per group
+func slackAlertText(alerts []Alert) string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "*%s*: %d validation failure groups\n", MetricsAppName, len(alerts))
+	for i, alert := range alerts {
+		if i == alertSlackMaxLines {
+			fmt.Fprintf(&text, "… and %d more\n", len(alerts)-i)
+			break
+		}
+		heights := fmt.Sprintf("%d", alert.StartHeight)
+		if alert.EndHeight != alert.StartHeight {
+			heights = fmt.Sprintf("%d-%d", alert.StartHeight, alert.EndHeight)
+		}
+		address := ""
+		if alert.Address != "" {
+			address = " `" + alert.Address + "`"
+		}
+		fmt.Fprintf(&text, "• `%s`%s heights %s: %d %s failures, e.g. %s\n", alert.Check, address, heights, alert.Failures, alert.Category, alert.Message)
+	}
+	return text.String()
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type alertSinkServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	payloads []map[string]any
+}
+
+func newAlertSinkServer(t *testing.T) *alertSinkServer {
+	sink := &alertSinkServer{}
+	sink.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		sink.mu.Lock()
+		sink.payloads = append(sink.payloads, payload)
+		sink.mu.Unlock()
+	}))
+	t.Cleanup(sink.Close)
+	return sink
+}
+
+func (s *alertSinkServer) received() []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.payloads
+}
+
+func TestAlerterBatchesFailures(t *testing.T) {
+	sink := newAlertSinkServer(t)
+	alerter := NewAlerter([]AlertSink{{URL: sink.URL, Format: AlertFormatJSON}}, AlertOptions{Threshold: 1, DedupWindow: time.Hour})
+
+	for height := int64(100); height <= 110; height++ {
+		alerter.Record("validate-null-blocks", "", height, "trace", "trace not found")
+	}
+	alerter.Record("validate-address-balance", "f01", 50, "mismatch", "balance mismatch")
+	alerter.Flush(context.Background())
+
+	payloads := sink.received()
+	require.Len(t, payloads, 1)
+	var payload AlertPayload
+	raw, err := json.Marshal(payloads[0])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &payload))
+	assert.Equal(t, MetricsAppName, payload.App)
+	assert.Equal(t, []Alert{
+		{Check: "validate-address-balance", Address: "f01", Category: "mismatch", StartHeight: 50, EndHeight: 50, Failures: 1, Message: "balance mismatch"},
+		{Check: "validate-null-blocks", Category: "trace", StartHeight: 100, EndHeight: 110, Failures: 11, Message: "trace not found"},
+	}, payload.Alerts)
+
+	// nothing pending
+	alerter.Flush(context.Background())
+	assert.Len(t, sink.received(), 1)
+}
+
+func TestAlerterThresholdAndDedup(t *testing.T) {
+	sink := newAlertSinkServer(t)
+	alerter := NewAlerter([]AlertSink{{URL: sink.URL, Format: AlertFormatJSON}}, AlertOptions{Threshold: 2, DedupWindow: time.Hour})
+
+	alerter.Record("validate-json", "", 1, "parse", "invalid json")
+	alerter.Flush(context.Background())
+	assert.Empty(t, sink.received(), "below threshold")
+
+	alerter.Record("validate-json", "", 2, "parse", "invalid json")
+	alerter.Flush(context.Background())
+	require.Len(t, sink.received(), 1)
+
+	// failures of a sent group wait for the dedup window
+	alerter.Record("validate-json", "", 3, "parse", "invalid json")
+	alerter.Record("validate-json", "", 4, "parse", "invalid json")
+	alerter.Flush(context.Background())
+	assert.Len(t, sink.received(), 1)
+
+	alerts := alerter.due(time.Now().Add(2 * time.Hour))
+	assert.Equal(t, []Alert{{Check: "validate-json", Category: "parse", StartHeight: 3, EndHeight: 4, Failures: 2, Message: "invalid json"}}, alerts)
+}
+
+func TestAlerterSlackFormat(t *testing.T) {
+	sink := newAlertSinkServer(t)
+	alerter := NewAlerter([]AlertSink{{URL: sink.URL, Format: AlertFormatSlack}}, AlertOptions{Threshold: 1})
+
+	alerter.Record("validate-address-balance", "f01", 10, "mismatch", "balance mismatch")
+	alerter.Record("validate-address-balance", "f01", 20, "mismatch", "balance mismatch")
+	alerter.Stop(context.Background())
+
+	payloads := sink.received()
+	require.Len(t, payloads, 1)
+	assert.Equal(t, "*fil-trace-check*: 1 validation failure groups\n• `validate-address-balance` `f01` heights 10-20: 2 mismatch failures, e.g. balance mismatch\n", payloads[0]["text"])
+}
+
+func TestRecordFailureWithoutAlerts(t *testing.T) {
+	// no-op until started
+	RecordFailure("validate-json", "", 1, "parse", "invalid json")
+
+	sink := newAlertSinkServer(t)
+	StartAlerts([]AlertSink{{URL: sink.URL, Format: AlertFormatJSON}}, AlertOptions{Threshold: 1, FlushInterval: time.Hour})
+	RecordFailure("validate-json", "", 2, "parse", "invalid json")
+	StopAlerts(context.Background())
+	require.Len(t, sink.received(), 1)
+
+	RecordFailure("validate-json", "", 3, "parse", "invalid json")
+	StopAlerts(context.Background())
+	assert.Len(t, sink.received(), 1)
+}
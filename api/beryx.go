@@ -6,16 +6,37 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"time"
 )
 
-const BeryxURL = "https://api.zondax.ch/fil/data/v4/mainnet"
+const (
+	BeryxBaseURL = "https://api.zondax.ch/fil/data/v4"
+
+	beryxPageLimit = 1000
+	// beryxMaxRetries is how many times a rate limited request is retried
+	beryxMaxRetries = 5
+	// beryxRetryBackoff is the first wait when a rate limited response has no Retry-After, doubled on each retry
+	beryxRetryBackoff = time.Second
+	// beryxStatusOk is the status of successful transactions
+	beryxStatusOk = "Ok"
+)
 
 // Transaction represents a single transaction in the response
 type Transaction struct {
-	Height    int64 `json:"height"`
-	Canonical bool  `json:"canonical"`
+	Height    int64  `json:"height"`
+	Canonical bool   `json:"canonical"`
+	Status    string `json:"status"`
+	// SubcallStatus is the status of an internal transaction, empty for messages
+	SubcallStatus string `json:"subcall_status"`
+}
+
+// succeeded reports whether the transaction and, for internal transactions, its subcall succeeded. The traces are
+// read the same way: failed messages and failed subcalls with their nested subcalls change no state.
+func (t Transaction) succeeded() bool {
+	return t.Status == beryxStatusOk && (t.SubcallStatus == "" || t.SubcallStatus == beryxStatusOk)
 }
 
 // TransactionsResponse represents the API response structure
@@ -27,77 +48,166 @@ type TransactionsResponse struct {
 }
 
 type Beryx struct {
-	token string
+	token        string
+	url          string
+	start        int64
+	end          int64
+	client       *http.Client
+	retryBackoff time.Duration
 }
 
-func NewBeryx(token string) *Beryx {
+// NewBeryx creates a provider for the network API at url. start and end bound the returned heights, 0 leaves
+// that side unbounded.
+func NewBeryx(token, url string, start, end int64) *Beryx {
 	return &Beryx{
 		token: token,
+		url:   url,
+		start: start,
+		end:   end,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		retryBackoff: beryxRetryBackoff,
 	}
 }
 
-// GetAddressEvents fetches transaction events for a given address
+// GetAddressEventHeights fetches every page of transactions of address and returns the sorted canonical heights
+// of its successful transactions
 func (b *Beryx) GetAddressEventHeights(ctx context.Context, address string) ([]int64, error) {
-	// Construct the URL
-	url := fmt.Sprintf("%s/transactions/address/%s", BeryxURL, address)
+	heightSet := map[int64]bool{}
+	received := 0
+	cursor := ""
+	for {
+		result, err := b.getTransactionsPage(ctx, address, cursor)
+		if err != nil {
+			return nil, err
+		}
+		received += len(result.Transactions)
+		for _, transaction := range result.Transactions {
+			if !transaction.Canonical || !transaction.succeeded() || !b.inRange(transaction.Height) {
+				continue
+			}
+			heightSet[transaction.Height] = true
+		}
+		if result.NextCursor == "" || len(result.Transactions) == 0 {
+			if received < result.TotalItems {
+				return nil, fmt.Errorf("beryx returned %d of %d transactions for %s", received, result.TotalItems, address)
+			}
+			break
+		}
+		cursor = result.NextCursor
+	}
+
+	heights := make([]int64, 0, len(heightSet))
+	for height := range heightSet {
+		heights = append(heights, height)
+	}
+	// sort heights in ascending order
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] < heights[j]
+	})
+
+	return heights, nil
+}
+
+func (b *Beryx) inRange(height int64) bool {
+	return (b.start <= 0 || height >= b.start) && (b.end <= 0 || height <= b.end)
+}
 
-	// Create the HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+func (b *Beryx) getTransactionsPage(ctx context.Context, address, cursor string) (*TransactionsResponse, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(beryxPageLimit))
+	if cursor != "" {
+		query.Set("cursor", cursor)
 	}
+	if b.start > 0 {
+		query.Set("min_height", strconv.FormatInt(b.start, 10))
+	}
+	if b.end > 0 {
+		query.Set("max_height", strconv.FormatInt(b.end, 10))
+	}
+	requestURL := fmt.Sprintf("%s/transactions/address/%s?%s", b.url, address, query.Encode())
 
-	// Create the request
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	backoff := b.retryBackoff
+	for retry := 0; ; retry++ {
+		body, retryAfter, err := b.get(ctx, requestURL)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			var result TransactionsResponse
+			if err := json.Unmarshal(body, &result); err != nil {
+				return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+			}
+			return &result, nil
+		}
+
+		// rate limited
+		if retry >= beryxMaxRetries {
+			return nil, fmt.Errorf("API request rate limited after %d retries", retry)
+		}
+		wait := backoff
+		if retryAfter >= 0 {
+			wait = retryAfter
+		}
+		backoff *= 2
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// get returns the response body, or a nil body and the Retry-After wait (-1 if absent) when rate limited
+func (b *Beryx) get(ctx context.Context, requestURL string) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add authentication header
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", b.token))
 	req.Header.Set("Content-Type", "application/json")
 
-	// Execute the request
-	resp, err := client.Do(req)
+	resp, err := b.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
+		return nil, 0, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer func() {
-		if resp != nil {
-			if err := resp.Body.Close(); err != nil {
-				fmt.Printf("beryx failed to close response body: %v\n", err)
-			}
+		if err := resp.Body.Close(); err != nil {
+			fmt.Printf("beryx failed to close response body: %v\n", err)
 		}
 	}()
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), nil
 	}
 
-	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, 0, fmt.Errorf("failed to read response body: %w", err)
 	}
-
-	// Parse the JSON response
-	var result TransactionsResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON response: %w", err)
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
 	}
+	return body, 0, nil
+}
 
-	var heights []int64
-	for _, transaction := range result.Transactions {
-		if !transaction.Canonical {
-			continue
-		}
-		heights = append(heights, transaction.Height)
+// parseRetryAfter parses a Retry-After header in seconds or as an HTTP date, -1 if absent or invalid
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return -1
 	}
-	// sort heights in ascending order
-	sort.Slice(heights, func(i, j int) bool {
-		return heights[i] < heights[j]
-	})
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return -1
+}
 
-	return heights, nil
+func (b *Beryx) Close() error {
+	return nil
 }
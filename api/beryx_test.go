@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBeryxGetAddressEventHeights(t *testing.T) {
+	pages := map[string]TransactionsResponse{
+		"": {
+			Transactions: []Transaction{{Height: 30, Canonical: true, Status: "Ok"}, {Height: 10, Canonical: true, Status: "Ok"}},
+			NextCursor:   "page2",
+			TotalItems:   7,
+		},
+		"page2": {
+			Transactions: []Transaction{
+				{Height: 20, Canonical: false, Status: "Ok"},
+				{Height: 40, Canonical: true, Status: "Ok", SubcallStatus: "Ok"},
+				{Height: 10, Canonical: true, Status: "Ok"},
+				// failed messages and subcalls are skipped, as in the traces
+				{Height: 50, Canonical: true, Status: "Error"},
+				{Height: 60, Canonical: true, Status: "Ok", SubcallStatus: "Error"},
+			},
+			TotalItems: 7,
+		},
+	}
+	rateLimited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/calibration/transactions/address/f01234", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		cursor := r.URL.Query().Get("cursor")
+		// the second page is rate limited once
+		if cursor == "page2" && !rateLimited {
+			rateLimited = true
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(pages[cursor]))
+	}))
+	defer server.Close()
+
+	newBeryx := func(start, end int64) *Beryx {
+		beryx := NewBeryx("token", server.URL+"/calibration", start, end)
+		beryx.retryBackoff = 0
+		return beryx
+	}
+
+	heights, err := newBeryx(0, 0).GetAddressEventHeights(t.Context(), "f01234")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{10, 30, 40}, heights)
+	assert.True(t, rateLimited)
+
+	heights, err = newBeryx(20, 35).GetAddressEventHeights(t.Context(), "f01234")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{30}, heights)
+
+	// a missing page is an error instead of a partial result
+	pages["page2"] = TransactionsResponse{TotalItems: 7}
+	_, err = newBeryx(0, 0).GetAddressEventHeights(t.Context(), "f01234")
+	assert.Error(t, err)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(-1), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(-1), parseRetryAfter("soon"))
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+}
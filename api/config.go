@@ -1,10 +1,26 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Zondax/zindexer/components/connections/data_store"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
+const (
+	// ConfigFileKey and ProfileKey are the viper keys the --config and --profile flags are bound to
+	ConfigFileKey = "config"
+	ProfileKey    = "profile"
+
+	profilesKey = "profiles"
+)
+
 type Config struct {
 
 	// NetworkName is the network name
@@ -12,46 +28,359 @@ type Config struct {
 	// NodeURL is the url of the blockchain node's rpc server
 	NodeURL string `mapstructure:"node_url"`
 	// NetworkSymbol is the token symbol for this network
-	NetworkSymbol string `mapstructure:"network_name"`
+	NetworkSymbol string `mapstructure:"network_symbol"`
 	NodeToken     string `mapstructure:"node_token"`
+	// Nodes are failover nodes used after NodeURL when it fails
+	Nodes []NodeEndpoint `mapstructure:"nodes"`
+	// RPCTimeout bounds each node call
+	RPCTimeout time.Duration `mapstructure:"rpc_timeout"`
+	// RPCMaxRetries is how many times every node is retried after transient errors
+	RPCMaxRetries int `mapstructure:"rpc_max_retries"`
+	// RPCRequestsPerSecond and RPCMaxInFlight limit the calls to all nodes, 0 is unlimited
+	RPCRequestsPerSecond float64 `mapstructure:"rpc_requests_per_second"`
+	RPCMaxInFlight       int     `mapstructure:"rpc_max_in_flight"`
+	// NodeCachePath is the directory of the tipset and actor state cache shared by all commands, empty disables it
+	NodeCachePath string `mapstructure:"node_cache_path"`
+	// NodeCacheOnly answers node calls from the cache only, for when no node is available
+	NodeCacheOnly bool `mapstructure:"node_cache_only"`
 
+	// TraceSource is the data store service traces are read from: s5 or s3 for buckets, local for a directory
+	TraceSource   string `mapstructure:"trace_source"`
 	S3Bucket      string `mapstructure:"s3_bucket"`
 	S3URL         string `mapstructure:"s3_url"`
 	S3AccessKey   string `mapstructure:"s3_access_key"`
 	S3SecretKey   string `mapstructure:"s3_secret_key"`
 	S3SSL         bool   `mapstructure:"s3_ssl"`
 	S3RawDataPath string `mapstructure:"s3_raw_data_path"`
+	// TraceStoreRequestsPerSecond and TraceStoreMaxInFlight limit the requests to the trace source, 0 is unlimited
+	TraceStoreRequestsPerSecond float64 `mapstructure:"trace_store_requests_per_second"`
+	TraceStoreMaxInFlight       int     `mapstructure:"trace_store_max_in_flight"`
+
+	// MetricsPort serves prometheus metrics on MetricsPath when set
+	MetricsPort string `mapstructure:"metrics_port"`
+	MetricsPath string `mapstructure:"metrics_path"`
+	// AlertSinks are webhooks validation failures are posted to, none disables alerts
+	AlertSinks []AlertSink `mapstructure:"alert_sinks"`
+	// AlertThreshold is the failures of a check, address and category needed before they are sent
+	AlertThreshold int `mapstructure:"alert_threshold"`
+	// AlertFlushInterval is how often failures are sent
+	AlertFlushInterval time.Duration `mapstructure:"alert_flush_interval"`
+	// AlertDedupWindow is how long failures of an already sent group wait before they are sent again
+	AlertDedupWindow time.Duration `mapstructure:"alert_dedup_window"`
+
+	// Networks are custom network profiles, e.g. devnets, selected by NetworkName
+	Networks []NetworkProfile `mapstructure:"networks"`
+	loadErr  error
+}
+
+// SetDefaults fills the fields that are not set. The cli calls it on a nil config before unmarshalling into it, the
+// defaults are applied by LoadConfig then.
+func (c *Config) SetDefaults() {
+	if c == nil {
+		return
+	}
+	if c.NetworkName == "" {
+		c.NetworkName = MainnetNetwork
+	}
+	if c.NetworkSymbol == "" {
+		c.NetworkSymbol = "FIL"
+	}
+	if c.TraceSource == "" {
+		c.TraceSource = data_store.S5Storage
+	}
+	if c.MetricsPath == "" {
+		c.MetricsPath = DefaultMetricsPath
+	}
+	for i := range c.AlertSinks {
+		if c.AlertSinks[i].Format == "" {
+			c.AlertSinks[i].Format = AlertFormatJSON
+		}
+	}
+	if c.AlertThreshold == 0 {
+		c.AlertThreshold = 1
+	}
+	if c.AlertFlushInterval == 0 {
+		c.AlertFlushInterval = DefaultAlertFlushInterval
+	}
+	if c.AlertDedupWindow == 0 {
+		c.AlertDedupWindow = DefaultAlertDedupWindow
+	}
+	if c.RPCTimeout == 0 {
+		c.RPCTimeout = DefaultRPCTimeout
+	}
 }
 
-func (c *Config) SetDefaults() {}
+// Requirement is a part of the config only some commands need
+type Requirement int
+
+const (
+	// RequireNode is needed by the commands querying the node
+	RequireNode Requirement = iota
+	// RequireTraceSource is needed by the commands reading traces
+	RequireTraceSource
+)
+
+// Validate checks the values set in the config are well-formed, what each command needs is checked by Require
 func (c *Config) Validate() error {
+	if c.loadErr != nil {
+		return c.loadErr
+	}
+
+	errs := []error{}
+	if c.NodeURL != "" {
+		if err := validateURL("node_url", c.NodeURL, "http", "https", "ws", "wss"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i, node := range c.Nodes {
+		if err := validateURL(fmt.Sprintf("nodes[%d].url", i), node.URL, "http", "https", "ws", "wss"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.RPCTimeout < 0 || c.RPCMaxRetries < 0 {
+		errs = append(errs, errors.New("rpc_timeout and rpc_max_retries cannot be negative"))
+	}
+	if c.NodeCacheOnly && c.NodeCachePath == "" {
+		errs = append(errs, errors.New("node_cache_only requires node_cache_path"))
+	}
+	if c.RPCRequestsPerSecond < 0 || c.RPCMaxInFlight < 0 || c.TraceStoreRequestsPerSecond < 0 || c.TraceStoreMaxInFlight < 0 {
+		errs = append(errs, errors.New("rate limits cannot be negative"))
+	}
+	for i, sink := range c.AlertSinks {
+		if err := validateURL(fmt.Sprintf("alert_sinks[%d].url", i), sink.URL, "http", "https"); err != nil {
+			errs = append(errs, err)
+		}
+		if sink.Format != "" && sink.Format != AlertFormatJSON && sink.Format != AlertFormatSlack {
+			errs = append(errs, fmt.Errorf("invalid alert_sinks[%d].format %s, expected %s or %s", i, sink.Format, AlertFormatJSON, AlertFormatSlack))
+		}
+	}
+	if c.AlertThreshold < 0 || c.AlertFlushInterval < 0 || c.AlertDedupWindow < 0 {
+		errs = append(errs, errors.New("alert_threshold, alert_flush_interval and alert_dedup_window cannot be negative"))
+	}
+	switch c.TraceSource {
+	case "", data_store.S5Storage, data_store.S3Storage, data_store.LocalStorage:
+	default:
+		errs = append(errs, fmt.Errorf("invalid trace_source %s, expected one of %s, %s, %s", c.TraceSource, data_store.S5Storage, data_store.S3Storage, data_store.LocalStorage))
+	}
+	if c.NetworkName != "" {
+		if _, err := c.Network(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Require validates the config and checks it has the node and trace source settings a command needs
+func (c *Config) Require(requirements ...Requirement) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	errs := []error{}
+	for _, requirement := range requirements {
+		switch requirement {
+		case RequireNode:
+			// no node is used when running from the node cache only
+			if c.NodeURL == "" && !c.NodeCacheOnly {
+				errs = append(errs, errors.New("node_url is required"))
+			}
+		case RequireTraceSource:
+			errs = append(errs, c.validateTraceSource()...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateTraceSource checks the fields the selected trace source reads traces with are set
+func (c *Config) validateTraceSource() []error {
+	errs := []error{}
+	switch c.TraceSource {
+	case data_store.S5Storage, data_store.S3Storage:
+		// the data store takes the endpoint without scheme, s3_ssl selects https
+		if c.S3URL == "" {
+			errs = append(errs, errors.New("s3_url is required"))
+		} else if err := validateURL("s3_url", "https://"+strings.TrimPrefix(strings.TrimPrefix(c.S3URL, "https://"), "http://")); err != nil {
+			errs = append(errs, err)
+		}
+		if c.S3Bucket == "" {
+			errs = append(errs, errors.New("s3_bucket is required"))
+		}
+		if c.S3AccessKey == "" || c.S3SecretKey == "" {
+			errs = append(errs, fmt.Errorf("s3_access_key and s3_secret_key are required for trace source %s", c.TraceSource))
+		}
+	case data_store.LocalStorage:
+		// traces are read from <s3_raw_data_path>/<s3_bucket>/<s3_raw_data_path>
+		if c.S3Bucket == "" {
+			errs = append(errs, errors.New("s3_bucket is required"))
+		}
+	default:
+		errs = append(errs, errors.New("trace_source is required"))
+	}
+	return errs
+}
+
+func validateURL(key, value string, schemes ...string) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", key)
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("invalid %s %s: missing host", key, value)
+	}
+	for _, scheme := range schemes {
+		if parsed.Scheme == scheme {
+			return nil
+		}
+	}
+	if len(schemes) > 0 {
+		return fmt.Errorf("invalid %s %s: scheme must be one of %s", key, value, strings.Join(schemes, ", "))
+	}
 	return nil
 }
 
+// GetGlobalConfigs loads the config file and profile selected by the --config and --profile flags. Loading errors
+// are returned by Validate and Network.
 func GetGlobalConfigs() Config {
+	config, err := LoadConfig(viper.GetString(ConfigFileKey), viper.GetString(ProfileKey))
+	if err != nil {
+		config.loadErr = err
+	}
+	return config
+}
+
+// LoadConfig reads configPath, or config.yaml in the working directory if empty, and applies the profile section
+// over the top level values. Environment variables take precedence over both.
+func LoadConfig(configPath, profile string) (Config, error) {
 	viper := viper.New()
-	viper.SetConfigName("config") // config file name without extension
-	viper.AddConfigPath(".")      // search path
-	viper.AutomaticEnv()          // read value ENV variables
+	if configPath != "" {
+		viper.SetConfigFile(configPath)
+	} else {
+		viper.SetConfigName("config") // config file name without extension
+		viper.AddConfigPath(".")      // search path
+	}
+	viper.AutomaticEnv() // read value ENV variables
 
+	config := Config{}
 	err := viper.ReadInConfig()
 	if err != nil {
+		if configPath != "" {
+			return config, fmt.Errorf("could not read config file %s: %w", configPath, err)
+		}
 		zap.L().Debug("Config not found. Using env variables")
 	}
 
-	return Config{
+	if profile != "" {
+		section := viper.Sub(profilesKey + "." + profile)
+		if section == nil {
+			return config, fmt.Errorf("profile %s not found in %s section", profile, profilesKey)
+		}
+		for key, value := range section.AllSettings() {
+			if _, ok := os.LookupEnv(strings.ToUpper(key)); ok {
+				continue
+			}
+			viper.Set(key, value)
+		}
+	}
+
+	var nodes []NodeEndpoint
+	if err := viper.UnmarshalKey("nodes", &nodes); err != nil {
+		return config, fmt.Errorf("invalid nodes: %w", err)
+	}
+	var alertSinks []AlertSink
+	if err := viper.UnmarshalKey("alert_sinks", &alertSinks); err != nil {
+		return config, fmt.Errorf("invalid alert sinks: %w", err)
+	}
+	var networks []NetworkProfile
+	if err := viper.UnmarshalKey("networks", &networks); err != nil {
+		return config, fmt.Errorf("invalid network profiles: %w", err)
+	}
+
+	config = Config{
 		// Network
 		NodeURL:       viper.GetString("node_url"),
 		NetworkName:   viper.GetString("network_name"),
 		NetworkSymbol: viper.GetString("network_symbol"),
 		NodeToken:     viper.GetString("node_token"),
+		Nodes:         nodes,
+		RPCTimeout:    viper.GetDuration("rpc_timeout"),
+		RPCMaxRetries: viper.GetInt("rpc_max_retries"),
+
+		NodeCachePath: viper.GetString("node_cache_path"),
+		NodeCacheOnly: viper.GetBool("node_cache_only"),
+
+		RPCRequestsPerSecond:        viper.GetFloat64("rpc_requests_per_second"),
+		RPCMaxInFlight:              viper.GetInt("rpc_max_in_flight"),
+		TraceStoreRequestsPerSecond: viper.GetFloat64("trace_store_requests_per_second"),
+		TraceStoreMaxInFlight:       viper.GetInt("trace_store_max_in_flight"),
 
 		// Raw data download S3
+		TraceSource:   viper.GetString("trace_source"),
 		S3URL:         viper.GetString("s3_url"),
 		S3SSL:         viper.GetBool("s3_ssl"),
 		S3AccessKey:   viper.GetString("s3_access_key"),
 		S3SecretKey:   viper.GetString("s3_secret_key"),
 		S3Bucket:      viper.GetString("s3_bucket"),
 		S3RawDataPath: viper.GetString("s3_raw_data_path"),
+
+		MetricsPort: viper.GetString("metrics_port"),
+		MetricsPath: viper.GetString("metrics_path"),
+
+		AlertSinks:         alertSinks,
+		AlertThreshold:     viper.GetInt("alert_threshold"),
+		AlertFlushInterval: viper.GetDuration("alert_flush_interval"),
+		AlertDedupWindow:   viper.GetDuration("alert_dedup_window"),
+
+		Networks: networks,
+	}
+	// 0 disables the retries, the default only applies when rpc_max_retries is not set
+	if !viper.IsSet("rpc_max_retries") {
+		config.RPCMaxRetries = DefaultRPCMaxRetries
+	}
+	config.SetDefaults()
+	return config, nil
+}
+
+// NodeEndpoints returns node_url followed by the failover nodes
+func (c *Config) NodeEndpoints() []NodeEndpoint {
+	return append([]NodeEndpoint{{URL: c.NodeURL, Token: c.NodeToken}}, c.Nodes...)
+}
+
+// RPCRateLimiter returns the limiter shared by every rpc client of the process
+func (c *Config) RPCRateLimiter() *RateLimiter {
+	return sharedRateLimiter(RPCLimiter, c.RPCRequestsPerSecond, c.RPCMaxInFlight)
+}
+
+// TraceStoreRateLimiter returns the limiter shared by every trace store request of the process
+func (c *Config) TraceStoreRateLimiter() *RateLimiter {
+	return sharedRateLimiter(TraceStoreLimiter, c.TraceStoreRequestsPerSecond, c.TraceStoreMaxInFlight)
+}
+
+// AlertOptions returns when the failures are sent to AlertSinks
+func (c *Config) AlertOptions() AlertOptions {
+	return AlertOptions{
+		Threshold:     c.AlertThreshold,
+		FlushInterval: c.AlertFlushInterval,
+		DedupWindow:   c.AlertDedupWindow,
+	}
+}
+
+// Network returns the profile of NetworkName, custom profiles take precedence over the built-in ones
+func (c *Config) Network() (*NetworkProfile, error) {
+	if c.loadErr != nil {
+		return nil, c.loadErr
+	}
+	for i := range c.Networks {
+		profile := &c.Networks[i]
+		if !strings.EqualFold(profile.Name, c.NetworkName) {
+			continue
+		}
+		if err := profile.Validate(); err != nil {
+			return nil, err
+		}
+		return profile, nil
 	}
+	return GetNetworkProfile(c.NetworkName)
 }
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zondax/zindexer/components/connections/data_store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigFile = `
+network_name: "mainnet"
+network_symbol: "tFIL"
+node_url: "https://node.example.com/rpc/v1"
+s3_url: "s3.example.com"
+s3_access_key: "access"
+s3_secret_key: "secret"
+s3_bucket: "traces"
+profiles:
+  calibration-staging:
+    network_name: "calibration"
+    node_url: "wss://calibration.example.com/rpc/v1"
+    s3_bucket: "traces-calibration"
+`
+
+func writeTestConfig(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testConfigFile), 0o600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeTestConfig(t)
+
+	config, err := LoadConfig(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, MainnetNetwork, config.NetworkName)
+	assert.Equal(t, "tFIL", config.NetworkSymbol)
+	assert.Equal(t, "https://node.example.com/rpc/v1", config.NodeURL)
+	assert.Equal(t, "traces", config.S3Bucket)
+	assert.Equal(t, data_store.S5Storage, config.TraceSource)
+	require.NoError(t, config.Validate())
+
+	config, err = LoadConfig(path, "calibration-staging")
+	require.NoError(t, err)
+	assert.Equal(t, CalibrationNetwork, config.NetworkName)
+	assert.Equal(t, "wss://calibration.example.com/rpc/v1", config.NodeURL)
+	assert.Equal(t, "traces-calibration", config.S3Bucket)
+	// not overridden by the profile
+	assert.Equal(t, "access", config.S3AccessKey)
+	require.NoError(t, config.Validate())
+
+	// env variables take precedence over the profile
+	t.Setenv("S3_BUCKET", "traces-env")
+	config, err = LoadConfig(path, "calibration-staging")
+	require.NoError(t, err)
+	assert.Equal(t, "traces-env", config.S3Bucket)
+
+	assert.Equal(t, DefaultRPCMaxRetries, config.RPCMaxRetries)
+
+	// retries are disabled with 0
+	noRetriesPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(noRetriesPath, []byte(testConfigFile+"rpc_max_retries: 0\n"), 0o600))
+	config, err = LoadConfig(noRetriesPath, "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, config.RPCMaxRetries)
+
+	_, err = LoadConfig(path, "unknown")
+	assert.Error(t, err)
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"), "")
+	assert.Error(t, err)
+}
+
+func TestConfigRequire(t *testing.T) {
+	valid := Config{
+		NetworkName: MainnetNetwork,
+		NodeURL:     "https://node.example.com/rpc/v1",
+		TraceSource: data_store.S3Storage,
+		S3URL:       "s3.example.com",
+		S3AccessKey: "access",
+		S3SecretKey: "secret",
+		S3Bucket:    "traces",
+	}
+
+	tests := []struct {
+		name    string
+		update  func(config *Config)
+		wantErr bool
+	}{
+		{name: "valid", update: func(config *Config) {}},
+		{name: "missing node url", update: func(config *Config) { config.NodeURL = "" }, wantErr: true},
+		{name: "node cache only without node url", update: func(config *Config) {
+			config.NodeURL = ""
+			config.NodeCachePath, config.NodeCacheOnly = t.TempDir(), true
+		}},
+		{name: "node url without scheme", update: func(config *Config) { config.NodeURL = "node.example.com" }, wantErr: true},
+		{name: "node url with invalid scheme", update: func(config *Config) { config.NodeURL = "ftp://node.example.com" }, wantErr: true},
+		{name: "websocket node url", update: func(config *Config) { config.NodeURL = "ws://127.0.0.1:1234/rpc/v1" }},
+		{name: "missing credentials", update: func(config *Config) { config.S3SecretKey = "" }, wantErr: true},
+		{name: "missing s3 url", update: func(config *Config) { config.S3URL = "" }, wantErr: true},
+		{name: "missing bucket", update: func(config *Config) { config.S3Bucket = "" }, wantErr: true},
+		{name: "local without credentials", update: func(config *Config) {
+			config.TraceSource = data_store.LocalStorage
+			config.S3URL, config.S3AccessKey, config.S3SecretKey = "", "", ""
+		}},
+		{name: "unknown trace source", update: func(config *Config) { config.TraceSource = "ftp" }, wantErr: true},
+		{name: "unknown network", update: func(config *Config) { config.NetworkName = "unknown" }, wantErr: true},
+		{name: "slack alert sink", update: func(config *Config) {
+			config.AlertSinks = []AlertSink{{URL: "https://hooks.slack.com/services/x", Format: AlertFormatSlack}}
+		}},
+		{name: "alert sink with invalid format", update: func(config *Config) {
+			config.AlertSinks = []AlertSink{{URL: "https://hooks.example.com", Format: "xml"}}
+		}, wantErr: true},
+		{name: "alert sink without url", update: func(config *Config) {
+			config.AlertSinks = []AlertSink{{Format: AlertFormatJSON}}
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.update(&config)
+			err := config.Require(RequireNode, RequireTraceSource)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	// the cli sets the defaults of a nil config before unmarshalling into it
+	var nilConfig *Config
+	nilConfig.SetDefaults()
+
+	// only the settings a command uses are required
+	config := Config{TraceSource: data_store.LocalStorage, S3Bucket: "traces"}
+	require.NoError(t, config.Validate())
+	require.NoError(t, config.Require(RequireTraceSource))
+	assert.ErrorContains(t, config.Require(RequireNode), "node_url is required")
+	assert.ErrorContains(t, (&Config{}).Require(RequireTraceSource), "trace_source is required")
+
+	// what is set is still validated
+	config.NodeURL = "node.example.com"
+	assert.Error(t, config.Validate())
+	config = Config{NetworkName: "unknown"}
+	assert.Error(t, config.Validate())
+}
@@ -4,11 +4,11 @@ import (
 	"github.com/zondax/fil-parser/actors/cache/impl/common"
 )
 
-func GetDataSource(config *Config, node RPCClientInterface) common.DataSource {
+func GetDataSource(network *NetworkProfile, node RPCClientInterface) common.DataSource {
 	cacheDataSource := common.DataSource{
 		Node: node.FullNodeClient(),
 		Config: common.DataSourceConfig{
-			NetworkName: config.NetworkName,
+			NetworkName: network.ActorsNetwork,
 		},
 	}
 	return cacheDataSource
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
@@ -20,7 +21,12 @@ type DB struct {
 }
 
 func NewDB(path, bucket string) (*DB, error) {
-	db, err := bolt.Open(filepath.Join(path, bucket+".db"), 0600, nil)
+	return NewDBWithTimeout(path, bucket, 0)
+}
+
+// NewDBWithTimeout fails if the database is still locked by another process after timeout, 0 waits indefinitely
+func NewDBWithTimeout(path, bucket string, timeout time.Duration) (*DB, error) {
+	db, err := bolt.Open(filepath.Join(path, bucket+".db"), 0600, &bolt.Options{Timeout: timeout})
 	if err != nil {
 		return nil, err
 	}
@@ -36,6 +42,11 @@ func NewDB(path, bucket string) (*DB, error) {
 	}, nil
 }
 
+// Bucket returns the bucket name, the check name for progress databases
+func (d *DB) Bucket() string {
+	return d.bucket
+}
+
 func (d *DB) Insert(key string, data any) error {
 	dataBytes, err := json.Marshal(data)
 	if err != nil {
@@ -145,6 +156,40 @@ func (d *DB) GetAllKVAsJSON() ([]byte, error) {
 	return json.Marshal(data)
 }
 
+// ForEachAfter calls fn with the keys starting with prefix and their values in key order, starting after the key
+// after, from the first one if empty
+func (d *DB) ForEachAfter(prefix, after string, fn func(key string, value []byte) error) error {
+	return d.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(d.bucket)).Cursor()
+		k, v := cursor.Seek([]byte(prefix))
+		if after != "" {
+			k, v = cursor.Seek([]byte(after))
+			if k != nil && string(k) == after {
+				k, v = cursor.Next()
+			}
+		}
+		for ; k != nil && strings.HasPrefix(string(k), prefix); k, v = cursor.Next() {
+			if err := fn(string(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeletePrefix deletes the keys starting with prefix
+func (d *DB) DeletePrefix(prefix string) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(d.bucket)).Cursor()
+		for k, _ := cursor.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = cursor.Seek([]byte(prefix)) {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (d *DB) Close() error {
 	return d.db.Close()
 }
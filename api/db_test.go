@@ -231,3 +231,30 @@ func TestDB_GetAllKVAsJSON(t *testing.T) {
 		assert.NotNil(t, value)
 	}
 }
+
+func TestDB_ForEachAfter(t *testing.T) {
+	db, err := NewDB(t.TempDir(), "test-bucket")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+	for _, key := range []string{"a/1", "a/2", "a/3", "b/1"} {
+		require.NoError(t, db.Insert(key, key))
+	}
+
+	keys := func(prefix, after string) []string {
+		keys := []string{}
+		require.NoError(t, db.ForEachAfter(prefix, after, func(key string, _ []byte) error {
+			keys = append(keys, key)
+			return nil
+		}))
+		return keys
+	}
+	assert.Equal(t, []string{"a/1", "a/2", "a/3"}, keys("a/", ""))
+	assert.Equal(t, []string{"a/3"}, keys("a/", "a/2"))
+	assert.Empty(t, keys("a/", "a/3"))
+	assert.Equal(t, []string{"a/1", "a/2", "a/3", "b/1"}, keys("", ""))
+
+	require.NoError(t, db.DeletePrefix("a/"))
+	assert.Equal(t, []string{"b/1"}, keys("", ""))
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	jsonrpc "github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/lotus/api"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultRPCTimeout bounds each node call, subscriptions are not bounded
+	DefaultRPCTimeout = time.Minute
+	// DefaultRPCMaxRetries is how many times every endpoint is retried after transient errors
+	DefaultRPCMaxRetries = 3
+	// rpcRetryBackoff is the wait before the first retry, doubled on each retry
+	rpcRetryBackoff = time.Second
+)
+
+// NodeEndpoint is the url and optional token of a node rpc server
+type NodeEndpoint struct {
+	URL   string `mapstructure:"url"`
+	Token string `mapstructure:"token"`
+}
+
+// RPCOptions configure the timeouts and retries of the calls to the nodes
+type RPCOptions struct {
+	Timeout    time.Duration
+	MaxRetries int
+	Backoff    time.Duration
+	// Limiter is shared by all endpoints, nil does not limit
+	Limiter *RateLimiter
+	// Cache answers the calls it holds without the nodes, nil disables it
+	Cache *NodeCache
+	// CacheOnly does not connect to the nodes, calls the cache cannot answer fail
+	CacheOnly bool
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+type rpcEndpoint struct {
+	url    string
+	client api.FullNode
+	calls  atomic.Int64
+	errors atomic.Int64
+}
+
+// failoverNode sends every call to the current endpoint and moves to the next one on transient errors
+type failoverNode struct {
+	endpoints []*rpcEndpoint
+	current   atomic.Int64
+	options   RPCOptions
+	log       *zap.Logger
+}
+
+// newFailoverFullNode returns a FullNode whose methods go through node
+func newFailoverFullNode(node *failoverNode) api.FullNode {
+	var out api.FullNodeStruct
+	for _, internal := range api.GetInternalStructs(&out) {
+		methods := reflect.ValueOf(internal).Elem()
+		for i := 0; i < methods.NumField(); i++ {
+			field := methods.Type().Field(i)
+			if field.Type.NumOut() == 0 || field.Type.Out(field.Type.NumOut()-1) != errorType {
+				continue
+			}
+			methods.Field(i).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) []reflect.Value {
+				return node.call(field.Name, field.Type, args)
+			}))
+		}
+	}
+	return &out
+}
+
+func (n *failoverNode) call(method string, methodType reflect.Type, args []reflect.Value) []reflect.Value {
+	if len(n.endpoints) == 0 {
+		return errorResults(methodType, fmt.Errorf("%w: %s", ErrNotInNodeCache, method))
+	}
+	ctx := args[0].Interface().(context.Context)
+	// subscriptions outlive the call, only their setup is retried
+	subscription := methodType.NumOut() > 1 && methodType.Out(0).Kind() == reflect.Chan
+
+	backoff := n.options.Backoff
+	var err error
+	for retry := 0; ; retry++ {
+		// every endpoint is tried once per retry, starting from the last one that worked
+		for range n.endpoints {
+			index := int(n.current.Load())
+			endpoint := n.endpoints[index]
+
+			var results []reflect.Value
+			results, err = n.callEndpoint(ctx, endpoint, method, args, subscription)
+			if err == nil {
+				return results
+			}
+			if !isTransientRPCError(ctx, err) {
+				if results == nil {
+					return errorResults(methodType, err)
+				}
+				return results
+			}
+
+			n.log.Warn("node call failed",
+				zap.Error(err),
+				zap.String("method", method),
+				zap.String("endpoint", endpoint.url),
+				zap.Int64("endpoint-errors", endpoint.errors.Add(1)),
+				zap.Int64("endpoint-calls", endpoint.calls.Load()),
+				zap.Int("retry", retry),
+			)
+			n.current.CompareAndSwap(int64(index), int64((index+1)%len(n.endpoints)))
+		}
+
+		if retry >= n.options.MaxRetries {
+			return errorResults(methodType, err)
+		}
+		select {
+		case <-ctx.Done():
+			return errorResults(methodType, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *failoverNode) callEndpoint(ctx context.Context, endpoint *rpcEndpoint, method string, args []reflect.Value, subscription bool) ([]reflect.Value, error) {
+	release, err := n.options.Limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// subscriptions only hold a slot while they are set up
+	defer release()
+
+	endpoint.calls.Add(1)
+	callArgs := append([]reflect.Value{}, args...)
+	if !subscription && n.options.Timeout > 0 {
+		callCtx, cancel := context.WithTimeout(ctx, n.options.Timeout)
+		defer cancel()
+		callArgs[0] = reflect.ValueOf(callCtx)
+	}
+
+	start := time.Now()
+	results := reflect.ValueOf(endpoint.client).MethodByName(method).Call(callArgs)
+	last := results[len(results)-1]
+	if last.IsNil() {
+		observeRPCCall(endpoint.url, method, time.Since(start), false)
+		return results, nil
+	}
+	err = last.Interface().(error)
+	observeRPCCall(endpoint.url, method, time.Since(start), isTransientRPCError(ctx, err))
+	return results, err
+}
+
+// isTransientRPCError is true for connection, http and timeout errors, errors returned by the node are final
+func isTransientRPCError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var clientErr *jsonrpc.ErrClient
+	var connectionErr *jsonrpc.RPCConnectionError
+	return errors.As(err, &clientErr) || errors.As(err, &connectionErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func errorResults(methodType reflect.Type, err error) []reflect.Value {
+	results := make([]reflect.Value, methodType.NumOut())
+	for i := 0; i < len(results)-1; i++ {
+		results[i] = reflect.Zero(methodType.Out(i))
+	}
+	results[len(results)-1] = reflect.ValueOf(&err).Elem()
+	return results
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	jsonrpc "github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-state-types/abi"
+	lotusChainTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+	"go.uber.org/zap"
+)
+
+func newTestFailoverNode(options RPCOptions, clients ...*mocks.FullNode) *failoverNode {
+	node := &failoverNode{options: options, log: zap.NewNop()}
+	for i, client := range clients {
+		node.endpoints = append(node.endpoints, &rpcEndpoint{url: fmt.Sprintf("http://node-%d", i), client: client})
+	}
+	return node
+}
+
+func TestFailoverNode(t *testing.T) {
+	transientErr := &jsonrpc.RPCConnectionError{}
+	options := RPCOptions{Timeout: time.Second, MaxRetries: 1, Backoff: time.Millisecond}
+
+	t.Run("fails over on transient errors", func(t *testing.T) {
+		first, second := mocks.NewFullNode(t), mocks.NewFullNode(t)
+		first.On("ChainHead", mock.Anything).Return(nil, transientErr).Once()
+		second.On("ChainHead", mock.Anything).Return(testTipSet(t, 100), nil).Twice()
+		node := newTestFailoverNode(options, first, second)
+		fullNode := newFailoverFullNode(node)
+
+		head, err := fullNode.ChainHead(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, abi.ChainEpoch(100), head.Height())
+		assert.Equal(t, int64(1), node.endpoints[0].errors.Load())
+
+		// the working endpoint is kept
+		_, err = fullNode.ChainHead(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), node.endpoints[0].calls.Load())
+		assert.Equal(t, int64(2), node.endpoints[1].calls.Load())
+	})
+
+	t.Run("node errors are not retried", func(t *testing.T) {
+		first, second := mocks.NewFullNode(t), mocks.NewFullNode(t)
+		first.On("ChainHead", mock.Anything).Return(nil, errors.New("actor not found")).Once()
+		fullNode := newFailoverFullNode(newTestFailoverNode(options, first, second))
+
+		_, err := fullNode.ChainHead(t.Context())
+		assert.EqualError(t, err, "actor not found")
+	})
+
+	t.Run("retries every endpoint", func(t *testing.T) {
+		first, second := mocks.NewFullNode(t), mocks.NewFullNode(t)
+		first.On("ChainHead", mock.Anything).Return(nil, transientErr).Times(2)
+		second.On("ChainHead", mock.Anything).Return(nil, transientErr).Times(2)
+		node := newTestFailoverNode(options, first, second)
+		fullNode := newFailoverFullNode(node)
+
+		_, err := fullNode.ChainHead(t.Context())
+		assert.ErrorAs(t, err, &transientErr)
+		assert.Equal(t, int64(2), node.endpoints[0].errors.Load())
+		assert.Equal(t, int64(2), node.endpoints[1].errors.Load())
+	})
+
+	t.Run("calls are bounded by the timeout", func(t *testing.T) {
+		first := mocks.NewFullNode(t)
+		first.On("ChainHead", mock.Anything).Return(func(ctx context.Context) (*lotusChainTypes.TipSet, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}).Times(2)
+		node := newTestFailoverNode(RPCOptions{Timeout: time.Millisecond, MaxRetries: 1, Backoff: time.Millisecond}, first)
+		fullNode := newFailoverFullNode(node)
+
+		_, err := fullNode.ChainHead(t.Context())
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	lotusChainTypes "github.com/filecoin-project/lotus/chain/types"
+)
+
+// Lotus derives address activity heights from the messages included in the tipsets of a bounded range and,
+// optionally, from the emitters of the actor events of those messages
+type Lotus struct {
+	rpcClient   RPCClientInterface
+	start       int64
+	end         int64
+	actorEvents bool
+	resolver    AddressResolver
+
+	once    sync.Once
+	heights map[string][]int64
+	err     error
+}
+
+func NewLotus(rpcClient RPCClientInterface, start, end int64, actorEvents bool, resolver AddressResolver) (*Lotus, error) {
+	if rpcClient == nil {
+		return nil, fmt.Errorf("lotus event provider requires an rpc client")
+	}
+	if start <= 0 || end < start {
+		return nil, fmt.Errorf("invalid lotus event provider range [%d, %d]", start, end)
+	}
+	return &Lotus{
+		rpcClient:   rpcClient,
+		start:       start,
+		end:         end,
+		actorEvents: actorEvents,
+		resolver:    resolver,
+	}, nil
+}
+
+// GetAddressEventHeights returns the sorted heights any equivalent address of address is active at, the range
+// is walked once on the first call
+func (l *Lotus) GetAddressEventHeights(ctx context.Context, address string) ([]int64, error) {
+	l.once.Do(func() {
+		l.heights, l.err = l.walk(ctx)
+	})
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	equivalentAddresses := map[string]bool{address: true}
+	if l.resolver != nil {
+		resolved, err := l.resolver(ctx, address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve equivalent addresses: %w", err)
+		}
+		equivalentAddresses = resolved
+	}
+
+	heights := []int64{}
+	for equivalentAddress := range equivalentAddresses {
+		heights = append(heights, l.heights[equivalentAddress]...)
+	}
+	slices.Sort(heights)
+	return slices.Compact(heights), nil
+}
+
+func (l *Lotus) walk(ctx context.Context) (map[string][]int64, error) {
+	heights := map[string][]int64{}
+	add := func(address string, height int64) {
+		// heights are walked in ascending order
+		if addressHeights := heights[address]; len(addressHeights) == 0 || addressHeights[len(addressHeights)-1] != height {
+			heights[address] = append(addressHeights, height)
+		}
+	}
+
+	var previous *lotusChainTypes.TipSet
+	for height := l.start; height <= l.end; height++ {
+		tipset, err := ChainGetTipSetByHeight(ctx, height, l.rpcClient)
+		if err != nil {
+			return nil, err
+		}
+		// null rounds return the previous tipset
+		if tipset.Height() != abi.ChainEpoch(height) {
+			continue
+		}
+		messages, err := l.rpcClient.FullNodeClient().ChainGetMessagesInTipset(ctx, tipset.Key())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get messages in tipset %d: %w", height, err)
+		}
+		for _, message := range messages {
+			add(message.Message.From.String(), height)
+			add(message.Message.To.String(), height)
+		}
+		if l.actorEvents && previous != nil {
+			if err := l.addEventEmitters(ctx, previous, tipset, add); err != nil {
+				return nil, err
+			}
+		}
+		previous = tipset
+	}
+
+	// events of the last tipset are in the receipts of the next one
+	if l.actorEvents && previous != nil {
+		next, err := ChainGetNextTipSet(ctx, previous, l.rpcClient)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.addEventEmitters(ctx, previous, next, add); err != nil {
+			return nil, err
+		}
+	}
+	return heights, nil
+}
+
+// addEventEmitters adds the emitters of the events of the messages of tipset, whose receipts are in its child
+func (l *Lotus) addEventEmitters(ctx context.Context, tipset, child *lotusChainTypes.TipSet, add func(string, int64)) error {
+	receipts, err := l.rpcClient.FullNodeClient().ChainGetParentReceipts(ctx, child.Cids()[0])
+	if err != nil {
+		return fmt.Errorf("failed to get receipts of tipset %d: %w", tipset.Height(), err)
+	}
+	for _, receipt := range receipts {
+		if receipt.EventsRoot == nil {
+			continue
+		}
+		events, err := l.rpcClient.FullNodeClient().ChainGetEvents(ctx, *receipt.EventsRoot)
+		if err != nil {
+			return fmt.Errorf("failed to get events of tipset %d: %w", tipset.Height(), err)
+		}
+		for _, event := range events {
+			emitter, err := address.NewIDAddress(uint64(event.Emitter))
+			if err != nil {
+				return err
+			}
+			add(emitter.String(), int64(tipset.Height()))
+		}
+	}
+	return nil
+}
+
+func (l *Lotus) Close() error {
+	return nil
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	lotusAPI "github.com/filecoin-project/lotus/api"
+	lotusChainTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+	rosettaFilecoinLib "github.com/zondax/rosetta-filecoin-lib"
+)
+
+type testRPCClient struct {
+	client lotusAPI.FullNode
+}
+
+func (c *testRPCClient) FullNodeClient() lotusAPI.FullNode {
+	return c.client
+}
+
+func (c *testRPCClient) RosettaLib() *rosettaFilecoinLib.RosettaConstructionFilecoin {
+	return nil
+}
+
+func (c *testRPCClient) NodeInfo() types.NodeInfo {
+	return types.NodeInfo{}
+}
+
+func testTipSet(t *testing.T, height int64) *lotusChainTypes.TipSet {
+	return testTipSetWithParents(t, height, nil)
+}
+
+// testChildTipSet returns a tipset at height whose parent is parent
+func testChildTipSet(t *testing.T, parent *lotusChainTypes.TipSet, height int64) *lotusChainTypes.TipSet {
+	return testTipSetWithParents(t, height, parent.Cids())
+}
+
+func testTipSetWithParents(t *testing.T, height int64, parents []cid.Cid) *lotusChainTypes.TipSet {
+	blockCid, err := cid.Decode("bafyreicmaj5hhoy5mgqvamfhgexxyergw7hdeshizghodwkjg6qmpoco7i")
+	require.NoError(t, err)
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	tipset, err := lotusChainTypes.NewTipSet([]*lotusChainTypes.BlockHeader{
+		{
+			Miner:                 miner,
+			Height:                abi.ChainEpoch(height),
+			Parents:               parents,
+			ParentStateRoot:       blockCid,
+			ParentMessageReceipts: blockCid,
+			Messages:              blockCid,
+			ParentWeight:          lotusChainTypes.NewInt(0),
+			ParentBaseFee:         lotusChainTypes.NewInt(0),
+		},
+	})
+	require.NoError(t, err)
+	return tipset
+}
+
+func testMessage(t *testing.T, from, to string) lotusAPI.Message {
+	fromAddress, err := address.NewFromString(from)
+	require.NoError(t, err)
+	toAddress, err := address.NewFromString(to)
+	require.NoError(t, err)
+	return lotusAPI.Message{Message: &lotusChainTypes.Message{From: fromAddress, To: toAddress}}
+}
+
+func TestLotusGetAddressEventHeights(t *testing.T) {
+	tipset10 := testTipSet(t, 10)
+	tipset12 := testChildTipSet(t, tipset10, 12)
+	tipset13 := testChildTipSet(t, tipset12, 13)
+	eventsRoot, err := cid.Decode("bafy2bzacea3wsdh6y3a36tb3skempjoxqpuyompjbmfeyf34fi3uy6uue42v4")
+	require.NoError(t, err)
+
+	fullNodeMock := mocks.NewFullNode(t)
+	fullNodeMock.On("ChainGetTipSetByHeight", mock.Anything, abi.ChainEpoch(10), mock.Anything).Return(tipset10, nil)
+	// null round
+	fullNodeMock.On("ChainGetTipSetByHeight", mock.Anything, abi.ChainEpoch(11), mock.Anything).Return(tipset10, nil)
+	fullNodeMock.On("ChainGetTipSetByHeight", mock.Anything, abi.ChainEpoch(12), mock.Anything).Return(tipset12, nil)
+	fullNodeMock.On("ChainGetMessagesInTipset", mock.Anything, tipset10.Key()).Return([]lotusAPI.Message{
+		testMessage(t, "f01001", "f01002"),
+	}, nil)
+	fullNodeMock.On("ChainGetMessagesInTipset", mock.Anything, tipset12.Key()).Return([]lotusAPI.Message{
+		testMessage(t, "f01001", "f01003"),
+		testMessage(t, "f01001", "f01002"),
+	}, nil)
+	rpcClient := &testRPCClient{client: fullNodeMock}
+
+	_, err = NewLotus(rpcClient, 12, 10, false, nil)
+	assert.Error(t, err)
+
+	provider, err := NewLotus(rpcClient, 10, 12, false, nil)
+	require.NoError(t, err)
+	heights, err := provider.GetAddressEventHeights(t.Context(), "f01001")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{10, 12}, heights)
+	heights, err = provider.GetAddressEventHeights(t.Context(), "f01004")
+	require.NoError(t, err)
+	assert.Empty(t, heights)
+
+	// events of the messages of a tipset are found in the receipts of its child
+	fullNodeMock.On("ChainGetParentReceipts", mock.Anything, tipset12.Cids()[0]).Return([]*lotusChainTypes.MessageReceipt{
+		{EventsRoot: &eventsRoot},
+	}, nil)
+	fullNodeMock.On("ChainGetEvents", mock.Anything, eventsRoot).Return([]lotusChainTypes.Event{{Emitter: abi.ActorID(1004)}}, nil)
+	fullNodeMock.On("ChainGetTipSetAfterHeight", mock.Anything, abi.ChainEpoch(13), mock.Anything).Return(tipset13, nil)
+	fullNodeMock.On("ChainGetParentReceipts", mock.Anything, tipset13.Cids()[0]).Return([]*lotusChainTypes.MessageReceipt{{}, {}}, nil)
+
+	provider, err = NewLotus(rpcClient, 10, 12, true, nil)
+	require.NoError(t, err)
+	heights, err = provider.GetAddressEventHeights(t.Context(), "f01004")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{10}, heights)
+}
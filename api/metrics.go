@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zondax/golem/pkg/metrics"
+	"github.com/zondax/golem/pkg/metrics/collectors"
+	"go.uber.org/zap"
+)
+
+const (
+	MetricsAppName = "fil-trace-check"
+	// DefaultMetricsPath is where the metrics are served when metrics_path is not set
+	DefaultMetricsPath = "/metrics"
+
+	ResultsMetric            = "fil_trace_check_results_total"
+	ProcessedMetric          = "fil_trace_check_processed_total"
+	CurrentHeightMetric      = "fil_trace_check_current_height"
+	HeadLagMetric            = "fil_trace_check_head_lag_epochs"
+	RPCRequestDurationMetric = "fil_trace_check_rpc_request_duration_seconds"
+	RPCEndpointErrorsMetric  = "fil_trace_check_rpc_endpoint_errors_total"
+	TraceStoreDurationMetric = "fil_trace_check_trace_store_request_duration_seconds"
+	TraceStoreErrorsMetric   = "fil_trace_check_trace_store_errors_total"
+
+	resultPass              = "pass"
+	resultFail              = "fail"
+	traceStoreGetOperation  = "get"
+	traceStoreListOperation = "list"
+)
+
+// requestDurationBuckets are in seconds, from fast cached node calls to slow trace downloads
+var requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+var (
+	activeMetrics     metrics.TaskMetrics
+	activeMetricsOnce sync.Once
+)
+
+type metricDefinition struct {
+	name    string
+	help    string
+	labels  []string
+	handler metrics.MetricHandler
+}
+
+var metricDefinitions = []metricDefinition{
+	{ResultsMetric, "Validation results by check, result and failure category", []string{"check", "result", "category"}, &collectors.Counter{}},
+	{ProcessedMetric, "Epochs processed by check, per address for address checks", []string{"check"}, &collectors.Counter{}},
+	{CurrentHeightMetric, "Last height processed by check", []string{"check"}, &collectors.Gauge{}},
+	{HeadLagMetric, "Epochs between the chain head and the next height to validate in watch mode", []string{"check"}, &collectors.Gauge{}},
+	{RPCRequestDurationMetric, "Duration of node calls by method", []string{"method"}, &collectors.Histogram{Buckets: requestDurationBuckets}},
+	{RPCEndpointErrorsMetric, "Transient node call errors by endpoint", []string{"endpoint"}, &collectors.Counter{}},
+	{TraceStoreDurationMetric, "Duration of trace store requests by operation", []string{"operation"}, &collectors.Histogram{Buckets: requestDurationBuckets}},
+	{TraceStoreErrorsMetric, "Trace store request errors by operation", []string{"operation"}, &collectors.Counter{}},
+}
+
+// StartMetrics serves the metrics on port and path in the background. Metrics are registered in the global
+// prometheus registry, so only the first call of the process starts a server.
+func StartMetrics(port, path string) error {
+	var err error
+	activeMetricsOnce.Do(func() {
+		taskMetrics := metrics.NewTaskMetrics(path, port, MetricsAppName)
+		for _, definition := range metricDefinitions {
+			if err = taskMetrics.RegisterMetric(definition.name, definition.help, definition.labels, definition.handler); err != nil {
+				err = fmt.Errorf("could not register metric %s: %w", definition.name, err)
+				return
+			}
+		}
+		go func() {
+			if err := taskMetrics.Start(); err != nil {
+				zap.L().Error("metrics server stopped", zap.Error(err))
+			}
+		}()
+		activeMetrics = taskMetrics
+	})
+	return err
+}
+
+// updateMetric is a no-op when metrics are not started, errors are logged as metrics must not fail validations
+func updateMetric(name string, value float64, labels ...string) {
+	if activeMetrics == nil {
+		return
+	}
+	if err := activeMetrics.UpdateMetric(name, value, labels...); err != nil {
+		zap.L().Debug("could not update metric", zap.Error(err), zap.String("metric", name))
+	}
+}
+
+// RecordResult counts a validation result of check, category is ignored for passing results. Results of an address
+// that are not at a height, such as a failure to get its event heights, leave the current height as it is.
+func RecordResult(check string, height int64, success bool, category string) {
+	result := resultPass
+	if success {
+		category = ""
+	} else {
+		result = resultFail
+	}
+	updateMetric(ResultsMetric, 1, check, result, category)
+	updateMetric(ProcessedMetric, 1, check)
+	if height > 0 {
+		updateMetric(CurrentHeightMetric, float64(height), check)
+	}
+}
+
+// RecordHeadLag sets how many epochs check is behind the head
+func RecordHeadLag(check string, lag int64) {
+	updateMetric(HeadLagMetric, float64(lag), check)
+}
+
+func observeRPCCall(endpoint, method string, duration time.Duration, transientErr bool) {
+	updateMetric(RPCRequestDurationMetric, duration.Seconds(), method)
+	if transientErr {
+		updateMetric(RPCEndpointErrorsMetric, 1, endpoint)
+	}
+}
+
+func observeTraceStoreRequest(operation string, duration time.Duration, err error) {
+	updateMetric(TraceStoreDurationMetric, duration.Seconds(), operation)
+	if err != nil {
+		updateMetric(TraceStoreErrorsMetric, 1, operation)
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	// no-op until started
+	RecordResult("validate-null-blocks", 10, false, "trace")
+
+	require.NoError(t, StartMetrics("0", DefaultMetricsPath))
+	require.NotNil(t, activeMetrics)
+	// only the first call starts a server
+	require.NoError(t, StartMetrics("0", DefaultMetricsPath))
+
+	labels := map[string][]string{
+		ResultsMetric:            {"validate-null-blocks", resultFail, "trace"},
+		ProcessedMetric:          {"validate-null-blocks"},
+		CurrentHeightMetric:      {"validate-null-blocks"},
+		HeadLagMetric:            {"validate-null-blocks"},
+		RPCRequestDurationMetric: {"ChainHead"},
+		RPCEndpointErrorsMetric:  {"http://node"},
+		TraceStoreDurationMetric: {traceStoreGetOperation},
+		TraceStoreErrorsMetric:   {traceStoreGetOperation},
+	}
+	assert.Len(t, labels, len(metricDefinitions))
+	for name, values := range labels {
+		assert.NoError(t, activeMetrics.UpdateMetric(name, 1, values...), name)
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	parserV1 "github.com/zondax/fil-parser/parser/v1"
+	parserV2 "github.com/zondax/fil-parser/parser/v2"
+	"github.com/zondax/fil-parser/tools"
+	"github.com/zondax/fil-parser/types"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	MainnetNetwork     = "mainnet"
+	CalibrationNetwork = "calibration"
+)
+
+// NodeVersionRange is the node version traces are parsed as from a height until the next range
+type NodeVersionRange struct {
+	From    int64  `mapstructure:"from"`
+	Version string `mapstructure:"version"`
+}
+
+// NetworkProfile holds everything that depends on the network the traces belong to
+type NetworkProfile struct {
+	Name string `mapstructure:"name"`
+	// ActorsNetwork is the network fil-parser maps heights to actor versions with, mainnet or calibration
+	ActorsNetwork string `mapstructure:"actors_network"`
+	// ParserV1MaxHeight is the last height whose traces use the v1 compute state format
+	ParserV1MaxHeight int64 `mapstructure:"parser_v1_max_height"`
+	// NodeVersions are sorted by From and start at 0
+	NodeVersions []NodeVersionRange `mapstructure:"node_versions"`
+	// BeryxURL is empty when Beryx does not index the network
+	BeryxURL string `mapstructure:"beryx_url"`
+}
+
+var networkProfiles = map[string]*NetworkProfile{
+	MainnetNetwork: {
+		Name:          MainnetNetwork,
+		ActorsNetwork: tools.MainnetNetwork,
+		// the traces switched format with the lotus v1.23 nodes that traced them, after the Thunder upgrade (nv20 at
+		// 2870280) and with no upgrade of its own: the fil-parser test traces are v1 at 2907480 and v2 at 2907520
+		ParserV1MaxHeight: 2907480,
+		NodeVersions: []NodeVersionRange{
+			{From: 0, Version: "v1.22.0"},
+			{From: 2907481, Version: "v1.34.0"},
+		},
+		BeryxURL: BeryxBaseURL + "/" + MainnetNetwork,
+	},
+	CalibrationNetwork: {
+		Name:          CalibrationNetwork,
+		ActorsNetwork: tools.CalibrationNetwork,
+		// the Lightning upgrade (nv19) on calibration, fil-parser tools.V19
+		ParserV1MaxHeight: 489094,
+		NodeVersions: []NodeVersionRange{
+			{From: 0, Version: "v1.22.0"},
+			{From: 489095, Version: "v1.34.0"},
+		},
+		BeryxURL: BeryxBaseURL + "/" + CalibrationNetwork,
+	},
+}
+
+// GetNetworkProfile returns the built-in profile of network, mainnet if empty
+func GetNetworkProfile(network string) (*NetworkProfile, error) {
+	if network == "" {
+		network = MainnetNetwork
+	}
+	profile, ok := networkProfiles[strings.ToLower(network)]
+	if !ok {
+		return nil, fmt.Errorf("unknown network %s, expected one of %s or a profile in the config file", network, strings.Join(slices.Sorted(maps.Keys(networkProfiles)), ", "))
+	}
+	return profile, nil
+}
+
+func (p *NetworkProfile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("network profile without name")
+	}
+	if p.ActorsNetwork != tools.MainnetNetwork && p.ActorsNetwork != tools.CalibrationNetwork {
+		return fmt.Errorf("network %s: actors_network must be %s or %s", p.Name, tools.MainnetNetwork, tools.CalibrationNetwork)
+	}
+	if len(p.NodeVersions) == 0 || p.NodeVersions[0].From != 0 {
+		return fmt.Errorf("network %s: node_versions must start at height 0", p.Name)
+	}
+	if !slices.IsSortedFunc(p.NodeVersions, func(a, b NodeVersionRange) int { return cmp.Compare(a.From, b.From) }) {
+		return fmt.Errorf("network %s: node_versions must be sorted by height", p.Name)
+	}
+	for _, nodeVersion := range p.NodeVersions {
+		if _, err := nodeInfoFromVersion(nodeVersion.Version); err != nil {
+			return fmt.Errorf("network %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// HeightToNodeVersion returns the maximum node version for a given height.
+// This is used to enable fil-parser to use the correct StateCompute format for parsing.
+func (p *NetworkProfile) HeightToNodeVersion(height int64) *types.NodeInfo {
+	index, found := slices.BinarySearchFunc(p.NodeVersions, height, func(r NodeVersionRange, h int64) int { return cmp.Compare(r.From, h) })
+	if !found {
+		index--
+	}
+	// validated profiles always have a range starting at 0
+	nodeInfo, _ := nodeInfoFromVersion(p.NodeVersions[max(index, 0)].Version)
+	return nodeInfo
+}
+
+// HeightToParserVersion returns the parser version for a given height.
+func (p *NetworkProfile) HeightToParserVersion(height int64) string {
+	if height <= p.ParserV1MaxHeight {
+		return parserV1.Version
+	}
+	return parserV2.Version
+}
+
+func nodeInfoFromVersion(version string) (*types.NodeInfo, error) {
+	majorMinor := semver.MajorMinor(version)
+	if majorMinor == "" {
+		return nil, fmt.Errorf("invalid node version %s", version)
+	}
+	return &types.NodeInfo{
+		NodeFullVersion:       version,
+		NodeMajorMinorVersion: majorMinor,
+	}, nil
+}
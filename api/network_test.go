@@ -0,0 +1,76 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	parserV1 "github.com/zondax/fil-parser/parser/v1"
+	parserV2 "github.com/zondax/fil-parser/parser/v2"
+)
+
+func TestGetNetworkProfile(t *testing.T) {
+	profile, err := GetNetworkProfile("")
+	require.NoError(t, err)
+	assert.Equal(t, MainnetNetwork, profile.Name)
+
+	profile, err = GetNetworkProfile("Calibration")
+	require.NoError(t, err)
+	assert.Equal(t, CalibrationNetwork, profile.ActorsNetwork)
+	assert.Equal(t, BeryxBaseURL+"/calibration", profile.BeryxURL)
+
+	_, err = GetNetworkProfile("devnet")
+	assert.Error(t, err)
+}
+
+func TestNetworkProfileHeightMapping(t *testing.T) {
+	for network, lastV1Height := range map[string]int64{
+		MainnetNetwork:     2907480,
+		CalibrationNetwork: 489094,
+	} {
+		t.Run(network, func(t *testing.T) {
+			profile, err := GetNetworkProfile(network)
+			require.NoError(t, err)
+
+			assert.Equal(t, parserV1.Version, profile.HeightToParserVersion(0))
+			assert.Equal(t, parserV1.Version, profile.HeightToParserVersion(lastV1Height))
+			assert.Equal(t, parserV2.Version, profile.HeightToParserVersion(lastV1Height+1))
+			assert.Equal(t, "v1.22", profile.HeightToNodeVersion(0).NodeMajorMinorVersion)
+			assert.Equal(t, "v1.22", profile.HeightToNodeVersion(lastV1Height).NodeMajorMinorVersion)
+			assert.Equal(t, "v1.34", profile.HeightToNodeVersion(lastV1Height+1).NodeMajorMinorVersion)
+			assert.Equal(t, "v1.34.0", profile.HeightToNodeVersion(5_000_000).NodeFullVersion)
+		})
+	}
+}
+
+func TestConfigNetwork(t *testing.T) {
+	devnet := NetworkProfile{
+		Name:          "devnet",
+		ActorsNetwork: CalibrationNetwork,
+		NodeVersions:  []NodeVersionRange{{From: 0, Version: "v1.34.0"}},
+	}
+	config := Config{NetworkName: "devnet", Networks: []NetworkProfile{devnet}}
+	profile, err := config.Network()
+	require.NoError(t, err)
+	assert.Equal(t, parserV2.Version, profile.HeightToParserVersion(1))
+	assert.Equal(t, "v1.34", profile.HeightToNodeVersion(1).NodeMajorMinorVersion)
+	assert.Empty(t, profile.BeryxURL)
+
+	// built-in profiles are still available
+	config.NetworkName = MainnetNetwork
+	profile, err = config.Network()
+	require.NoError(t, err)
+	assert.Equal(t, MainnetNetwork, profile.Name)
+
+	invalid := []NetworkProfile{
+		{Name: "devnet", ActorsNetwork: "devnet", NodeVersions: devnet.NodeVersions},
+		{Name: "devnet", ActorsNetwork: CalibrationNetwork},
+		{Name: "devnet", ActorsNetwork: CalibrationNetwork, NodeVersions: []NodeVersionRange{{From: 10, Version: "v1.34.0"}}},
+		{Name: "devnet", ActorsNetwork: CalibrationNetwork, NodeVersions: []NodeVersionRange{{From: 0, Version: "latest"}}},
+	}
+	for _, profile := range invalid {
+		config := Config{NetworkName: "devnet", Networks: []NetworkProfile{profile}}
+		_, err := config.Network()
+		assert.Error(t, err)
+	}
+}
@@ -2,8 +2,10 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync/atomic"
 
 	jsonrpc "github.com/filecoin-project/go-jsonrpc"
 	"github.com/filecoin-project/go-state-types/abi"
@@ -12,6 +14,7 @@ import (
 	lotusChainTypes "github.com/filecoin-project/lotus/chain/types"
 	"github.com/zondax/fil-parser/types"
 	rosettaFilecoinLib "github.com/zondax/rosetta-filecoin-lib"
+	"go.uber.org/zap"
 )
 
 type RPCClientInterface interface {
@@ -21,13 +24,12 @@ type RPCClientInterface interface {
 }
 
 type RPCClient struct {
-	url          string
-	token        string
-	client       api.FullNode
-	clientCloser *jsonrpc.ClientCloser
-	ctx          context.Context
-	rosettaLib   *rosettaFilecoinLib.RosettaConstructionFilecoin
-	nodeInfo     types.NodeInfo
+	node       *failoverNode
+	cache      *NodeCache
+	client     api.FullNode
+	closers    []jsonrpc.ClientCloser
+	rosettaLib *rosettaFilecoinLib.RosettaConstructionFilecoin
+	nodeInfo   types.NodeInfo
 }
 
 func (rpc *RPCClient) RosettaLib() *rosettaFilecoinLib.RosettaConstructionFilecoin {
@@ -42,28 +44,108 @@ func (rpc *RPCClient) FullNodeClient() api.FullNode {
 	return rpc.client
 }
 
-// NewFilecoinRPCClient creates a new blockchain RPC remoteNode
-func NewFilecoinRPCClient(ctx context.Context, url string, token string) (RPCClientInterface, error) {
+// sharedRPCClient hides the Close method of the shared client from its users
+type sharedRPCClient struct {
+	RPCClientInterface
+}
+
+var activeSharedRPCClient atomic.Pointer[sharedRPCClient]
 
-	headers := http.Header{}
-	if len(token) > 0 {
-		headers.Add("Authorization", "Bearer "+token)
+// ShareRPCClient makes NewFilecoinRPCClient return rpcClient until it is called with nil. Closing the shared client
+// is left to the caller.
+func ShareRPCClient(rpcClient RPCClientInterface) {
+	if rpcClient == nil {
+		activeSharedRPCClient.Store(nil)
+		return
 	}
+	activeSharedRPCClient.Store(&sharedRPCClient{rpcClient})
+}
 
-	lotusAPI, closer, err := client.NewFullNodeRPCV1(ctx, url, headers)
+// NewFilecoinRPCClient creates a client for the nodes in config. Calls are retried on transient errors and fail
+// over between the nodes, node_url first. The node cache is used when node_cache_path is set, a cache that cannot
+// be opened is skipped unless running from the cache only. The client shared by ShareRPCClient is returned instead
+// when there is one.
+func NewFilecoinRPCClient(ctx context.Context, config *Config) (RPCClientInterface, error) {
+	if shared := activeSharedRPCClient.Load(); shared != nil {
+		return shared, nil
+	}
+	options := RPCOptions{
+		Timeout:    config.RPCTimeout,
+		MaxRetries: config.RPCMaxRetries,
+		Backoff:    rpcRetryBackoff,
+		Limiter:    config.RPCRateLimiter(),
+		CacheOnly:  config.NodeCacheOnly,
+	}
+	if config.NodeCachePath != "" {
+		cache, err := OpenNodeCache(config.NodeCachePath)
+		if err != nil {
+			if config.NodeCacheOnly {
+				return nil, err
+			}
+			zap.L().Warn("running without node cache", zap.Error(err))
+		}
+		options.Cache = cache
+	}
+	rpcClient, err := NewFailoverRPCClient(ctx, config.NodeEndpoints(), options)
+	if err != nil && options.Cache != nil {
+		_ = options.Cache.Close()
+	}
+	return rpcClient, err
+}
 
-	if err != nil {
-		return nil, err
+// NewFailoverRPCClient connects to every endpoint, those that cannot be reached are skipped
+func NewFailoverRPCClient(ctx context.Context, endpoints []NodeEndpoint, options RPCOptions) (RPCClientInterface, error) {
+	log := zap.L()
+	if options.CacheOnly {
+		if options.Cache == nil {
+			return nil, fmt.Errorf("node cache only mode without node cache")
+		}
+		endpoints = nil
+		log.Info("running from the node cache only")
+	}
+	rpc := &RPCClient{cache: options.Cache}
+	node := &failoverNode{options: options, log: log}
+	var errs []error
+	for _, endpoint := range endpoints {
+		headers := http.Header{}
+		if len(endpoint.Token) > 0 {
+			headers.Add("Authorization", "Bearer "+endpoint.Token)
+		}
+
+		lotusAPI, closer, err := client.NewFullNodeRPCV1(ctx, endpoint.URL, headers)
+		if err != nil {
+			log.Warn("could not connect to node", zap.Error(err), zap.String("endpoint", endpoint.URL))
+			errs = append(errs, fmt.Errorf("%s: %w", endpoint.URL, err))
+			continue
+		}
+		rpc.closers = append(rpc.closers, closer)
+		node.endpoints = append(node.endpoints, &rpcEndpoint{url: endpoint.URL, client: lotusAPI})
+	}
+	if len(node.endpoints) == 0 && !options.CacheOnly {
+		return nil, fmt.Errorf("could not connect to any node: %w", errors.Join(errs...))
+	}
+	rpc.node = node
+	rpc.client = newFailoverFullNode(node)
+	if options.Cache != nil {
+		cachedNode := &cachedFullNode{FullNode: rpc.client, cache: options.Cache, cacheOnly: options.CacheOnly}
+		if !options.CacheOnly {
+			// the head decides which tipsets looked up by height are final
+			if _, err := cachedNode.ChainHead(ctx); err != nil {
+				log.Warn("could not get chain head, tipsets by height are not cached", zap.Error(err))
+			}
+		}
+		rpc.client = cachedNode
 	}
 
 	// Setup rosetta lib
-	r := rosettaFilecoinLib.NewRosettaConstructionFilecoin(lotusAPI)
+	r := rosettaFilecoinLib.NewRosettaConstructionFilecoin(rpc.client)
 	if r == nil {
 		return nil, fmt.Errorf("could not create instance of rosetta filecoin-lib")
 	}
+	rpc.rosettaLib = r
 
 	// Get node version
-	nodeFullVersion, err := lotusAPI.Version(ctx)
+	nodeFullVersion, err := rpc.client.Version(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -71,17 +153,30 @@ func NewFilecoinRPCClient(ctx context.Context, url string, token string) (RPCCli
 	if err != nil {
 		return nil, err
 	}
+	rpc.nodeInfo = *nodeInfo
 
-	return &RPCClient{
-		url:          url,
-		token:        token,
-		client:       lotusAPI,
-		clientCloser: &closer,
-		ctx:          ctx,
-		rosettaLib:   r,
-		nodeInfo:     *nodeInfo,
-	}, nil
+	return rpc, nil
+}
 
+// Close logs the calls and errors of every node and closes the connections and the node cache
+func (rpc *RPCClient) Close() {
+	for _, endpoint := range rpc.node.endpoints {
+		rpc.node.log.Info("node stats",
+			zap.String("endpoint", endpoint.url),
+			zap.Int64("calls", endpoint.calls.Load()),
+			zap.Int64("errors", endpoint.errors.Load()),
+		)
+	}
+	for _, closer := range rpc.closers {
+		closer()
+	}
+	if rpc.cache != nil {
+		hits, misses := rpc.cache.Stats()
+		rpc.node.log.Info("node cache stats", zap.Int64("hits", hits), zap.Int64("misses", misses))
+		if err := rpc.cache.Close(); err != nil {
+			rpc.node.log.Error("failed to close node cache", zap.Error(err))
+		}
+	}
 }
 
 func ChainGetTipSetByHeight(ctx context.Context, height int64, rpcClient RPCClientInterface) (*lotusChainTypes.TipSet, error) {
@@ -91,3 +186,28 @@ func ChainGetTipSetByHeight(ctx context.Context, height int64, rpcClient RPCClie
 	}
 	return tipset, nil
 }
+
+// ChainGetNextTipSet returns the first non-null tipset after tipset, where the state resulting from its messages
+// is applied. Null rounds after tipset are skipped and the result must be a child of tipset.
+func ChainGetNextTipSet(ctx context.Context, tipset *lotusChainTypes.TipSet, rpcClient RPCClientInterface) (*lotusChainTypes.TipSet, error) {
+	next, err := rpcClient.FullNodeClient().ChainGetTipSetAfterHeight(ctx, tipset.Height()+1, lotusChainTypes.EmptyTSK)
+	if err != nil {
+		return nil, fmt.Errorf("could not get tipset after %d: %w", tipset.Height(), err)
+	}
+	if next.Parents() != tipset.Key() {
+		return nil, fmt.Errorf("tipset %d after %d is not its child, parents %s, expected %s", next.Height(), tipset.Height(), next.Parents(), tipset.Key())
+	}
+	return next, nil
+}
+
+// F3FinalHeight returns the height of the last tipset finalized by F3
+func F3FinalHeight(ctx context.Context, rpcClient RPCClientInterface) (int64, error) {
+	certificate, err := rpcClient.FullNodeClient().F3GetLatestCertificate(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("could not get latest F3 certificate: %w", err)
+	}
+	if certificate == nil || certificate.ECChain.IsZero() {
+		return 0, fmt.Errorf("latest F3 certificate has no finalized tipsets")
+	}
+	return certificate.ECChain.Head().Epoch, nil
+}
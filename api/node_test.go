@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-f3/certs"
+	"github.com/filecoin-project/go-f3/gpbft"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+)
+
+func TestChainGetNextTipSet(t *testing.T) {
+	tipset := testTipSet(t, 10)
+
+	t.Run("next height", func(t *testing.T) {
+		next := testChildTipSet(t, tipset, 11)
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("ChainGetTipSetAfterHeight", mock.Anything, abi.ChainEpoch(11), mock.Anything).Return(next, nil).Once()
+
+		result, err := ChainGetNextTipSet(t.Context(), tipset, &testRPCClient{client: fullNodeMock})
+		require.NoError(t, err)
+		assert.Equal(t, next.Key(), result.Key())
+	})
+
+	t.Run("skips null rounds", func(t *testing.T) {
+		// 11 and 12 are null rounds
+		next := testChildTipSet(t, tipset, 13)
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("ChainGetTipSetAfterHeight", mock.Anything, abi.ChainEpoch(11), mock.Anything).Return(next, nil).Once()
+
+		result, err := ChainGetNextTipSet(t.Context(), tipset, &testRPCClient{client: fullNodeMock})
+		require.NoError(t, err)
+		assert.Equal(t, abi.ChainEpoch(13), result.Height())
+	})
+
+	t.Run("not a child", func(t *testing.T) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("ChainGetTipSetAfterHeight", mock.Anything, abi.ChainEpoch(11), mock.Anything).Return(testTipSet(t, 11), nil).Once()
+
+		_, err := ChainGetNextTipSet(t.Context(), tipset, &testRPCClient{client: fullNodeMock})
+		assert.Error(t, err)
+	})
+
+	t.Run("rpc error", func(t *testing.T) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("ChainGetTipSetAfterHeight", mock.Anything, abi.ChainEpoch(11), mock.Anything).Return(nil, errors.New("node error")).Once()
+
+		_, err := ChainGetNextTipSet(t.Context(), tipset, &testRPCClient{client: fullNodeMock})
+		assert.Error(t, err)
+	})
+}
+
+func TestF3FinalHeight(t *testing.T) {
+	fullNodeMock := mocks.NewFullNode(t)
+	fullNodeMock.On("F3GetLatestCertificate", mock.Anything).Return(&certs.FinalityCertificate{
+		ECChain: &gpbft.ECChain{TipSets: []*gpbft.TipSet{{Epoch: 100}, {Epoch: 101}}},
+	}, nil).Once()
+	height, err := F3FinalHeight(t.Context(), &testRPCClient{client: fullNodeMock})
+	require.NoError(t, err)
+	assert.Equal(t, int64(101), height)
+
+	fullNodeMock.On("F3GetLatestCertificate", mock.Anything).Return(&certs.FinalityCertificate{}, nil).Once()
+	_, err = F3FinalHeight(t.Context(), &testRPCClient{client: fullNodeMock})
+	assert.Error(t, err)
+}
+
+func TestShareRPCClient(t *testing.T) {
+	shared := &testRPCClient{}
+	ShareRPCClient(shared)
+	defer ShareRPCClient(nil)
+
+	rpcClient, err := NewFilecoinRPCClient(t.Context(), &Config{})
+	require.NoError(t, err)
+	assert.Equal(t, shared, rpcClient.(*sharedRPCClient).RPCClientInterface)
+	// users of the shared client cannot close it
+	_, closable := rpcClient.(interface{ Close() })
+	assert.False(t, closable)
+}
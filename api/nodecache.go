@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/lotus/api"
+	lotusChainTypes "github.com/filecoin-project/lotus/chain/types"
+)
+
+const (
+	NodeCacheBucket = "node-cache"
+	// NodeCacheFinality is how many epochs behind the head a tipset looked up by height must be to be cached
+	NodeCacheFinality = 900
+	// nodeCacheLockTimeout is how long to wait for another process using the cache
+	nodeCacheLockTimeout = 2 * time.Second
+)
+
+// ErrNotInNodeCache is returned in cache only mode for calls the cache cannot answer
+var ErrNotInNodeCache = errors.New("not in node cache")
+
+var (
+	nodeCachesMu sync.Mutex
+	nodeCaches   = map[string]*NodeCache{}
+)
+
+// NodeCache persists tipsets by height and key, and actor states by address and tipset key
+type NodeCache struct {
+	path   string
+	db     *DB
+	refs   int
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// OpenNodeCache opens the cache in path, clients of the same process share it until all of them close it
+func OpenNodeCache(path string) (*NodeCache, error) {
+	nodeCachesMu.Lock()
+	defer nodeCachesMu.Unlock()
+	if cache, ok := nodeCaches[path]; ok {
+		cache.refs++
+		return cache, nil
+	}
+	db, err := NewDBWithTimeout(path, NodeCacheBucket, nodeCacheLockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open node cache: %w", err)
+	}
+	cache := &NodeCache{path: path, db: db, refs: 1}
+	nodeCaches[path] = cache
+	return cache, nil
+}
+
+// get decodes the value of key into value, false if it is not cached
+func (c *NodeCache) get(key string, value any) (bool, error) {
+	var raw json.RawMessage
+	if err := c.db.Get(key, &raw); err != nil {
+		return false, err
+	}
+	if raw == nil {
+		c.misses.Add(1)
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, value); err != nil {
+		return false, fmt.Errorf("invalid node cache entry %s: %w", key, err)
+	}
+	c.hits.Add(1)
+	return true, nil
+}
+
+func (c *NodeCache) set(key string, value any) error {
+	return c.db.Insert(key, value)
+}
+
+// Stats returns the cache hits and misses since it was opened
+func (c *NodeCache) Stats() (int64, int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+func (c *NodeCache) Close() error {
+	nodeCachesMu.Lock()
+	defer nodeCachesMu.Unlock()
+	c.refs--
+	if c.refs > 0 {
+		return nil
+	}
+	delete(nodeCaches, c.path)
+	return c.db.Close()
+}
+
+func tipsetHeightCacheKey(height abi.ChainEpoch) string {
+	return fmt.Sprintf("height/%d", height)
+}
+
+func tipsetAfterHeightCacheKey(height abi.ChainEpoch) string {
+	return fmt.Sprintf("after/%d", height)
+}
+
+func tipsetCacheKey(tsk lotusChainTypes.TipSetKey) string {
+	return "tipset/" + tsk.String()
+}
+
+func actorCacheKey(addr address.Address, tsk lotusChainTypes.TipSetKey) string {
+	return fmt.Sprintf("actor/%s/%s", addr, tsk)
+}
+
+func actorStateCacheKey(addr address.Address, tsk lotusChainTypes.TipSetKey) string {
+	return fmt.Sprintf("state/%s/%s", addr, tsk)
+}
+
+const versionCacheKey = "version"
+
+// cachedFullNode answers the tipset and actor state calls from the cache and stores what the node returns. Only
+// results that cannot change are cached: tipsets by key, state at a tipset key and tipsets by height once final.
+type cachedFullNode struct {
+	api.FullNode
+	cache     *NodeCache
+	cacheOnly bool
+	// head is the highest head seen, 0 if unknown
+	head atomic.Int64
+}
+
+// cached returns the cached value of key or calls fetch and caches its result when store is true
+func cached[T any](n *cachedFullNode, key string, store bool, fetch func() (T, error)) (T, error) {
+	var value T
+	found, err := n.cache.get(key, &value)
+	if err != nil || found {
+		return value, err
+	}
+	if n.cacheOnly {
+		return value, fmt.Errorf("%w: %s", ErrNotInNodeCache, key)
+	}
+	value, err = fetch()
+	if err != nil || !store {
+		return value, err
+	}
+	return value, n.cache.set(key, value)
+}
+
+func (n *cachedFullNode) ChainHead(ctx context.Context) (*lotusChainTypes.TipSet, error) {
+	head, err := n.FullNode.ChainHead(ctx)
+	if err != nil {
+		if n.cacheOnly {
+			return nil, fmt.Errorf("%w: chain head", ErrNotInNodeCache)
+		}
+		return nil, err
+	}
+	n.updateHead(int64(head.Height()))
+	return head, nil
+}
+
+func (n *cachedFullNode) updateHead(height int64) {
+	for {
+		current := n.head.Load()
+		if height <= current || n.head.CompareAndSwap(current, height) {
+			return
+		}
+	}
+}
+
+func (n *cachedFullNode) isFinal(height abi.ChainEpoch) bool {
+	head := n.head.Load()
+	return head > 0 && int64(height) <= head-NodeCacheFinality
+}
+
+func (n *cachedFullNode) ChainGetTipSet(ctx context.Context, tsk lotusChainTypes.TipSetKey) (*lotusChainTypes.TipSet, error) {
+	return cached(n, tipsetCacheKey(tsk), true, func() (*lotusChainTypes.TipSet, error) {
+		return n.FullNode.ChainGetTipSet(ctx, tsk)
+	})
+}
+
+func (n *cachedFullNode) ChainGetTipSetByHeight(ctx context.Context, height abi.ChainEpoch, tsk lotusChainTypes.TipSetKey) (*lotusChainTypes.TipSet, error) {
+	// lookbacks from a tipset other than the head are not cached
+	if !tsk.IsEmpty() {
+		return n.FullNode.ChainGetTipSetByHeight(ctx, height, tsk)
+	}
+	key, err := cached(n, tipsetHeightCacheKey(height), n.isFinal(height), func() (lotusChainTypes.TipSetKey, error) {
+		tipset, err := n.FullNode.ChainGetTipSetByHeight(ctx, height, tsk)
+		if err != nil {
+			return lotusChainTypes.EmptyTSK, err
+		}
+		if err := n.cache.set(tipsetCacheKey(tipset.Key()), tipset); err != nil {
+			return lotusChainTypes.EmptyTSK, err
+		}
+		return tipset.Key(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return n.ChainGetTipSet(ctx, key)
+}
+
+func (n *cachedFullNode) ChainGetTipSetAfterHeight(ctx context.Context, height abi.ChainEpoch, tsk lotusChainTypes.TipSetKey) (*lotusChainTypes.TipSet, error) {
+	if !tsk.IsEmpty() {
+		return n.FullNode.ChainGetTipSetAfterHeight(ctx, height, tsk)
+	}
+	// the tipset found can be after height, it has to be final as well
+	var found *lotusChainTypes.TipSet
+	key, err := cached(n, tipsetAfterHeightCacheKey(height), n.isFinal(height+NodeCacheFinality), func() (lotusChainTypes.TipSetKey, error) {
+		tipset, err := n.FullNode.ChainGetTipSetAfterHeight(ctx, height, tsk)
+		if err != nil {
+			return lotusChainTypes.EmptyTSK, err
+		}
+		found = tipset
+		return tipset.Key(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found != nil {
+		return found, n.cache.set(tipsetCacheKey(found.Key()), found)
+	}
+	return n.ChainGetTipSet(ctx, key)
+}
+
+func (n *cachedFullNode) StateGetActor(ctx context.Context, addr address.Address, tsk lotusChainTypes.TipSetKey) (*lotusChainTypes.Actor, error) {
+	// the state at the head changes
+	if tsk.IsEmpty() {
+		return n.FullNode.StateGetActor(ctx, addr, tsk)
+	}
+	return cached(n, actorCacheKey(addr, tsk), true, func() (*lotusChainTypes.Actor, error) {
+		return n.FullNode.StateGetActor(ctx, addr, tsk)
+	})
+}
+
+func (n *cachedFullNode) StateReadState(ctx context.Context, addr address.Address, tsk lotusChainTypes.TipSetKey) (*api.ActorState, error) {
+	if tsk.IsEmpty() {
+		return n.FullNode.StateReadState(ctx, addr, tsk)
+	}
+	return cached(n, actorStateCacheKey(addr, tsk), true, func() (*api.ActorState, error) {
+		return n.FullNode.StateReadState(ctx, addr, tsk)
+	})
+}
+
+func (n *cachedFullNode) Version(ctx context.Context) (api.APIVersion, error) {
+	if n.cacheOnly {
+		return cached(n, versionCacheKey, false, func() (api.APIVersion, error) { return api.APIVersion{}, nil })
+	}
+	version, err := n.FullNode.Version(ctx)
+	if err != nil {
+		return version, err
+	}
+	return version, n.cache.set(versionCacheKey, version)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	lotusChainTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+)
+
+func TestCachedFullNode(t *testing.T) {
+	path := t.TempDir()
+	head := testTipSet(t, 2000)
+	final := testTipSet(t, 100)
+	recent := testTipSet(t, 1500)
+	addr, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+
+	cache, err := OpenNodeCache(path)
+	require.NoError(t, err)
+	fullNodeMock := mocks.NewFullNode(t)
+	fullNodeMock.On("ChainHead", mock.Anything).Return(head, nil).Once()
+	fullNodeMock.On("ChainGetTipSetByHeight", mock.Anything, abi.ChainEpoch(100), lotusChainTypes.EmptyTSK).Return(final, nil).Once()
+	fullNodeMock.On("ChainGetTipSetByHeight", mock.Anything, abi.ChainEpoch(1500), lotusChainTypes.EmptyTSK).Return(recent, nil).Twice()
+	fullNodeMock.On("StateGetActor", mock.Anything, addr, final.Key()).Return(&lotusChainTypes.Actor{Nonce: 1}, nil).Once()
+	fullNodeMock.On("StateGetActor", mock.Anything, addr, lotusChainTypes.EmptyTSK).Return(&lotusChainTypes.Actor{Nonce: 2}, nil).Twice()
+
+	node := &cachedFullNode{FullNode: fullNodeMock, cache: cache}
+	_, err = node.ChainHead(t.Context())
+	require.NoError(t, err)
+	for range 2 {
+		// final tipsets are fetched once
+		tipset, err := node.ChainGetTipSetByHeight(t.Context(), 100, lotusChainTypes.EmptyTSK)
+		require.NoError(t, err)
+		assert.Equal(t, final.Key(), tipset.Key())
+		// tipsets within finality of the head are fetched every time
+		tipset, err = node.ChainGetTipSetByHeight(t.Context(), 1500, lotusChainTypes.EmptyTSK)
+		require.NoError(t, err)
+		assert.Equal(t, recent.Key(), tipset.Key())
+
+		actor, err := node.StateGetActor(t.Context(), addr, final.Key())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), actor.Nonce)
+		actor, err = node.StateGetActor(t.Context(), addr, lotusChainTypes.EmptyTSK)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), actor.Nonce)
+	}
+	require.NoError(t, cache.Close())
+
+	// cache only mode answers from the previous run without the node
+	cache, err = OpenNodeCache(path)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, cache.Close())
+	}()
+	node = &cachedFullNode{FullNode: mocks.NewFullNode(t), cache: cache, cacheOnly: true}
+	tipset, err := node.ChainGetTipSetByHeight(t.Context(), 100, lotusChainTypes.EmptyTSK)
+	require.NoError(t, err)
+	assert.Equal(t, final.Key(), tipset.Key())
+	assert.Equal(t, abi.ChainEpoch(100), tipset.Height())
+	actor, err := node.StateGetActor(t.Context(), addr, final.Key())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), actor.Nonce)
+
+	_, err = node.ChainGetTipSetByHeight(t.Context(), 1500, lotusChainTypes.EmptyTSK)
+	assert.ErrorIs(t, err, ErrNotInNodeCache)
+}
+
+func TestOpenNodeCacheShared(t *testing.T) {
+	path := t.TempDir()
+	first, err := OpenNodeCache(path)
+	require.NoError(t, err)
+	second, err := OpenNodeCache(path)
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	require.NoError(t, first.Close())
+	// still open for the second client
+	_, err = second.get(versionCacheKey, &struct{}{})
+	require.NoError(t, err)
+	require.NoError(t, second.Close())
+}
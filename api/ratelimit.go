@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	RPCLimiter        = "rpc"
+	TraceStoreLimiter = "trace-store"
+)
+
+// RateLimiter spaces requests to at most requestsPerSecond and bounds the requests in flight, a zero limit is
+// unlimited. A nil RateLimiter does not limit.
+type RateLimiter struct {
+	name        string
+	interval    time.Duration
+	maxInFlight int
+	inFlight    chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+
+	requests atomic.Int64
+	waited   atomic.Int64
+}
+
+// RateLimiterStats are the requests that went through a limiter and the total time they waited for it
+type RateLimiterStats struct {
+	Name     string
+	Requests int64
+	Waited   time.Duration
+}
+
+var (
+	rateLimitersMu sync.Mutex
+	rateLimiters   = map[string]*RateLimiter{}
+)
+
+func NewRateLimiter(name string, requestsPerSecond float64, maxInFlight int) *RateLimiter {
+	limiter := &RateLimiter{name: name, maxInFlight: max(maxInFlight, 0)}
+	if requestsPerSecond > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / requestsPerSecond)
+	}
+	if limiter.maxInFlight > 0 {
+		limiter.inFlight = make(chan struct{}, limiter.maxInFlight)
+	}
+	return limiter
+}
+
+// sharedRateLimiter returns the limiter every client named name shares in the process, it is replaced only when
+// the limits change
+func sharedRateLimiter(name string, requestsPerSecond float64, maxInFlight int) *RateLimiter {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	limiter := NewRateLimiter(name, requestsPerSecond, maxInFlight)
+	if existing, ok := rateLimiters[name]; ok && existing.interval == limiter.interval && existing.maxInFlight == limiter.maxInFlight {
+		return existing
+	}
+	rateLimiters[name] = limiter
+	return limiter
+}
+
+// GetRateLimiterStats returns the stats of the shared limiters sorted by name
+func GetRateLimiterStats() []RateLimiterStats {
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+	stats := make([]RateLimiterStats, 0, len(rateLimiters))
+	for _, limiter := range rateLimiters {
+		stats = append(stats, limiter.Stats())
+	}
+	slices.SortFunc(stats, func(a, b RateLimiterStats) int { return strings.Compare(a.Name, b.Name) })
+	return stats
+}
+
+// Acquire waits for a request slot, release must be called once the request is done
+func (l *RateLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	start := time.Now()
+	defer func() {
+		l.requests.Add(1)
+		l.waited.Add(int64(time.Since(start)))
+	}()
+
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		if l.next.Before(now) {
+			l.next = now
+		}
+		wait := l.next.Sub(now)
+		l.next = l.next.Add(l.interval)
+		l.mu.Unlock()
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+
+	if l.inFlight == nil {
+		return func() {}, nil
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case l.inFlight <- struct{}{}:
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-l.inFlight })
+	}, nil
+}
+
+func (l *RateLimiter) Stats() RateLimiterStats {
+	return RateLimiterStats{
+		Name:     l.name,
+		Requests: l.requests.Load(),
+		Waited:   time.Duration(l.waited.Load()),
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("spaces requests", func(t *testing.T) {
+		limiter := NewRateLimiter("test", 100, 0)
+		start := time.Now()
+		for range 3 {
+			release, err := limiter.Acquire(t.Context())
+			require.NoError(t, err)
+			release()
+		}
+		// the first request does not wait
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+		stats := limiter.Stats()
+		assert.Equal(t, int64(3), stats.Requests)
+		assert.GreaterOrEqual(t, stats.Waited, 20*time.Millisecond)
+	})
+
+	t.Run("bounds requests in flight", func(t *testing.T) {
+		limiter := NewRateLimiter("test", 0, 1)
+		release, err := limiter.Acquire(t.Context())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		_, err = limiter.Acquire(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		release()
+		release, err = limiter.Acquire(t.Context())
+		require.NoError(t, err)
+		release()
+	})
+
+	t.Run("nil does not limit", func(t *testing.T) {
+		var limiter *RateLimiter
+		release, err := limiter.Acquire(t.Context())
+		require.NoError(t, err)
+		release()
+	})
+
+	t.Run("shared until the limits change", func(t *testing.T) {
+		limiter := sharedRateLimiter("shared-test", 10, 2)
+		assert.Same(t, limiter, sharedRateLimiter("shared-test", 10, 2))
+		assert.NotSame(t, limiter, sharedRateLimiter("shared-test", 20, 2))
+	})
+}
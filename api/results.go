@@ -0,0 +1,51 @@
+package api
+
+import "sync"
+
+// ResultEvent is a result recorded by a check
+type ResultEvent struct {
+	Check   string
+	Address string
+	Height  int64
+	Success bool
+	Message string
+	// Category is the failure category of a failed result
+	Category string
+}
+
+var (
+	resultSubscribersMu  sync.RWMutex
+	resultSubscribers    = map[int]resultSubscriber{}
+	nextResultSubscriber int
+)
+
+type resultSubscriber struct {
+	check string
+	fn    func(ResultEvent)
+}
+
+// SubscribeResults calls fn with every result of check recorded in the process until unsubscribe is called. fn is
+// called from the goroutine recording the result and should return quickly.
+func SubscribeResults(check string, fn func(ResultEvent)) (unsubscribe func()) {
+	resultSubscribersMu.Lock()
+	defer resultSubscribersMu.Unlock()
+	id := nextResultSubscriber
+	nextResultSubscriber++
+	resultSubscribers[id] = resultSubscriber{check: check, fn: fn}
+	return func() {
+		resultSubscribersMu.Lock()
+		defer resultSubscribersMu.Unlock()
+		delete(resultSubscribers, id)
+	}
+}
+
+// PublishResult sends event to the subscribers of its check
+func PublishResult(event ResultEvent) {
+	resultSubscribersMu.RLock()
+	defer resultSubscribersMu.RUnlock()
+	for _, subscriber := range resultSubscribers {
+		if subscriber.check == event.Check {
+			subscriber.fn(event)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeResults(t *testing.T) {
+	events := []ResultEvent{}
+	unsubscribe := SubscribeResults("validate-json", func(event ResultEvent) {
+		events = append(events, event)
+	})
+	PublishResult(ResultEvent{Check: "validate-json", Height: 1, Success: true})
+	PublishResult(ResultEvent{Check: "validate-null-blocks", Height: 1, Success: true})
+	unsubscribe()
+	PublishResult(ResultEvent{Check: "validate-json", Height: 2, Success: true})
+
+	assert.Equal(t, []ResultEvent{{Check: "validate-json", Height: 1, Success: true}}, events)
+}
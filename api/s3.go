@@ -1,7 +1,11 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Zondax/zindexer/components/connections/data_store"
 	"github.com/filecoin-project/lotus/api"
@@ -9,6 +13,8 @@ import (
 	"github.com/zondax/fil-parser/types"
 )
 
+const tracePrefix = "traces_"
+
 type RawData struct {
 	Tipset         *types.ExtendedTipSet
 	Trace          *api.ComputeStateOutput
@@ -23,7 +29,7 @@ func GetDataStoreClient(config *Config) (*data_store.DataStoreClient, error) {
 		UseHttps: config.S3SSL,
 		User:     config.S3AccessKey,
 		Password: config.S3SecretKey,
-		Service:  "s5",
+		Service:  config.TraceSource,
 		DataPath: config.S3RawDataPath,
 	}
 
@@ -34,15 +40,116 @@ func GetDataStoreClient(config *Config) (*data_store.DataStoreClient, error) {
 	return &client, nil
 }
 
+// GetFirstTraceName returns the name of the first trace in the configured path, empty if there are none
+func GetFirstTraceName(ctx context.Context, dsClient *data_store.DataStoreClient, config *Config) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	storePath := fmt.Sprintf("%s/%s", config.S3Bucket, config.S3RawDataPath)
+	release, err := config.TraceStoreRateLimiter().Acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	start := time.Now()
+	names, err := dsClient.Client.ListChan(ctx, storePath, tracePrefix)
+	observeTraceStoreRequest(traceStoreListOperation, time.Since(start), err)
+	if err != nil {
+		return "", err
+	}
+	select {
+	case name := <-names:
+		return name, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// TraceCache keeps the compressed traces downloaded since it was last reset, so every check reading a height
+// downloads its trace once. Failed downloads are kept as well.
+type TraceCache struct {
+	mu        sync.Mutex
+	entries   map[int64]*traceCacheEntry
+	downloads atomic.Int64
+	reused    atomic.Int64
+}
+
+type traceCacheEntry struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+var activeTraceCache atomic.Pointer[TraceCache]
+
+func NewTraceCache() *TraceCache {
+	return &TraceCache{entries: map[int64]*traceCacheEntry{}}
+}
+
+// UseTraceCache makes GetTraceFromDataStore go through cache, nil downloads every trace again
+func UseTraceCache(cache *TraceCache) {
+	activeTraceCache.Store(cache)
+}
+
+// get returns the trace of height, concurrent readers wait for the first download
+func (c *TraceCache) get(height int64, download func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[height]
+	if !ok {
+		entry = &traceCacheEntry{done: make(chan struct{})}
+		c.entries[height] = entry
+	}
+	c.mu.Unlock()
+	if ok {
+		<-entry.done
+		c.reused.Add(1)
+		return entry.data, entry.err
+	}
+	entry.data, entry.err = download()
+	c.downloads.Add(1)
+	close(entry.done)
+	return entry.data, entry.err
+}
+
+// Reset drops the cached traces
+func (c *TraceCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[int64]*traceCacheEntry{}
+}
+
+// Stats returns the traces downloaded and the reads answered without a download
+func (c *TraceCache) Stats() (int64, int64) {
+	return c.downloads.Load(), c.reused.Load()
+}
+
 func GetTraceFromDataStore(height int64, dsClient *data_store.DataStoreClient, config *Config) ([]byte, error) {
 	storePath := fmt.Sprintf("%s/%s", config.S3Bucket, config.S3RawDataPath)
-	name := fmt.Sprintf("traces_%012d.json.s2", height)
+	name := fmt.Sprintf("%s%012d.json.s2", tracePrefix, height)
 
-	data, err := dsClient.Client.GetFile(name, storePath)
+	download := func() ([]byte, error) {
+		// the data store does not take a context, downloads are only bounded by the limiter
+		release, err := config.TraceStoreRateLimiter().Acquire(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		start := time.Now()
+		data, err := dsClient.Client.GetFile(name, storePath)
+		observeTraceStoreRequest(traceStoreGetOperation, time.Since(start), err)
+		return data, err
+	}
+	var data []byte
+	var err error
+	if cache := activeTraceCache.Load(); cache != nil {
+		data, err = cache.get(height, download)
+	} else {
+		data, err = download()
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	// traces are cached compressed, every reader decompresses its own copy
 	decompressed, err := decompress(data)
 	if err != nil {
 		return nil, err
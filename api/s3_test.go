@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceCache(t *testing.T) {
+	cache := NewTraceCache()
+	var downloads atomic.Int64
+	download := func() ([]byte, error) {
+		downloads.Add(1)
+		return []byte("trace"), nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := cache.get(100, download)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("trace"), data)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), downloads.Load())
+	downloaded, reused := cache.Stats()
+	assert.Equal(t, int64(1), downloaded)
+	assert.Equal(t, int64(9), reused)
+
+	// failed downloads are not retried until the cache is reset
+	failed := func() ([]byte, error) {
+		downloads.Add(1)
+		return nil, errors.New("not found")
+	}
+	_, err := cache.get(101, failed)
+	assert.Error(t, err)
+	_, err = cache.get(101, failed)
+	assert.Error(t, err)
+	assert.Equal(t, int64(2), downloads.Load())
+
+	cache.Reset()
+	_, err = cache.get(100, download)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), downloads.Load())
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	TraceIndexBucket = "trace-index"
+	// traceIndexLockTimeout is how long to wait for an indexing run holding the index
+	traceIndexLockTimeout = 5 * time.Second
+)
+
+// AddressResolver returns the equivalent addresses of an address
+type AddressResolver func(ctx context.Context, address string) (map[string]bool, error)
+
+// TraceIndex maps the addresses found in the traces to the heights they appear at
+type TraceIndex struct {
+	db       *DB
+	resolver AddressResolver
+}
+
+// NewTraceIndex opens the index in path, the resolver is used to look up the heights of every equivalent
+// address as traces reference actors by id or robust address
+func NewTraceIndex(path string, resolver AddressResolver) (*TraceIndex, error) {
+	db, err := NewDBWithTimeout(path, TraceIndexBucket, traceIndexLockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace index: %w", err)
+	}
+	return &TraceIndex{
+		db:       db,
+		resolver: resolver,
+	}, nil
+}
+
+// AddHeight records that addresses appear at height
+func (t *TraceIndex) AddHeight(height int64, addresses []string) error {
+	return t.db.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(t.db.bucket))
+		for _, address := range addresses {
+			heights := []int64{}
+			if data := bucket.Get([]byte(address)); data != nil {
+				if err := json.Unmarshal(data, &heights); err != nil {
+					return err
+				}
+			}
+			index, found := slices.BinarySearch(heights, height)
+			if found {
+				continue
+			}
+			heights = slices.Insert(heights, index, height)
+			data, err := json.Marshal(heights)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(address), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetAddressEventHeights returns the sorted heights any equivalent address of address appears at
+func (t *TraceIndex) GetAddressEventHeights(ctx context.Context, address string) ([]int64, error) {
+	equivalentAddresses := map[string]bool{address: true}
+	if t.resolver != nil {
+		resolved, err := t.resolver(ctx, address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve equivalent addresses: %w", err)
+		}
+		equivalentAddresses = resolved
+	}
+
+	heights := []int64{}
+	for equivalentAddress := range equivalentAddresses {
+		addressHeights := []int64{}
+		if err := t.db.Get(equivalentAddress, &addressHeights); err != nil {
+			return nil, err
+		}
+		heights = append(heights, addressHeights...)
+	}
+	slices.Sort(heights)
+	return slices.Compact(heights), nil
+}
+
+func (t *TraceIndex) Close() error {
+	return t.db.Close()
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	index, err := NewTraceIndex(tmpDir, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, index.AddHeight(20, []string{"f01234", "f1abc"}))
+	require.NoError(t, index.AddHeight(10, []string{"f01234"}))
+	// indexing a height twice does not duplicate it
+	require.NoError(t, index.AddHeight(20, []string{"f01234"}))
+	require.NoError(t, index.AddHeight(30, []string{"f1abc", "f05678"}))
+
+	heights, err := index.GetAddressEventHeights(t.Context(), "f01234")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{10, 20}, heights)
+
+	heights, err = index.GetAddressEventHeights(t.Context(), "f09999")
+	require.NoError(t, err)
+	assert.Empty(t, heights)
+	require.NoError(t, index.Close())
+
+	// heights of every equivalent address are merged
+	index, err = NewTraceIndex(tmpDir, func(_ context.Context, address string) (map[string]bool, error) {
+		return map[string]bool{address: true, "f01234": true}, nil
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, index.Close())
+	}()
+	heights, err = index.GetAddressEventHeights(t.Context(), "f1abc")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{10, 20, 30}, heights)
+}
@@ -7,16 +7,10 @@ import (
 	"strings"
 
 	"github.com/klauspost/compress/s2"
-	parserV1 "github.com/zondax/fil-parser/parser/v1"
-	parserV2 "github.com/zondax/fil-parser/parser/v2"
 	"github.com/zondax/fil-parser/types"
 	"golang.org/x/mod/semver"
 )
 
-const (
-	nv20UpgradeHeight = 489094
-)
-
 func decompress(data []byte) ([]byte, error) {
 	// Decompress data using s2
 	b := bytes.NewBuffer(data)
@@ -48,26 +42,3 @@ func processNodeVersion(fullVersion string) (*types.NodeInfo, error) {
 		NodeMajorMinorVersion: majorMinor,
 	}, nil
 }
-
-// HeightToNodeVersion returns the maximum node version for a given height.
-// This is used to enable fil-parser to use the correct StateCompute format for parsing.
-func HeightToNodeVersion(height int64) *types.NodeInfo {
-	if height <= nv20UpgradeHeight {
-		return &types.NodeInfo{
-			NodeFullVersion:       "v1.22.0",
-			NodeMajorMinorVersion: "v1.22",
-		}
-	}
-	return &types.NodeInfo{
-		NodeFullVersion:       "v1.34.0",
-		NodeMajorMinorVersion: "v1.34",
-	}
-}
-
-// HeightToParserVersion returns the parser version for a given height.
-func HeightToParserVersion(height int64) string {
-	if height <= nv20UpgradeHeight {
-		return parserV1.Version
-	}
-	return parserV2.Version
-}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/actors/builtin"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/spf13/cobra"
+	fil_parser "github.com/zondax/fil-parser"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"go.uber.org/zap"
+)
+
+func ValidateActorCreationCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.ActorCreationCheck,
+		Short: "Validate actors created in traces",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return validateActorCreation(cmd)
+		},
+	}
+	cmd.Flags().Int64(internal.StartFlag, 1, "start height to validate")
+	cmd.Flags().Int64(internal.EndFlag, 100, "end height to validate")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
+	return cmd
+}
+
+func validateActorCreation(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("failed to get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
+
+	start, err := cmd.Flags().GetInt64(internal.StartFlag)
+	if err != nil {
+		log.Error("failed to get start", zap.Error(err))
+		return err
+	}
+	end, err := cmd.Flags().GetInt64(internal.EndFlag)
+	if err != nil {
+		log.Error("failed to get end", zap.Error(err))
+		return err
+	}
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("failed to get db path", zap.Error(err))
+		return err
+	}
+	db, err := api.NewDB(dbPath, internal.ActorCreationCheck)
+	if err != nil {
+		log.Error("failed to create db", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error("failed to close database", zap.Error(err))
+		}
+	}()
+
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("failed to create rpc client", zap.Error(err))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	dataStore, err := api.GetDataStoreClient(&config)
+	if err != nil {
+		log.Error("failed to create data store client", zap.Error(err))
+		return err
+	}
+	parser, err := fil_parser.NewFilecoinParserWithActorV2(
+		rpcClient.RosettaLib(), api.GetDataSource(network, rpcClient),
+		getParserLogger(),
+	)
+	if err != nil {
+		log.Error("failed to create parser", zap.Error(err))
+		return err
+	}
+
+	latestHeight, err := resumeHeight(cmd, db)
+	if err != nil {
+		log.Error("failed to get latest height", zap.Error(err))
+		return err
+	}
+	if latestHeight > 0 && latestHeight > start {
+		log.Info("resuming from latest height", zap.Int64("latest-height", latestHeight))
+		start = latestHeight
+	}
+
+	for i := start; i <= end; i++ {
+		log.Debug(fmt.Sprintf("Validating actor creation for height %d", i))
+
+		data, err := api.GetTraceFromDataStore(i, dataStore, &config)
+		if err != nil {
+			log.Error("failed to get trace", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureTrace, err.Error(), db)
+			continue
+		}
+		tipset, err := api.ChainGetTipSetByHeight(ctx, i, rpcClient)
+		if err != nil {
+			log.Error("failed to get onchain tipset", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureNode, err.Error(), db)
+			continue
+		}
+		// on-chain state is applied on the next tipset
+		nextTipset, err := api.ChainGetNextTipSet(ctx, tipset, rpcClient)
+		if err != nil {
+			log.Error("failed to get next tipset", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureNode, err.Error(), db)
+			continue
+		}
+
+		txsData := parserTypes.TxsData{
+			Traces: data,
+			Tipset: &parserTypes.ExtendedTipSet{
+				TipSet: *tipset,
+			},
+		}
+		nodeInfo := network.HeightToNodeVersion(i)
+		txsData.Metadata.NodeInfo = *nodeInfo
+
+		parsedTxData, err := parser.ParseTransactions(ctx, txsData)
+		if err != nil {
+			log.Error("failed to parse transactions", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureParse, err.Error(), db)
+			continue
+		}
+
+		mismatches := []string{}
+		// the height is reported in the category of its first failure
+		category := internal.FailureMismatch
+		for _, created := range createdActors(parsedTxData.Addresses) {
+			if err := compareCreatedActor(ctx, created, nextTipset, rpcClient); err != nil {
+				log.Error("actor creation check failed", zap.Error(err), zap.String("address", created.Short), zap.Int64("height", i))
+				if len(mismatches) == 0 {
+					category = internal.FailureCategoryOf(err, internal.FailureMismatch)
+				}
+				mismatches = append(mismatches, err.Error())
+			}
+		}
+		if len(mismatches) > 0 {
+			internal.FailProgressHeight(i, category, strings.Join(mismatches, "; "), db)
+			continue
+		}
+		internal.UpdateProgressHeight(i, true, internal.ProgressOK, db)
+	}
+	return nil
+}
+
+// createdActors returns the addresses the parser found in init actor Exec/Exec4 calls, sorted by id
+func createdActors(addresses *parserTypes.AddressInfoMap) []*parserTypes.AddressInfo {
+	created := []*parserTypes.AddressInfo{}
+	if addresses == nil {
+		return created
+	}
+	addresses.Range(func(_ string, info *parserTypes.AddressInfo) bool {
+		if info.CreationTxCid != "" && !info.IsSystemActor {
+			created = append(created, info)
+		}
+		return true
+	})
+	sort.Slice(created, func(i, j int) bool { return created[i].Short < created[j].Short })
+	return created
+}
+
+func compareCreatedActor(ctx context.Context, created *parserTypes.AddressInfo, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) error {
+	idAddress, err := address.NewFromString(created.Short)
+	if err != nil {
+		return internal.Failure(internal.FailureParse, fmt.Errorf("invalid id address %s: %w", created.Short, err))
+	}
+	actor, err := rpcClient.FullNodeClient().StateGetActor(ctx, idAddress, tipset.Key())
+	if err != nil {
+		return internal.Failure(internal.FailureNode, fmt.Errorf("failed to get onchain actor %s: %w", created.Short, err))
+	}
+
+	mismatches := []string{}
+	if created.ActorCid != "" && created.ActorCid != actor.Code.String() {
+		mismatches = append(mismatches, fmt.Sprintf("code cid onchain=%s, parsed=%s", actor.Code, created.ActorCid))
+	}
+	// ActorNameByCode returns fil/<version>/<name>
+	if actorType := path.Base(builtin.ActorNameByCode(actor.Code)); created.ActorType != "" && created.ActorType != actorType {
+		mismatches = append(mismatches, fmt.Sprintf("actor type onchain=%s, parsed=%s", actorType, created.ActorType))
+	}
+	if created.Robust != "" {
+		robustAddress, err := rpcClient.FullNodeClient().StateLookupRobustAddress(ctx, idAddress, tipset.Key())
+		if err != nil {
+			return internal.Failure(internal.FailureNode, fmt.Errorf("failed to get onchain robust address for %s: %w", created.Short, err))
+		}
+		// actors created with Exec4 can also be referenced by their delegated address
+		delegated := actor.DelegatedAddress != nil && actor.DelegatedAddress.String() == created.Robust
+		if robustAddress.String() != created.Robust && !delegated {
+			mismatches = append(mismatches, fmt.Sprintf("robust address onchain=%s, parsed=%s", robustAddress, created.Robust))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("actor creation mismatch for %s: %s", created.Short, strings.Join(mismatches, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"testing"
+
+	address "github.com/filecoin-project/go-address"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+)
+
+// fil/1/multisig
+const multisigCodeCid = "bafkqadtgnfwc6mjpnv2wy5djonuwo"
+
+func TestCreatedActors(t *testing.T) {
+	addresses := parserTypes.NewAddressInfoMap()
+	addresses.Set("f01002", &parserTypes.AddressInfo{Short: "f01002", Robust: "f2b", CreationTxCid: "tx2"})
+	addresses.Set("f01001", &parserTypes.AddressInfo{Short: "f01001", Robust: "f2a", CreationTxCid: "tx1"})
+	addresses.Set("f01003", &parserTypes.AddressInfo{Short: "f01003", Robust: "f1c"})
+	addresses.Set("f04", &parserTypes.AddressInfo{Short: "f04", CreationTxCid: "tx3", IsSystemActor: true})
+
+	created := createdActors(addresses)
+	require.Len(t, created, 2)
+	assert.Equal(t, "f01001", created[0].Short)
+	assert.Equal(t, "f01002", created[1].Short)
+
+	assert.Empty(t, createdActors(nil))
+}
+
+func TestCompareCreatedActor(t *testing.T) {
+	code, err := cid.Decode(multisigCodeCid)
+	require.NoError(t, err)
+	robust, err := address.NewActorAddress([]byte("multisig"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		created   *parserTypes.AddressInfo
+		expectErr bool
+	}{
+		{
+			name:    "matching actor",
+			created: &parserTypes.AddressInfo{Short: "f01001", Robust: robust.String(), ActorCid: multisigCodeCid, ActorType: "multisig", CreationTxCid: "tx"},
+		},
+		{
+			name:      "wrong actor type",
+			created:   &parserTypes.AddressInfo{Short: "f01001", Robust: robust.String(), ActorCid: multisigCodeCid, ActorType: "account", CreationTxCid: "tx"},
+			expectErr: true,
+		},
+		{
+			name:      "wrong code cid",
+			created:   &parserTypes.AddressInfo{Short: "f01001", Robust: robust.String(), ActorCid: "bafkqaddgnfwc6mjpnv2wy5djonuwo", CreationTxCid: "tx"},
+			expectErr: true,
+		},
+		{
+			name:      "wrong robust address",
+			created:   &parserTypes.AddressInfo{Short: "f01001", Robust: "f2abc", ActorCid: multisigCodeCid, CreationTxCid: "tx"},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fullNodeMock := mocks.NewFullNode(t)
+			fullNodeMock.On("StateGetActor", mock.Anything, mock.Anything, mock.Anything).Return(&filTypes.Actor{Code: code}, nil)
+			fullNodeMock.On("StateLookupRobustAddress", mock.Anything, mock.Anything, mock.Anything).Return(robust, nil).Maybe()
+			mockRPCClient := &MockRPCClient{
+				client: fullNodeMock,
+			}
+
+			err := compareCreatedActor(t.Context(), tt.created, &filTypes.TipSet{}, mockRPCClient)
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 
@@ -26,8 +27,12 @@ func ValidateAddressBalanceCmd() *cobra.Command {
 	}
 	cmd.Flags().String(internal.AddressFileFlag, "", "path to a newline separated address file for addresses to check state")
 	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
-	cmd.Flags().String(internal.EventProviderFlag, "beryx", "event provider to use")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
+	cmd.Flags().String(internal.EventProviderFlag, types.EventProviderBeryx, "event provider to use (beryx, trace-index, lotus)")
 	cmd.Flags().String(internal.EventProviderTokenFlag, "", "event provider token")
+	cmd.Flags().Int64(internal.EventStartFlag, 0, "start height of the event provider range, required by lotus")
+	cmd.Flags().Int64(internal.EventEndFlag, 0, "end height of the event provider range, required by lotus")
+	cmd.Flags().Bool(internal.ActorEventsFlag, false, "also use actor event emitters in the lotus event provider")
 	return cmd
 }
 
@@ -35,6 +40,15 @@ func validateAddressBalance(cmd *cobra.Command) error {
 	config := api.GetGlobalConfigs()
 	log := initLogger()
 	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("could not get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
 
 	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
 	if err != nil {
@@ -59,6 +73,8 @@ func validateAddressBalance(cmd *cobra.Command) error {
 			log.Error("failed to close state database", zap.Error(err))
 		}
 	}()
+	addressCache, closeAddressCache := openAddressCache(ctx, dbPath, log)
+	defer closeAddressCache()
 
 	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
 	if err != nil {
@@ -75,9 +91,24 @@ func validateAddressBalance(cmd *cobra.Command) error {
 		log.Error("could not get event provider token", zap.Error(err), zap.String("event-provider-token", eventProviderToken))
 		return err
 	}
-	eventProvider, err := types.NewEventProvider(eventProviderName, eventProviderToken)
+	eventStart, err := cmd.Flags().GetInt64(internal.EventStartFlag)
 	if err != nil {
-		log.Error("could not create event provider", zap.Error(err), zap.String("event-provider", eventProviderName))
+		log.Error("could not get event start", zap.Error(err))
+		return err
+	}
+	eventEnd, err := cmd.Flags().GetInt64(internal.EventEndFlag)
+	if err != nil {
+		log.Error("could not get event end", zap.Error(err))
+		return err
+	}
+	actorEvents, err := cmd.Flags().GetBool(internal.ActorEventsFlag)
+	if err != nil {
+		log.Error("could not get actor events", zap.Error(err))
+		return err
+	}
+	noResume, err := cmd.Flags().GetBool(internal.NoResumeFlag)
+	if err != nil {
+		log.Error("could not get no resume", zap.Error(err))
 		return err
 	}
 
@@ -86,11 +117,31 @@ func validateAddressBalance(cmd *cobra.Command) error {
 		log.Error("could not read address file", zap.Error(err), zap.String("address-file", addressFile))
 		return err
 	}
-	rpcClient, err := api.NewFilecoinRPCClient(ctx, config.NodeURL, config.NodeToken)
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
 	if err != nil {
 		log.Error("could not create rpc client", zap.Error(err), zap.String("node-url", config.NodeURL))
 		return err
 	}
+	defer closeRPCClient(rpcClient)
+	eventProvider, err := types.NewEventProvider(eventProviderName, types.EventProviderOptions{
+		Token:       eventProviderToken,
+		Network:     network,
+		IndexPath:   dbPath,
+		Resolver:    equivalentAddressResolver(rpcClient),
+		RPCClient:   rpcClient,
+		Start:       eventStart,
+		End:         eventEnd,
+		ActorEvents: actorEvents,
+	})
+	if err != nil {
+		log.Error("could not create event provider", zap.Error(err), zap.String("event-provider", eventProviderName))
+		return err
+	}
+	defer func() {
+		if err := eventProvider.Close(); err != nil {
+			log.Error("failed to close event provider", zap.Error(err))
+		}
+	}()
 	dataStore, err := api.GetDataStoreClient(&config)
 	if err != nil {
 		log.Error("could not create data store client", zap.Error(err))
@@ -98,7 +149,7 @@ func validateAddressBalance(cmd *cobra.Command) error {
 	}
 
 	parser, err := fil_parser.NewFilecoinParserWithActorV2(
-		rpcClient.RosettaLib(), api.GetDataSource(&config, rpcClient),
+		rpcClient.RosettaLib(), api.GetDataSource(network, rpcClient),
 		getParserLogger(),
 	)
 
@@ -107,33 +158,51 @@ func validateAddressBalance(cmd *cobra.Command) error {
 		return err
 	}
 
+	// a bounded range starts from the chain state before any message at event-start is applied, the events before
+	// it are not validated
+	var startTipset *filTypes.TipSet
+	if eventStart > 0 {
+		startTipset, err = api.ChainGetTipSetByHeight(ctx, eventStart, rpcClient)
+		if err != nil {
+			log.Error("failed to get start tipset", zap.Error(err), zap.Int64("height", eventStart))
+			return err
+		}
+	}
+
 	for _, addr := range addresses {
 		log.Debug(fmt.Sprintf("Validating address balance for %s", addr))
 		parsedAddress, err := address.NewFromString(addr)
 		if err != nil {
 			log.Error("failed to parse provided address", zap.Error(err), zap.String("address", addr))
-			internal.UpdateProgressAddress(addr, 0, false, err.Error(), db)
-			continue
-		}
-		equivalentAddresses, err := internal.GetEquivalentAddresses(ctx, parsedAddress, rpcClient.FullNodeClient())
-		if err != nil {
-			log.Error("failed to get equivalent addresses", zap.Error(err), zap.String("address", addr))
-			internal.UpdateProgressAddress(addr, 0, false, err.Error(), db)
+			internal.FailProgressAddress(addr, 0, internal.FailureParse, err.Error(), db)
 			continue
 		}
 		heights, err := eventProvider.GetAddressEventHeights(ctx, addr)
 		if err != nil {
 			log.Error("failed to get address events", zap.Error(err), zap.String("address", addr))
-			internal.UpdateProgressAddress(addr, 0, false, err.Error(), db)
+			internal.FailProgressAddress(addr, 0, internal.FailureNode, err.Error(), db)
 			continue
 		}
 		processedHeights := map[int64]bool{}
 
 		// try load state
 		state := &types.AddressState{}
-		err = internal.GetProgressAddressState(addr, state, stateDB)
-		if err != nil {
-			log.Error("failed to get last state", zap.Error(err), zap.String("address", addr))
+		if !noResume {
+			err = internal.GetProgressAddressState(addr, state, stateDB)
+			if err != nil {
+				log.Error("failed to get last state", zap.Error(err), zap.String("address", addr))
+			}
+		}
+		if startTipset != nil && state.Height < eventStart {
+			if state.Height > 0 {
+				log.Info("address state before event start, loading balance from chain", zap.String("address", addr), zap.Int64("state-height", state.Height), zap.Int64("event-start", eventStart))
+			}
+			state, err = getAddressBalanceState(ctx, parsedAddress, eventStart-1, startTipset, rpcClient, addressCache)
+			if err != nil {
+				log.Error("failed to get onchain balance", zap.Error(err), zap.String("address", addr))
+				internal.FailProgressAddress(addr, 0, internal.FailureNode, err.Error(), db)
+				continue
+			}
 		}
 		if state.Height > 0 {
 			for _, height := range heights {
@@ -144,9 +213,8 @@ func validateAddressBalance(cmd *cobra.Command) error {
 		}
 
 		addrInfo := &Address{
-			ParsedAddress:       parsedAddress,
-			EquivalentAddresses: equivalentAddresses,
-			State:               state,
+			ParsedAddress: parsedAddress,
+			State:         state,
 		}
 		log.Debug("got address events", zap.Int("count", len(heights)), zap.String("address", addr))
 
@@ -159,25 +227,36 @@ func validateAddressBalance(cmd *cobra.Command) error {
 			data, err := api.GetTraceFromDataStore(height, dataStore, &config)
 			if err != nil {
 				log.Error("failed to get trace", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
-				continue
-			}
-			data, err = filterTrace(height, equivalentAddresses, data)
-			if err != nil {
-				log.Error("failed to filter trace", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureTrace, err.Error(), db)
 				continue
 			}
 			tipset, err := api.ChainGetTipSetByHeight(ctx, height, rpcClient)
 			if err != nil {
 				log.Error("failed to get tipset", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
 				continue
 			}
-			nextTipset, err := api.ChainGetTipSetByHeight(ctx, height+1, rpcClient)
+			nextTipset, err := api.ChainGetNextTipSet(ctx, tipset, rpcClient)
 			if err != nil {
 				log.Error("failed to get next tipset", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
+				continue
+			}
+			equivalentAddresses, err := equivalentAddressesAt(ctx, parsedAddress, tipset, nextTipset, rpcClient, addressCache)
+			if errors.Is(err, internal.ErrActorNotFound) {
+				log.Warn("actor does not exist at event height", zap.String("address", addr), zap.Int64("height", height))
+				continue
+			}
+			if err != nil {
+				log.Error("failed to get equivalent addresses", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
+				continue
+			}
+			addrInfo.EquivalentAddresses = equivalentAddresses
+			data, err = filterTrace(network, height, equivalentAddresses, data)
+			if err != nil {
+				log.Error("failed to filter trace", zap.Error(err), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureParse, err.Error(), db)
 				continue
 			}
 
@@ -187,13 +266,13 @@ func validateAddressBalance(cmd *cobra.Command) error {
 					TipSet: *tipset,
 				},
 			}
-			nodeInfo := api.HeightToNodeVersion(height)
+			nodeInfo := network.HeightToNodeVersion(height)
 			txsData.Metadata.NodeInfo = *nodeInfo
 
 			parsedTxData, err := parser.ParseTransactions(ctx, txsData)
 			if err != nil {
 				log.Error("failed to parse transactions", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureParse, err.Error(), db)
 				continue
 			}
 			if len(parsedTxData.Txs) == 0 {
@@ -201,7 +280,7 @@ func validateAddressBalance(cmd *cobra.Command) error {
 			}
 			if err := compareAddressBalance(ctx, height, addrInfo, nextTipset, parsedTxData, rpcClient); err != nil {
 				log.Error("failed to compare address balance", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureMismatch), err.Error(), db)
 			} else {
 				internal.UpdateProgressAddress(addr, height, true, internal.ProgressOK, db)
 			}
@@ -210,11 +289,27 @@ func validateAddressBalance(cmd *cobra.Command) error {
 			}
 			lastHeight = height
 		}
-		internal.UpdateProgressHeight(lastHeight, true, internal.ProgressOK, db)
+		internal.UpdateProgressHeightMarker(lastHeight, db)
 	}
 	return nil
 }
 
+// getAddressBalanceState returns the balance of addr in the state of tipset as received funds, at height. An actor
+// created later has no balance yet.
+func getAddressBalanceState(ctx context.Context, addr address.Address, height int64, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface, cache *internal.AddressCache) (*types.AddressState, error) {
+	state := &types.AddressState{Height: height, Received: big.NewInt(0), Sent: big.NewInt(0)}
+	exists, err := actorExistsAt(ctx, addr, tipset, rpcClient, cache)
+	if err != nil || !exists {
+		return state, err
+	}
+	actor, err := rpcClient.FullNodeClient().StateGetActor(ctx, addr, tipset.Key())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get onchain actor: %w", err)
+	}
+	state.Received = toBigInt(actor.Balance)
+	return state, nil
+}
+
 func compareAddressBalance(ctx context.Context, height int64, addr *Address, tipset *filTypes.TipSet, parsedTxData *parserTypes.TxsParsedResult, rpcClient api.RPCClientInterface) error {
 	applyAddressBalanceStateFromTransactions(height, addr.EquivalentAddresses, addr.State, parsedTxData.Txs)
 
@@ -235,7 +330,7 @@ func compareAddressBalance(ctx context.Context, height int64, addr *Address, tip
 	// check that onchain and parsed balance match
 	actor, err := rpcClient.FullNodeClient().StateReadState(ctx, addr.ParsedAddress, tipset.Key())
 	if err != nil {
-		return fmt.Errorf("failed to get onchain address balance: %w", err)
+		return internal.Failure(internal.FailureNode, fmt.Errorf("failed to get onchain address balance: %w", err))
 	}
 
 	if actor.Balance.Cmp(parsedBalance) != 0 {
@@ -4,9 +4,14 @@ import (
 	"math/big"
 	"testing"
 
+	address "github.com/filecoin-project/go-address"
+	lotusAPI "github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/internal/mocks"
 	types "github.com/zondax/fil-trace-check/internal/types"
 )
 
@@ -162,3 +167,25 @@ func TestApplyAddressBalanceStateFromTransactions(t *testing.T) {
 		})
 	}
 }
+
+func TestGetAddressBalanceState(t *testing.T) {
+	addr, err := address.NewActorAddress([]byte("account"))
+	require.NoError(t, err)
+	id, err := address.NewIDAddress(100)
+	require.NoError(t, err)
+	tipset := testTipSet(t, 100)
+
+	fullNodeMock := mocks.NewFullNode(t)
+	fullNodeMock.On("StateLookupID", mock.Anything, addr, tipset.Key()).Return(id, nil)
+	fullNodeMock.On("StateGetActor", mock.Anything, addr, tipset.Key()).Return(&filTypes.Actor{Balance: filTypes.NewInt(500)}, nil)
+	state, err := getAddressBalanceState(t.Context(), addr, 99, tipset, &MockRPCClient{client: fullNodeMock}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &types.AddressState{Height: 99, Received: big.NewInt(500), Sent: big.NewInt(0)}, state)
+
+	// an actor created after the start has no balance yet
+	fullNodeMock = mocks.NewFullNode(t)
+	fullNodeMock.On("StateLookupID", mock.Anything, addr, tipset.Key()).Return(address.Undef, &lotusAPI.ErrActorNotFound{})
+	state, err = getAddressBalanceState(t.Context(), addr, 99, tipset, &MockRPCClient{client: fullNodeMock}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &types.AddressState{Height: 99, Received: big.NewInt(0), Sent: big.NewInt(0)}, state)
+}
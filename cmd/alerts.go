@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zondax/fil-trace-check/api"
+	"go.uber.org/zap"
+)
+
+// alertsStopTimeout bounds sending the pending failures when a command ends
+const alertsStopTimeout = 30 * time.Second
+
+// AddAlerts posts validation failures to the alert sinks of the config while a command runs, it keeps the hooks
+// already set on root. The pending failures are sent from a deferred finalizer, so failed and interrupted commands
+// send them too.
+func AddAlerts(root *cobra.Command) {
+	preRunE := root.PersistentPreRunE
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if preRunE != nil {
+			if err := preRunE(cmd, args); err != nil {
+				return err
+			}
+		}
+		config := api.GetGlobalConfigs()
+		if len(config.AlertSinks) == 0 {
+			return nil
+		}
+		initLogger().Info("sending alerts", zap.Int("sinks", len(config.AlertSinks)), zap.Int("threshold", config.AlertThreshold))
+		api.StartAlerts(config.AlertSinks, config.AlertOptions())
+		cancelOnSignal(cmd)
+		return nil
+	}
+	cobra.OnFinalize(stopAlerts, exitIfInterrupted)
+}
+
+func stopAlerts() {
+	ctx, cancel := context.WithTimeout(context.Background(), alertsStopTimeout)
+	defer cancel()
+	api.StopAlerts(ctx)
+}
+
+// interruptSignal is the signal that cancelled the running command, if any
+var interruptSignal atomic.Value
+
+// cancelOnSignal replaces the close handler of the cli, which exits with success as soon as the process is
+// interrupted, with one that cancels the context of cmd, so it stops like it does on its own signal context and the
+// finalizers send the pending failures once it returns. A second signal exits at once, for commands that do not stop
+// on their context.
+func cancelOnSignal(cmd *cobra.Command) {
+	signal.Reset(os.Interrupt, syscall.SIGTERM)
+	ctx, cancel := context.WithCancel(cmd.Context())
+	cmd.SetContext(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log := initLogger()
+		sig := <-signals
+		interruptSignal.Store(sig)
+		log.Warn("interrupted, stopping the command, interrupt again to exit now", zap.String("signal", sig.String()))
+		cancel()
+		sig = <-signals
+		log.Warn("interrupted again, exiting without sending the pending alerts", zap.String("signal", sig.String()))
+		_ = log.Sync()
+		os.Exit(signalExitCode(sig))
+	}()
+}
+
+// exitIfInterrupted exits with the code of the signal that interrupted the command, so an interrupted run is not
+// reported as successful. It is the last finalizer, after the pending failures are sent.
+func exitIfInterrupted() {
+	if sig, ok := interruptSignal.Load().(os.Signal); ok {
+		os.Exit(signalExitCode(sig))
+	}
+}
+
+// signalExitCode is the exit code of a process terminated by sig, 130 for an interrupt and 143 for SIGTERM
+func signalExitCode(sig os.Signal) int {
+	if number, ok := sig.(syscall.Signal); ok {
+		return 128 + int(number)
+	}
+	return 1
+}
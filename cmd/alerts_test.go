@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelOnSignal(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.SetContext(t.Context())
+	cancelOnSignal(cmd)
+	t.Cleanup(func() { interruptSignal = atomic.Value{} })
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	select {
+	case <-cmd.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("command context not cancelled")
+	}
+	assert.Equal(t, syscall.SIGTERM, interruptSignal.Load())
+	assert.Equal(t, 143, signalExitCode(syscall.SIGTERM))
+	assert.Equal(t, 130, signalExitCode(os.Interrupt))
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"go.uber.org/zap"
+)
+
+const configCheckTimeout = 30 * time.Second
+
+// AddConfigFlags adds the flags selecting the config profile to every command, the config file path flag is
+// added by the cli
+func AddConfigFlags(root *cobra.Command) error {
+	root.PersistentFlags().String(internal.ProfileFlag, "", "config profile to apply over the top level config values")
+	return viper.BindPFlag(api.ProfileKey, root.PersistentFlags().Lookup(internal.ProfileFlag))
+}
+
+// RemoveCLICheckCmd removes the check command added by the cli, config check validates the config and also pings the
+// node and the trace source
+func RemoveCLICheckCmd(root *cobra.Command) {
+	for _, cmd := range root.Commands() {
+		if cmd.Name() == internal.ConfigCheckCommand {
+			root.RemoveCommand(cmd)
+		}
+	}
+}
+
+func ConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.ConfigCommand,
+		Short: "Configuration commands",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   internal.ConfigCheckCommand,
+		Short: "Load and validate the config, then ping the node and the trace source",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return checkConfig(cmd)
+		},
+	})
+	return cmd
+}
+
+func checkConfig(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx, cancel := context.WithTimeout(cmd.Context(), configCheckTimeout)
+	defer cancel()
+
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("could not get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
+	log.Info("config is valid", zap.String("network", network.Name), zap.String("trace-source", config.TraceSource))
+
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("could not connect to node", zap.Error(err), zap.String("node-url", config.NodeURL))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	head, err := rpcClient.FullNodeClient().ChainHead(ctx)
+	if err != nil {
+		log.Error("could not get chain head", zap.Error(err), zap.String("node-url", config.NodeURL))
+		return err
+	}
+	log.Info("node is reachable", zap.String("node-version", rpcClient.NodeInfo().NodeFullVersion), zap.Int64("head", int64(head.Height())))
+
+	dataStore, err := api.GetDataStoreClient(&config)
+	if err != nil {
+		log.Error("could not create data store client", zap.Error(err))
+		return err
+	}
+	trace, err := api.GetFirstTraceName(ctx, dataStore, &config)
+	if err != nil {
+		log.Error("could not list traces", zap.Error(err), zap.String("bucket", config.S3Bucket), zap.String("path", config.S3RawDataPath))
+		return err
+	}
+	if trace == "" {
+		err := fmt.Errorf("no traces found in %s/%s", config.S3Bucket, config.S3RawDataPath)
+		log.Error("trace source is empty", zap.Error(err))
+		return err
+	}
+	log.Info("trace source is reachable", zap.String("first-trace", trace))
+	return nil
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/spf13/cobra"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	types "github.com/zondax/fil-trace-check/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	missingFromTracesMessage   = "reported by event provider but not found in traces"
+	missingFromProviderMessage = "found in traces but not reported by event provider"
+)
+
+func ValidateEventCoverageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.EventCoverageCheck,
+		Short: "Compare event provider heights with the heights addresses appear at in traces",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return validateEventCoverage(cmd)
+		},
+	}
+	cmd.Flags().String(internal.AddressFileFlag, "", "path to a newline separated address file for addresses to check")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	cmd.Flags().Int64(internal.StartFlag, 0, "start height to compare")
+	cmd.Flags().Int64(internal.EndFlag, 0, "end height to compare")
+	cmd.Flags().String(internal.EventProviderFlag, types.EventProviderBeryx, "event provider to use (beryx, trace-index, lotus)")
+	cmd.Flags().String(internal.EventProviderTokenFlag, "", "event provider token")
+	cmd.Flags().Bool(internal.ActorEventsFlag, false, "also use actor event emitters in the lotus event provider")
+	return cmd
+}
+
+type EventCoverageAddress struct {
+	ProviderHeights []int64
+	TraceHeights    []int64
+}
+
+func validateEventCoverage(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("could not get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
+
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("could not get db path", zap.Error(err))
+		return err
+	}
+	db, err := api.NewDB(dbPath, internal.EventCoverageCheck)
+	if err != nil {
+		log.Error("could not create db", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error("failed to close database", zap.Error(err))
+		}
+	}()
+	addressCache, closeAddressCache := openAddressCache(ctx, dbPath, log)
+	defer closeAddressCache()
+
+	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
+	if err != nil {
+		log.Error("could not get address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+	start, err := cmd.Flags().GetInt64(internal.StartFlag)
+	if err != nil {
+		log.Error("could not get start height", zap.Error(err))
+		return err
+	}
+	end, err := cmd.Flags().GetInt64(internal.EndFlag)
+	if err != nil {
+		log.Error("could not get end height", zap.Error(err))
+		return err
+	}
+	if start <= 0 || end < start {
+		log.Error("invalid height range", zap.Int64("start-height", start), zap.Int64("end-height", end))
+		return errors.New("start height must be positive and not greater than end height")
+	}
+	eventProviderName, err := cmd.Flags().GetString(internal.EventProviderFlag)
+	if err != nil {
+		log.Error("could not get event provider", zap.Error(err), zap.String("event-provider", eventProviderName))
+		return err
+	}
+	eventProviderToken, err := cmd.Flags().GetString(internal.EventProviderTokenFlag)
+	if err != nil {
+		log.Error("could not get event provider token", zap.Error(err))
+		return err
+	}
+	actorEvents, err := cmd.Flags().GetBool(internal.ActorEventsFlag)
+	if err != nil {
+		log.Error("could not get actor events", zap.Error(err))
+		return err
+	}
+
+	addresses, err := internal.ReadAddressFile(addressFile)
+	if err != nil {
+		log.Error("could not read address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("could not create rpc client", zap.Error(err), zap.String("node-url", config.NodeURL))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	eventProvider, err := types.NewEventProvider(eventProviderName, types.EventProviderOptions{
+		Token:       eventProviderToken,
+		Network:     network,
+		IndexPath:   dbPath,
+		Resolver:    equivalentAddressResolver(rpcClient),
+		Start:       start,
+		End:         end,
+		RPCClient:   rpcClient,
+		ActorEvents: actorEvents,
+	})
+	if err != nil {
+		log.Error("could not create event provider", zap.Error(err), zap.String("event-provider", eventProviderName))
+		return err
+	}
+	defer func() {
+		if err := eventProvider.Close(); err != nil {
+			log.Error("failed to close event provider", zap.Error(err))
+		}
+	}()
+	dataStore, err := api.GetDataStoreClient(&config)
+	if err != nil {
+		log.Error("could not create data store client", zap.Error(err))
+		return err
+	}
+
+	coverage := map[string]*EventCoverageAddress{}
+	parsedAddresses := map[string]address.Address{}
+	for _, addr := range addresses {
+		parsedAddress, err := address.NewFromString(addr)
+		if err != nil {
+			log.Error("failed to parse provided address", zap.Error(err), zap.String("address", addr))
+			internal.FailProgressAddress(addr, 0, internal.FailureParse, err.Error(), db)
+			continue
+		}
+		heights, err := eventProvider.GetAddressEventHeights(ctx, addr)
+		if err != nil {
+			log.Error("failed to get address events", zap.Error(err), zap.String("address", addr))
+			internal.FailProgressAddress(addr, 0, internal.FailureNode, err.Error(), db)
+			continue
+		}
+		coverage[addr] = &EventCoverageAddress{
+			ProviderHeights: heights,
+		}
+		parsedAddresses[addr] = parsedAddress
+	}
+
+	// every trace is scanned once for all the addresses
+	failedHeights := map[int64]bool{}
+	for i := start; i <= end; i++ {
+		log.Debug(fmt.Sprintf("Scanning traces for height %d", i))
+
+		data, err := api.GetTraceFromDataStore(i, dataStore, &config)
+		if err != nil {
+			log.Error("failed to get trace", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureTrace, err.Error(), db)
+			failedHeights[i] = true
+			continue
+		}
+		traceAddressList, err := traceAddresses(network, i, data)
+		if err != nil {
+			log.Error("failed to get trace addresses", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureParse, err.Error(), db)
+			failedHeights[i] = true
+			continue
+		}
+		if len(traceAddressList) == 0 {
+			continue
+		}
+		// the addresses are matched by their equivalences at this height
+		tipset, err := api.ChainGetTipSetByHeight(ctx, i, rpcClient)
+		if err != nil {
+			log.Error("failed to get tipset", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureNode, err.Error(), db)
+			failedHeights[i] = true
+			continue
+		}
+		nextTipset, err := api.ChainGetNextTipSet(ctx, tipset, rpcClient)
+		if err != nil {
+			log.Error("failed to get next tipset", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureNode, err.Error(), db)
+			failedHeights[i] = true
+			continue
+		}
+		equivalentAddresses, _, err := heightEquivalentAddresses(ctx, parsedAddresses, tipset, nextTipset, rpcClient, addressCache)
+		if err != nil {
+			log.Error("failed to get equivalent addresses", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureNode, err.Error(), db)
+			failedHeights[i] = true
+			continue
+		}
+		for addr, account := range coverage {
+			if slices.ContainsFunc(traceAddressList, func(traceAddress string) bool { return equivalentAddresses[addr][traceAddress] }) {
+				account.TraceHeights = append(account.TraceHeights, i)
+			}
+		}
+	}
+
+	for addr, account := range coverage {
+		// heights whose trace could not be read can't be compared
+		providerHeights := slices.DeleteFunc(slices.Clone(account.ProviderHeights), func(height int64) bool {
+			return height < start || height > end || failedHeights[height]
+		})
+		missingFromTraces, missingFromProvider := compareEventCoverage(providerHeights, account.TraceHeights)
+		for _, height := range missingFromTraces {
+			internal.FailProgressAddress(addr, height, internal.FailureMismatch, missingFromTracesMessage, db)
+		}
+		for _, height := range missingFromProvider {
+			internal.FailProgressAddress(addr, height, internal.FailureMismatch, missingFromProviderMessage, db)
+		}
+		if len(missingFromTraces)+len(missingFromProvider) > 0 {
+			log.Error("event coverage mismatch", zap.String("address", addr),
+				zap.Int64s("missing-from-traces", missingFromTraces), zap.Int64s("missing-from-provider", missingFromProvider))
+			continue
+		}
+		internal.UpdateProgressAddress(addr, 0, true, internal.ProgressOK, db)
+	}
+	return nil
+}
+
+// compareEventCoverage returns the sorted heights only reported by the provider and only found in the traces
+func compareEventCoverage(providerHeights, traceHeights []int64) ([]int64, []int64) {
+	provider := map[int64]bool{}
+	for _, height := range providerHeights {
+		provider[height] = true
+	}
+	traces := map[int64]bool{}
+	for _, height := range traceHeights {
+		traces[height] = true
+	}
+
+	missingFromTraces := []int64{}
+	for height := range provider {
+		if !traces[height] {
+			missingFromTraces = append(missingFromTraces, height)
+		}
+	}
+	missingFromProvider := []int64{}
+	for height := range traces {
+		if !provider[height] {
+			missingFromProvider = append(missingFromProvider, height)
+		}
+	}
+	slices.Sort(missingFromTraces)
+	slices.Sort(missingFromProvider)
+	return missingFromTraces, missingFromProvider
+}
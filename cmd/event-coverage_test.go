@@ -0,0 +1,17 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareEventCoverage(t *testing.T) {
+	missingFromTraces, missingFromProvider := compareEventCoverage([]int64{10, 20, 20, 30}, []int64{30, 10, 40})
+	assert.Equal(t, []int64{20}, missingFromTraces)
+	assert.Equal(t, []int64{40}, missingFromProvider)
+
+	missingFromTraces, missingFromProvider = compareEventCoverage([]int64{10}, []int64{10})
+	assert.Empty(t, missingFromTraces)
+	assert.Empty(t, missingFromProvider)
+}
@@ -0,0 +1,505 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/lotus/chain/actors/builtin"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/ethtypes"
+	"github.com/spf13/cobra"
+	fil_parser "github.com/zondax/fil-parser"
+	"github.com/zondax/fil-parser/parser"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	types "github.com/zondax/fil-trace-check/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	eamActorAddr = "f010"
+)
+
+func ValidateEvmAccountsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.EvmAccountsCheck,
+		Short: "Validate EVM Accounts Sequentially from start=1 (unless defined) to end",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return validateEvmAccounts(cmd)
+		},
+	}
+	cmd.Flags().String(internal.AddressFileFlag, "", "path to a newline separated address file for 0x/f4 addresses to check")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
+	cmd.Flags().Int64(internal.StartFlag, 1, "optional start height to validate")
+	cmd.Flags().Int64(internal.EndFlag, 0, "end height to validate")
+	return cmd
+}
+
+type EvmAccount struct {
+	Address             string
+	EquivalentAddresses map[string]bool
+	State               *types.EvmAccountState
+	ParsedAddress       address.Address
+	EthAddress          ethtypes.EthAddress
+	// Resync reloads the state from chain at the next height, the transactions of a skipped height are missing from State
+	Resync bool
+}
+
+// resyncAccounts reloads the state of every account at the next height, after a height that could not be processed
+func resyncAccounts(accountMap map[string]*EvmAccount) {
+	for _, account := range accountMap {
+		account.Resync = true
+	}
+}
+
+func validateEvmAccounts(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("could not get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
+
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("could not get db path", zap.Error(err))
+		return err
+	}
+	db, err := api.NewDB(dbPath, internal.EvmAccountsCheck)
+	if err != nil {
+		log.Error("could not create db", zap.Error(err))
+		return err
+	}
+	stateDB, err := api.NewDB(dbPath, internal.EvmAccountsCheck+".state")
+	if err != nil {
+		log.Error("could not create state db", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error("failed to close database", zap.Error(err))
+		}
+		if err := stateDB.Close(); err != nil {
+			log.Error("failed to close state database", zap.Error(err))
+		}
+	}()
+	addressCache, closeAddressCache := openAddressCache(ctx, dbPath, log)
+	defer closeAddressCache()
+
+	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
+	if err != nil {
+		log.Error("could not get address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+	addresses, err := internal.ReadAddressFile(addressFile)
+	if err != nil {
+		log.Error("could not read address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+
+	start := int64(1)
+	if cmd.Flags().Changed(internal.StartFlag) {
+		startHeight, err := cmd.Flags().GetInt64(internal.StartFlag)
+		if err != nil {
+			log.Error("could not get start height", zap.Error(err), zap.Int64("start-height", startHeight))
+			return err
+		}
+		start = startHeight
+	}
+	endHeight, err := cmd.Flags().GetInt64(internal.EndFlag)
+	if err != nil {
+		log.Error("could not get end height", zap.Error(err), zap.Int64("end-height", endHeight))
+		return err
+	}
+	if endHeight < start {
+		log.Error("end height is less than start height", zap.Int64("start-height", start), zap.Int64("end-height", endHeight))
+		return errors.New("end height is less than start height")
+	}
+
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("could not create rpc client", zap.Error(err), zap.String("node-url", config.NodeURL))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	dataStore, err := api.GetDataStoreClient(&config)
+	if err != nil {
+		log.Error("could not create data store client", zap.Error(err))
+		return err
+	}
+
+	parser, err := fil_parser.NewFilecoinParserWithActorV2(
+		rpcClient.RosettaLib(), api.GetDataSource(network, rpcClient),
+		getParserLogger(),
+	)
+	if err != nil {
+		log.Error("failed to create parser", zap.Error(err))
+		return err
+	}
+
+	latestHeight, err := resumeHeight(cmd, db)
+	if err != nil {
+		log.Error("failed to get latest height", zap.Error(err))
+		return err
+	}
+	if latestHeight < endHeight && latestHeight > start {
+		log.Info("resuming from latest height", zap.Int64("latest-height", latestHeight))
+		start = latestHeight + 1
+	}
+
+	// account state before any message at start is applied
+	startTipset, err := api.ChainGetTipSetByHeight(ctx, start, rpcClient)
+	if err != nil {
+		log.Error("failed to get start tipset", zap.Error(err), zap.Int64("height", start))
+		return err
+	}
+	prevTipset, err := api.ChainGetTipSetByHeight(ctx, start-1, rpcClient)
+	if err != nil {
+		log.Error("failed to get previous tipset", zap.Error(err), zap.Int64("height", start-1))
+		return err
+	}
+
+	accountMap := map[string]*EvmAccount{}
+	parsedAddresses := map[string]address.Address{}
+	for _, addr := range addresses {
+		parsedAddress, ethAddress, err := parseEvmAddress(addr)
+		if err != nil {
+			log.Error("failed to parse provided address", zap.Error(err), zap.String("address", addr))
+			internal.FailProgressAddress(addr, 0, internal.FailureParse, err.Error(), db)
+			return err
+		}
+		parsedAddresses[addr] = parsedAddress
+		account := &EvmAccount{
+			Address:       addr,
+			State:         &types.EvmAccountState{},
+			ParsedAddress: parsedAddress,
+			EthAddress:    ethAddress,
+		}
+		if err := internal.GetProgressAddressState(addr, account.State, stateDB); err != nil {
+			log.Error("failed to get last state", zap.Error(err), zap.String("address", addr))
+			return err
+		}
+		if account.State.Height != start-1 {
+			if account.State.Height > 0 {
+				log.Info("account state not at resume height, loading state from chain", zap.String("address", addr), zap.Int64("state-height", account.State.Height), zap.Int64("start-height", start))
+			}
+			account.State, err = getEvmAccountState(ctx, account, start-1, prevTipset, startTipset, rpcClient)
+			if err != nil {
+				log.Error("failed to get onchain account state", zap.Error(err), zap.String("address", addr))
+				return err
+			}
+		}
+		accountMap[addr] = account
+	}
+
+	for height := start; height <= endHeight; height++ {
+		log.Info("processing height", zap.Int64("height", height))
+		data, err := api.GetTraceFromDataStore(height, dataStore, &config)
+		if err != nil {
+			log.Error("failed to get trace", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureTrace, err.Error(), db)
+			resyncAccounts(accountMap)
+			continue
+		}
+		// traces are not filtered: failed messages still consume a nonce and contract creations
+		// only reference the created address in their return
+		tipset, err := api.ChainGetTipSetByHeight(ctx, height, rpcClient)
+		if err != nil {
+			log.Error("failed to get tipset", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			resyncAccounts(accountMap)
+			continue
+		}
+		// on-chain state is applied on the next tipset
+		nextTipset, err := api.ChainGetNextTipSet(ctx, tipset, rpcClient)
+		if err != nil {
+			log.Error("failed to get next tipset", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			resyncAccounts(accountMap)
+			continue
+		}
+		equivalentAddresses, _, err := heightEquivalentAddresses(ctx, parsedAddresses, tipset, nextTipset, rpcClient, addressCache)
+		if err != nil {
+			log.Error("failed to get equivalent addresses", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			resyncAccounts(accountMap)
+			continue
+		}
+
+		txsData := parserTypes.TxsData{
+			Traces: data,
+			Tipset: &parserTypes.ExtendedTipSet{
+				TipSet: *tipset,
+			},
+		}
+		nodeInfo := network.HeightToNodeVersion(height)
+		txsData.Metadata.NodeInfo = *nodeInfo
+
+		parsedTxData, err := parser.ParseTransactions(ctx, txsData)
+		if err != nil {
+			log.Error("failed to parse transactions", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureParse, err.Error(), db)
+			resyncAccounts(accountMap)
+			continue
+		}
+
+		for _, addr := range addresses {
+			if equivalentAddresses[addr] == nil {
+				log.Debug("actor does not exist at height", zap.String("address", addr), zap.Int64("height", height))
+				continue
+			}
+			account := accountMap[addr]
+			account.EquivalentAddresses = equivalentAddresses[addr]
+			if account.Resync {
+				state, err := getEvmAccountStateBefore(ctx, account, height, tipset, rpcClient)
+				if err != nil {
+					log.Error("failed to reload onchain account state", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+					internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
+					continue
+				}
+				log.Info("reloaded account state from chain after a skipped height", zap.String("address", addr), zap.Int64("height", height))
+				account.State = state
+				account.Resync = false
+			}
+			active, err := applyEvmAccountFromTransactions(account.EquivalentAddresses, account.State, parsedTxData.Txs)
+			if err != nil {
+				log.Error("failed to apply evm account transactions", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureParse), err.Error(), db)
+				account.Resync = true
+			}
+			account.State.Height = height
+			// accounts are checked at every epoch with activity and always at the end of the range
+			if err == nil && (active || height == endHeight) {
+				log.Info("processing address", zap.String("address", addr), zap.Int64("height", height))
+				if err := compareEvmAccount(ctx, account, tipset, nextTipset, rpcClient); err != nil {
+					log.Error("evm account check failed", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+					internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureMismatch), err.Error(), db)
+				} else {
+					internal.UpdateProgressAddress(addr, height, true, internal.ProgressOK, db)
+				}
+			}
+			// a state missing transactions is not saved, a resumed run reloads it from chain
+			if account.Resync {
+				continue
+			}
+			if err := internal.UpdateProgressAddressState(addr, account.State, stateDB); err != nil {
+				log.Error("failed to update state", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+			}
+		}
+		internal.UpdateProgressHeight(height, true, internal.ProgressOK, db)
+	}
+	return nil
+}
+
+// parseEvmAddress accepts 0x addresses as well as filecoin (f4/f0) addresses
+func parseEvmAddress(addr string) (address.Address, ethtypes.EthAddress, error) {
+	if strings.HasPrefix(addr, parser.EthPrefix) {
+		ethAddress, err := ethtypes.ParseEthAddress(addr)
+		if err != nil {
+			return address.Undef, ethtypes.EthAddress{}, err
+		}
+		parsedAddress, err := ethAddress.ToFilecoinAddress()
+		if err != nil {
+			return address.Undef, ethtypes.EthAddress{}, err
+		}
+		return parsedAddress, ethAddress, nil
+	}
+	parsedAddress, err := address.NewFromString(addr)
+	if err != nil {
+		return address.Undef, ethtypes.EthAddress{}, err
+	}
+	ethAddress, err := ethtypes.EthAddressFromFilecoinAddress(parsedAddress)
+	if err != nil {
+		return address.Undef, ethtypes.EthAddress{}, fmt.Errorf("address %s has no eth equivalent: %w", addr, err)
+	}
+	return parsedAddress, ethAddress, nil
+}
+
+// ethBlockParam references the state after the messages of tipset are executed
+func ethBlockParam(tipset *filTypes.TipSet) (ethtypes.EthBlockNumberOrHash, error) {
+	tipsetCid, err := tipset.Key().Cid()
+	if err != nil {
+		return ethtypes.EthBlockNumberOrHash{}, err
+	}
+	blockHash, err := ethtypes.EthHashFromCid(tipsetCid)
+	if err != nil {
+		return ethtypes.EthBlockNumberOrHash{}, err
+	}
+	return ethtypes.EthBlockNumberOrHash{BlockHash: &blockHash}, nil
+}
+
+func getOnchainActor(ctx context.Context, addr address.Address, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) (*filTypes.Actor, error) {
+	actor, err := rpcClient.FullNodeClient().StateGetActor(ctx, addr, tipset.Key())
+	if err != nil {
+		// the address may not be created yet
+		if internal.IsActorNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get onchain actor: %w", err)
+	}
+	return actor, nil
+}
+
+func getEvmAccountState(ctx context.Context, account *EvmAccount, height int64, tipset, nextTipset *filTypes.TipSet, rpcClient api.RPCClientInterface) (*types.EvmAccountState, error) {
+	blockParam, err := ethBlockParam(tipset)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := rpcClient.FullNodeClient().EthGetTransactionCount(ctx, account.EthAddress, blockParam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get onchain nonce: %w", err)
+	}
+	code, err := rpcClient.FullNodeClient().EthGetCode(ctx, account.EthAddress, blockParam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get onchain bytecode: %w", err)
+	}
+	actor, err := getOnchainActor(ctx, account.ParsedAddress, nextTipset, rpcClient)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &types.EvmAccountState{
+		Height:   height,
+		Nonce:    uint64(nonce),
+		Balance:  big.NewInt(0),
+		CodeHash: codeHash(code),
+	}
+	if actor != nil {
+		state.Balance = toBigInt(actor.Balance)
+		state.IsContract = builtin.IsEvmActor(actor.Code)
+	}
+	return state, nil
+}
+
+// getEvmAccountStateBefore returns the state of the account before any message of tipset, at height, is applied
+func getEvmAccountStateBefore(ctx context.Context, account *EvmAccount, height int64, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) (*types.EvmAccountState, error) {
+	parentTipset, err := rpcClient.FullNodeClient().ChainGetTipSet(ctx, tipset.Parents())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parent tipset: %w", err)
+	}
+	return getEvmAccountState(ctx, account, height-1, parentTipset, tipset, rpcClient)
+}
+
+// compareEvmAccount compares the account accumulated from the traces with the chain and syncs it on a mismatch, so
+// every mismatch is only reported once
+func compareEvmAccount(ctx context.Context, account *EvmAccount, tipset, nextTipset *filTypes.TipSet, rpcClient api.RPCClientInterface) error {
+	onchain, err := getEvmAccountState(ctx, account, account.State.Height, tipset, nextTipset, rpcClient)
+	if err != nil {
+		return internal.Failure(internal.FailureNode, err)
+	}
+
+	state := account.State
+	mismatches := []string{}
+	if onchain.Nonce != state.Nonce {
+		mismatches = append(mismatches, fmt.Sprintf("nonce onchain=%d, parsed=%d", onchain.Nonce, state.Nonce))
+	}
+	if onchain.IsContract != state.IsContract {
+		mismatches = append(mismatches, fmt.Sprintf("contract onchain=%t, parsed=%t", onchain.IsContract, state.IsContract))
+	}
+	balance := big.NewInt(0)
+	if state.Balance != nil {
+		balance = state.Balance
+	}
+	if onchain.Balance.Cmp(balance) != 0 {
+		mismatches = append(mismatches, fmt.Sprintf("balance onchain=%s, parsed=%s", onchain.Balance, balance))
+	}
+
+	// bytecode is not part of the traces, the first one seen for a contract is kept and must never change
+	switch {
+	case !state.IsContract && onchain.CodeHash != "":
+		mismatches = append(mismatches, "unexpected bytecode for a non contract address")
+	case state.IsContract && onchain.CodeHash == "":
+		mismatches = append(mismatches, "missing bytecode for a contract address")
+	case state.IsContract && state.CodeHash == "":
+		state.CodeHash = onchain.CodeHash
+	case state.IsContract && state.CodeHash != onchain.CodeHash:
+		mismatches = append(mismatches, fmt.Sprintf("bytecode hash onchain=%s, parsed=%s", onchain.CodeHash, state.CodeHash))
+	}
+
+	if len(mismatches) > 0 {
+		account.State = onchain
+		return fmt.Errorf("evm account mismatch for %s: %s", account.Address, strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// applyEvmAccountFromTransactions returns true if any of the transactions touch the account
+func applyEvmAccountFromTransactions(equivalentAddresses map[string]bool, accountState *types.EvmAccountState, txs []*parserTypes.Transaction) (bool, error) {
+	active := false
+	if accountState.Balance == nil {
+		accountState.Balance = big.NewInt(0)
+	}
+	for _, tx := range txs {
+		if !equivalentAddresses[tx.TxFrom] && !equivalentAddresses[tx.TxTo] && tx.TxTo != eamActorAddr {
+			continue
+		}
+
+		// contract creations are matched on the created address
+		if tx.TxTo == eamActorAddr && isEamCreate(tx.TxType) && tx.Status == "Ok" && tx.SubcallStatus == "Ok" {
+			metadata := types.EamCreateMetadata{}
+			if err := json.Unmarshal([]byte(tx.TxMetadata), &metadata); err != nil {
+				return active, fmt.Errorf("failed to parse %s metadata: %w", tx.TxType, err)
+			}
+			created := metadata.Return
+			if equivalentAddresses[fmt.Sprintf("%s%d", parser.FilPrefix, created.ActorId)] || equivalentAddresses[created.RobustAddress] {
+				accountState.IsContract = true
+				accountState.CodeHash = ""
+				active = true
+			}
+		}
+		if !equivalentAddresses[tx.TxFrom] && !equivalentAddresses[tx.TxTo] {
+			continue
+		}
+		active = true
+
+		if equivalentAddresses[tx.TxFrom] {
+			switch {
+			// every message sent by an account consumes a nonce, even if it fails
+			case !accountState.IsContract && tx.Level == 0 && tx.TxType != parser.TotalFeeOp:
+				accountState.Nonce++
+			// contracts only consume a nonce when creating other contracts, the nonce is kept if the creation subcall
+			// fails but reverted with the rest of the state if the message fails
+			case accountState.IsContract && tx.TxTo == eamActorAddr && (tx.TxType == parser.MethodCreate || tx.TxType == parser.MethodCreate2) && tx.Status == "Ok":
+				accountState.Nonce++
+			}
+		}
+
+		if tx.Status != "Ok" || tx.SubcallStatus != "Ok" || tx.Amount == nil {
+			continue
+		}
+		if equivalentAddresses[tx.TxTo] {
+			accountState.Balance.Add(accountState.Balance, tx.Amount)
+		}
+		if equivalentAddresses[tx.TxFrom] {
+			accountState.Balance.Sub(accountState.Balance, tx.Amount)
+		}
+	}
+	return active, nil
+}
+
+func isEamCreate(txType string) bool {
+	return txType == parser.MethodCreate || txType == parser.MethodCreate2 || txType == parser.MethodCreateExternal
+}
+
+func codeHash(code ethtypes.EthBytes) string {
+	if len(code) == 0 {
+		return ""
+	}
+	hash := sha256.Sum256(code)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"math/big"
+	"testing"
+
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/filecoin-project/lotus/chain/types/ethtypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+	types "github.com/zondax/fil-trace-check/internal/types"
+)
+
+func TestApplyEvmAccountFromTransactions(t *testing.T) {
+	equivalentAddresses := map[string]bool{
+		"f01234": true,
+		"f410fkkld55ioe7qg24wvt7fu6pbknb56ht7pt4zamxa": true,
+	}
+	tests := []struct {
+		name             string
+		initialState     types.EvmAccountState
+		txs              []*parserTypes.Transaction
+		expectedActive   bool
+		expectedNonce    uint64
+		expectedBalance  *big.Int
+		expectedContract bool
+	}{
+		{
+			name:         "account messages consume nonce even if they fail",
+			initialState: types.EvmAccountState{Nonce: 3, Balance: big.NewInt(1000)},
+			txs: []*parserTypes.Transaction{
+				{Level: 0, TxFrom: "f01234", TxTo: "f05678", TxType: "InvokeContract", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(100)},
+				{Level: 0, TxFrom: "f01234", TxTo: "f099", TxType: "Fee", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(10)},
+				{Level: 0, TxFrom: "f01234", TxTo: "f05678", TxType: "InvokeContract", Status: "Error", SubcallStatus: "Error", Amount: big.NewInt(100)},
+				{Level: 0, TxFrom: "f01234", TxTo: "f099", TxType: "Fee", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(10)},
+				{Level: 1, TxFrom: "f05678", TxTo: "f01234", TxType: "Send", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(5)},
+			},
+			expectedActive:  true,
+			expectedNonce:   5,
+			expectedBalance: big.NewInt(885),
+		},
+		{
+			name:         "contract creation for the address",
+			initialState: types.EvmAccountState{Balance: big.NewInt(0)},
+			txs: []*parserTypes.Transaction{
+				{Level: 0, TxFrom: "f05678", TxTo: eamActorAddr, TxType: "CreateExternal", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(50),
+					TxMetadata: `{"Params":"0x00","Return":{"ActorId":1234,"RobustAddress":"f2abc","EthAddress":"0x52963ef50e27e06d72d59fcb4f3c2a687be3cfef"}}`},
+				{Level: 1, TxFrom: eamActorAddr, TxTo: "f01", TxType: "Exec4", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(50)},
+				{Level: 2, TxFrom: "f01", TxTo: "f01234", TxType: "Constructor", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(50)},
+			},
+			expectedActive:   true,
+			expectedNonce:    0,
+			expectedBalance:  big.NewInt(50),
+			expectedContract: true,
+		},
+		{
+			name:         "contracts consume nonce only when creating contracts, even if the creation fails",
+			initialState: types.EvmAccountState{Nonce: 1, Balance: big.NewInt(100), IsContract: true, CodeHash: "abc"},
+			txs: []*parserTypes.Transaction{
+				{Level: 0, TxFrom: "f05678", TxTo: "f01234", TxType: "InvokeContract", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(0)},
+				{Level: 1, TxFrom: "f01234", TxTo: eamActorAddr, TxType: "Create2", Status: "Ok", SubcallStatus: "Error", Amount: big.NewInt(10),
+					TxMetadata: `{"Params":{}}`},
+				{Level: 1, TxFrom: "f01234", TxTo: "f09999", TxType: "InvokeContract", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(20)},
+			},
+			expectedActive:   true,
+			expectedNonce:    2,
+			expectedBalance:  big.NewInt(80),
+			expectedContract: true,
+		},
+		{
+			name:         "failed messages revert the nonce of contract creations",
+			initialState: types.EvmAccountState{Nonce: 1, Balance: big.NewInt(100), IsContract: true, CodeHash: "abc"},
+			txs: []*parserTypes.Transaction{
+				{Level: 0, TxFrom: "f05678", TxTo: "f01234", TxType: "InvokeContract", Status: "Error", SubcallStatus: "Error", Amount: big.NewInt(0)},
+				{Level: 1, TxFrom: "f01234", TxTo: eamActorAddr, TxType: "Create", Status: "Error", SubcallStatus: "Error", Amount: big.NewInt(10),
+					TxMetadata: `{"Params":{}}`},
+			},
+			expectedActive:   true,
+			expectedNonce:    1,
+			expectedBalance:  big.NewInt(100),
+			expectedContract: true,
+		},
+		{
+			name:         "unrelated transactions are ignored",
+			initialState: types.EvmAccountState{Nonce: 1, Balance: big.NewInt(100)},
+			txs: []*parserTypes.Transaction{
+				{Level: 0, TxFrom: "f05678", TxTo: "f09999", TxType: "Send", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(10)},
+				{Level: 0, TxFrom: "f05678", TxTo: eamActorAddr, TxType: "CreateExternal", Status: "Ok", SubcallStatus: "Ok", Amount: big.NewInt(0),
+					TxMetadata: `{"Return":{"ActorId":4321,"RobustAddress":"f2def","EthAddress":"0x0000000000000000000000000000000000000001"}}`},
+			},
+			expectedActive:  false,
+			expectedNonce:   1,
+			expectedBalance: big.NewInt(100),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := tt.initialState
+			state.Balance = new(big.Int).Set(tt.initialState.Balance)
+
+			active, err := applyEvmAccountFromTransactions(equivalentAddresses, &state, tt.txs)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedActive, active)
+			assert.Equal(t, tt.expectedNonce, state.Nonce)
+			assert.Equal(t, tt.expectedContract, state.IsContract)
+			assert.Equal(t, 0, tt.expectedBalance.Cmp(state.Balance), "balance: expected %s, got %s", tt.expectedBalance, state.Balance)
+		})
+	}
+}
+
+func TestParseEvmAddress(t *testing.T) {
+	parsedAddress, ethAddress, err := parseEvmAddress("0x52963ef50e27e06d72d59fcb4f3c2a687be3cfef")
+	require.NoError(t, err)
+	assert.Equal(t, "f410fkkld55ioe7qg24wvt7fu6pbknb56ht7pt4zamxa", parsedAddress.String())
+	assert.Equal(t, "0x52963ef50e27e06d72d59fcb4f3c2a687be3cfef", ethAddress.String())
+
+	parsedAddress, ethAddress, err = parseEvmAddress("f410fkkld55ioe7qg24wvt7fu6pbknb56ht7pt4zamxa")
+	require.NoError(t, err)
+	assert.Equal(t, "f410fkkld55ioe7qg24wvt7fu6pbknb56ht7pt4zamxa", parsedAddress.String())
+	assert.Equal(t, "0x52963ef50e27e06d72d59fcb4f3c2a687be3cfef", ethAddress.String())
+
+	_, _, err = parseEvmAddress("f1abjxfbp274xpdqcpuaykwkfb43omjotacm2p3za")
+	assert.Error(t, err)
+}
+
+func TestCompareEvmAccount(t *testing.T) {
+	parsedAddress, ethAddress, err := parseEvmAddress("0x52963ef50e27e06d72d59fcb4f3c2a687be3cfef")
+	require.NoError(t, err)
+	tipset, nextTipset := testTipSet(t, 100), testTipSet(t, 101)
+	fullNodeMock := mocks.NewFullNode(t)
+	fullNodeMock.On("EthGetTransactionCount", mock.Anything, ethAddress, mock.Anything).Return(ethtypes.EthUint64(5), nil)
+	fullNodeMock.On("EthGetCode", mock.Anything, ethAddress, mock.Anything).Return(ethtypes.EthBytes{}, nil)
+	fullNodeMock.On("StateGetActor", mock.Anything, parsedAddress, nextTipset.Key()).Return(&filTypes.Actor{Balance: filTypes.NewInt(100)}, nil)
+	rpcClient := &MockRPCClient{client: fullNodeMock}
+	account := &EvmAccount{
+		Address:       ethAddress.String(),
+		ParsedAddress: parsedAddress,
+		EthAddress:    ethAddress,
+		State:         &types.EvmAccountState{Height: 100, Nonce: 4, Balance: big.NewInt(100)},
+	}
+
+	err = compareEvmAccount(t.Context(), account, tipset, nextTipset, rpcClient)
+	assert.EqualError(t, err, "evm account mismatch for "+ethAddress.String()+": nonce onchain=5, parsed=4")
+
+	// the account is synced with the chain, the mismatch is not reported again
+	assert.Equal(t, &types.EvmAccountState{Height: 100, Nonce: 5, Balance: big.NewInt(100)}, account.State)
+	assert.NoError(t, compareEvmAccount(t.Context(), account, tipset, nextTipset, rpcClient))
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"go.uber.org/zap"
+)
+
+func IndexTracesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.IndexTracesCommand,
+		Short: "Index the addresses found in the traces for the trace-index event provider",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return indexTraces(cmd)
+		},
+	}
+	cmd.Flags().Int64(internal.StartFlag, 1, "start height to index")
+	cmd.Flags().Int64(internal.EndFlag, 0, "end height to index (required)")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
+	return cmd
+}
+
+func indexTraces(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	start, err := cmd.Flags().GetInt64(internal.StartFlag)
+	if err != nil {
+		log.Error("failed to get start", zap.Error(err))
+		return err
+	}
+	end, err := cmd.Flags().GetInt64(internal.EndFlag)
+	if err != nil {
+		log.Error("failed to get end", zap.Error(err))
+		return err
+	}
+	if !cmd.Flags().Changed(internal.EndFlag) {
+		log.Error("end height is required")
+		return errors.New("end height is required")
+	}
+	if start <= 0 || end < start {
+		log.Error("invalid height range", zap.Int64("start-height", start), zap.Int64("end-height", end))
+		return errors.New("start height must be positive and not greater than end height")
+	}
+	if err := config.Require(api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("failed to get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
+
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("failed to get db path", zap.Error(err))
+		return err
+	}
+	db, err := api.NewDB(dbPath, internal.IndexTracesCommand)
+	if err != nil {
+		log.Error("failed to create db", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error("failed to close database", zap.Error(err))
+		}
+	}()
+	// addresses are resolved when the index is queried
+	index, err := api.NewTraceIndex(dbPath, nil)
+	if err != nil {
+		log.Error("failed to open trace index", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := index.Close(); err != nil {
+			log.Error("failed to close trace index", zap.Error(err))
+		}
+	}()
+
+	dataStore, err := api.GetDataStoreClient(&config)
+	if err != nil {
+		log.Error("failed to create data store client", zap.Error(err))
+		return err
+	}
+	latestHeight, err := resumeHeight(cmd, db)
+	if err != nil {
+		log.Error("failed to get latest height", zap.Error(err))
+		return err
+	}
+	if latestHeight > 0 && latestHeight > start {
+		log.Info("resuming from latest height", zap.Int64("latest-height", latestHeight))
+		start = latestHeight
+	}
+
+	for i := start; i <= end; i++ {
+		log.Debug(fmt.Sprintf("Indexing traces for height %d", i))
+
+		data, err := api.GetTraceFromDataStore(i, dataStore, &config)
+		if err != nil {
+			log.Error("failed to get trace", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureTrace, err.Error(), db)
+			continue
+		}
+		addresses, err := traceAddresses(network, i, data)
+		if err != nil {
+			log.Error("failed to get trace addresses", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureParse, err.Error(), db)
+			continue
+		}
+		if err := index.AddHeight(i, addresses); err != nil {
+			log.Error("failed to index trace", zap.Error(err), zap.Int64("height", i))
+			internal.FailProgressHeight(i, internal.FailureOther, err.Error(), db)
+			continue
+		}
+		internal.UpdateProgressHeight(i, true, internal.ProgressOK, db)
+	}
+	return nil
+}
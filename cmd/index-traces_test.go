@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexTracesRange(t *testing.T) {
+	for name, test := range map[string]struct {
+		args []string
+		err  string
+	}{
+		"missing end": {args: []string{"--start", "10"}, err: "end height is required"},
+		"end before start": {
+			args: []string{"--start", "10", "--end", "5"},
+			err:  "start height must be positive and not greater than end height",
+		},
+		"non positive start": {
+			args: []string{"--start", "0", "--end", "5"},
+			err:  "start height must be positive and not greater than end height",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd := IndexTracesCmd()
+			cmd.SetArgs(append(test.args, "--db-path", t.TempDir()))
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			assert.EqualError(t, cmd.Execute(), test.err)
+		})
+	}
+}
@@ -0,0 +1,578 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	address "github.com/filecoin-project/go-address"
+	lotusBig "github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/lotus/chain/actors/builtin"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/spf13/cobra"
+	fil_parser "github.com/zondax/fil-parser"
+	"github.com/zondax/fil-parser/parser"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	types "github.com/zondax/fil-trace-check/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	marketActorAddr = "f05"
+	// marketSettlementWarning starts the message of the passed results with balance changes only explained by cron
+	// settlements
+	marketSettlementWarning = "unverified market settlement"
+)
+
+func ValidateMarketBalanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.MarketBalanceCheck,
+		Short: "Validate Market Escrow and Locked Balances",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return validateMarketBalance(cmd)
+		},
+	}
+	cmd.Flags().String(internal.AddressFileFlag, "", "path to a newline separated address file for addresses to check state")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
+	cmd.Flags().String(internal.EventProviderFlag, types.EventProviderBeryx, "event provider to use (beryx, trace-index, lotus)")
+	cmd.Flags().String(internal.EventProviderTokenFlag, "", "event provider token")
+	cmd.Flags().Int64(internal.EventStartFlag, 0, "start height of the event provider range, required by lotus")
+	cmd.Flags().Int64(internal.EventEndFlag, 0, "end height of the event provider range, required by lotus")
+	cmd.Flags().Bool(internal.ActorEventsFlag, false, "also use actor event emitters in the lotus event provider")
+	return cmd
+}
+
+type MarketAddress struct {
+	EquivalentAddresses map[string]bool
+	State               *types.MarketState
+	ParsedAddress       address.Address
+	// IsProvider is true when the address is a storage provider (miner actor)
+	IsProvider bool
+}
+
+func validateMarketBalance(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("could not get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
+
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("could not get db path", zap.Error(err))
+		return err
+	}
+	db, err := api.NewDB(dbPath, internal.MarketBalanceCheck)
+	if err != nil {
+		log.Error("could not create db", zap.Error(err))
+		return err
+	}
+	stateDB, err := api.NewDB(dbPath, internal.MarketBalanceCheck+".state")
+	if err != nil {
+		log.Error("could not create state db", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error("failed to close database", zap.Error(err))
+		}
+		if err := stateDB.Close(); err != nil {
+			log.Error("failed to close state database", zap.Error(err))
+		}
+	}()
+	addressCache, closeAddressCache := openAddressCache(ctx, dbPath, log)
+	defer closeAddressCache()
+
+	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
+	if err != nil {
+		log.Error("could not get address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+	eventProviderName, err := cmd.Flags().GetString(internal.EventProviderFlag)
+	if err != nil {
+		log.Error("could not get event provider", zap.Error(err), zap.String("event-provider", eventProviderName))
+		return err
+	}
+	eventProviderToken, err := cmd.Flags().GetString(internal.EventProviderTokenFlag)
+	if err != nil {
+		log.Error("could not get event provider token", zap.Error(err))
+		return err
+	}
+	eventStart, err := cmd.Flags().GetInt64(internal.EventStartFlag)
+	if err != nil {
+		log.Error("could not get event start", zap.Error(err))
+		return err
+	}
+	eventEnd, err := cmd.Flags().GetInt64(internal.EventEndFlag)
+	if err != nil {
+		log.Error("could not get event end", zap.Error(err))
+		return err
+	}
+	actorEvents, err := cmd.Flags().GetBool(internal.ActorEventsFlag)
+	if err != nil {
+		log.Error("could not get actor events", zap.Error(err))
+		return err
+	}
+	noResume, err := cmd.Flags().GetBool(internal.NoResumeFlag)
+	if err != nil {
+		log.Error("could not get no resume", zap.Error(err))
+		return err
+	}
+
+	addresses, err := internal.ReadAddressFile(addressFile)
+	if err != nil {
+		log.Error("could not read address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("could not create rpc client", zap.Error(err), zap.String("node-url", config.NodeURL))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	eventProvider, err := types.NewEventProvider(eventProviderName, types.EventProviderOptions{
+		Token:       eventProviderToken,
+		Network:     network,
+		IndexPath:   dbPath,
+		Resolver:    equivalentAddressResolver(rpcClient),
+		RPCClient:   rpcClient,
+		Start:       eventStart,
+		End:         eventEnd,
+		ActorEvents: actorEvents,
+	})
+	if err != nil {
+		log.Error("could not create event provider", zap.Error(err), zap.String("event-provider", eventProviderName))
+		return err
+	}
+	defer func() {
+		if err := eventProvider.Close(); err != nil {
+			log.Error("failed to close event provider", zap.Error(err))
+		}
+	}()
+	dataStore, err := api.GetDataStoreClient(&config)
+	if err != nil {
+		log.Error("could not create data store client", zap.Error(err))
+		return err
+	}
+
+	parser, err := fil_parser.NewFilecoinParserWithActorV2(
+		rpcClient.RosettaLib(), api.GetDataSource(network, rpcClient),
+		getParserLogger(),
+	)
+	if err != nil {
+		log.Error("failed to create parser", zap.Error(err))
+		return err
+	}
+
+	// a bounded range starts from the chain state before any message at event-start is applied, the events before
+	// it are not validated
+	var startTipset *filTypes.TipSet
+	if eventStart > 0 {
+		startTipset, err = api.ChainGetTipSetByHeight(ctx, eventStart, rpcClient)
+		if err != nil {
+			log.Error("failed to get start tipset", zap.Error(err), zap.Int64("height", eventStart))
+			return err
+		}
+	}
+
+	for _, addr := range addresses {
+		log.Debug(fmt.Sprintf("Validating market balance for %s", addr))
+		parsedAddress, err := address.NewFromString(addr)
+		if err != nil {
+			log.Error("failed to parse provided address", zap.Error(err), zap.String("address", addr))
+			internal.FailProgressAddress(addr, 0, internal.FailureParse, err.Error(), db)
+			continue
+		}
+		actor, err := rpcClient.FullNodeClient().StateGetActor(ctx, parsedAddress, filTypes.EmptyTSK)
+		if err != nil {
+			log.Error("failed to get onchain actor", zap.Error(err), zap.String("address", addr))
+			internal.FailProgressAddress(addr, 0, internal.FailureNode, err.Error(), db)
+			continue
+		}
+		heights, err := eventProvider.GetAddressEventHeights(ctx, addr)
+		if err != nil {
+			log.Error("failed to get address events", zap.Error(err), zap.String("address", addr))
+			internal.FailProgressAddress(addr, 0, internal.FailureNode, err.Error(), db)
+			continue
+		}
+
+		processedHeights := map[int64]bool{}
+		// try load state
+		state := &types.MarketState{}
+		if !noResume {
+			err = internal.GetProgressAddressState(addr, state, stateDB)
+			if err != nil {
+				log.Error("failed to get last state", zap.Error(err), zap.String("address", addr))
+			}
+		}
+		if startTipset != nil && state.Height < eventStart {
+			if state.Height > 0 {
+				log.Info("market state before event start, loading balance from chain", zap.String("address", addr), zap.Int64("state-height", state.Height), zap.Int64("event-start", eventStart))
+			}
+			state, err = getMarketBalanceState(ctx, parsedAddress, eventStart-1, startTipset, rpcClient)
+			if err != nil {
+				log.Error("failed to get onchain market balance", zap.Error(err), zap.String("address", addr))
+				internal.FailProgressAddress(addr, 0, internal.FailureNode, err.Error(), db)
+				continue
+			}
+		}
+		if state.Height > 0 {
+			for _, height := range heights {
+				if height <= state.Height {
+					processedHeights[height] = true
+				}
+			}
+		}
+
+		marketAddress := &MarketAddress{
+			State:         state,
+			ParsedAddress: parsedAddress,
+			IsProvider:    builtin.IsStorageMinerActor(actor.Code),
+		}
+		log.Debug("got address events", zap.Int("count", len(heights)), zap.String("address", addr))
+
+		lastHeight := int64(0)
+		for _, height := range heights {
+			if processedHeights[height] {
+				continue
+			}
+			processedHeights[height] = true
+			data, err := api.GetTraceFromDataStore(height, dataStore, &config)
+			if err != nil {
+				log.Error("failed to get trace", zap.Error(err), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureTrace, err.Error(), db)
+				continue
+			}
+			tipset, err := api.ChainGetTipSetByHeight(ctx, height, rpcClient)
+			if err != nil {
+				log.Error("failed to get tipset", zap.Error(err), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
+				continue
+			}
+			// on-chain state is applied on the next tipset
+			nextTipset, err := api.ChainGetNextTipSet(ctx, tipset, rpcClient)
+			if err != nil {
+				log.Error("failed to get next tipset", zap.Error(err), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
+				continue
+			}
+			equivalentAddresses, err := equivalentAddressesAt(ctx, parsedAddress, tipset, nextTipset, rpcClient, addressCache)
+			if errors.Is(err, internal.ErrActorNotFound) {
+				log.Warn("actor does not exist at event height", zap.String("address", addr), zap.Int64("height", height))
+				continue
+			}
+			if err != nil {
+				log.Error("failed to get equivalent addresses", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
+				continue
+			}
+			marketAddress.EquivalentAddresses = equivalentAddresses
+			// market messages are usually sent by a worker or a third party, so keep
+			// every message to the market actor and match the address in the params
+			filterAddresses := map[string]bool{marketActorAddr: true}
+			for equivalentAddress := range equivalentAddresses {
+				filterAddresses[equivalentAddress] = true
+			}
+			data, err = filterTrace(network, height, filterAddresses, data)
+			if err != nil {
+				log.Error("failed to filter trace", zap.Error(err), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureParse, err.Error(), db)
+				continue
+			}
+
+			txsData := parserTypes.TxsData{
+				Traces: data,
+				Tipset: &parserTypes.ExtendedTipSet{
+					TipSet: *tipset,
+				},
+			}
+			nodeInfo := network.HeightToNodeVersion(height)
+			txsData.Metadata.NodeInfo = *nodeInfo
+
+			parsedTxData, err := parser.ParseTransactions(ctx, txsData)
+			if err != nil {
+				log.Error("failed to parse transactions", zap.Error(err), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureParse, err.Error(), db)
+				continue
+			}
+			if len(parsedTxData.Txs) == 0 {
+				continue
+			}
+			warning, err := compareMarketBalance(ctx, height, marketAddress, tipset, nextTipset, parsedTxData, rpcClient)
+			switch {
+			case err != nil:
+				log.Error("failed to compare market balance", zap.Error(err), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureMismatch), err.Error(), db)
+			case warning != "":
+				log.Warn("market balance change accepted as a cron settlement", zap.String("warning", warning), zap.Int64("height", height))
+				internal.UpdateProgressAddress(addr, height, true, warning, db)
+			default:
+				internal.UpdateProgressAddress(addr, height, true, internal.ProgressOK, db)
+			}
+			if err := internal.UpdateProgressAddressState(addr, marketAddress.State, stateDB); err != nil {
+				log.Error("failed to update address state", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+			}
+			lastHeight = height
+		}
+		internal.UpdateProgressHeightMarker(lastHeight, db)
+	}
+	return nil
+}
+
+// getMarketBalanceState returns the market balance of addr in the state of tipset, at height
+func getMarketBalanceState(ctx context.Context, addr address.Address, height int64, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) (*types.MarketState, error) {
+	balance, err := rpcClient.FullNodeClient().StateMarketBalance(ctx, addr, tipset.Key())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get onchain market balance: %w", err)
+	}
+	return &types.MarketState{Height: height, Escrow: toBigInt(balance.Escrow), Locked: toBigInt(balance.Locked)}, nil
+}
+
+// compareMarketBalance checks the escrow and locked balance changes at height against the traces.
+// Deal payments and collateral releases are settled by the market cron and never show up as
+// transactions, so a difference that has the shape of a settlement is synced and returned as a warning
+// instead of failing, the settled amounts are not known to verify it.
+func compareMarketBalance(ctx context.Context, height int64, addr *MarketAddress, tipset, nextTipset *filTypes.TipSet, parsedTxData *parserTypes.TxsParsedResult, rpcClient api.RPCClientInterface) (string, error) {
+	before, err := rpcClient.FullNodeClient().StateMarketBalance(ctx, addr.ParsedAddress, tipset.Key())
+	if err != nil {
+		return "", internal.Failure(internal.FailureNode, fmt.Errorf("failed to get onchain market balance: %w", err))
+	}
+	beforeEscrow, beforeLocked := toBigInt(before.Escrow), toBigInt(before.Locked)
+
+	warnings := []string{}
+	if addr.State.Escrow != nil && addr.State.Locked != nil {
+		escrowDiff := new(big.Int).Sub(beforeEscrow, addr.State.Escrow)
+		lockedDiff := new(big.Int).Sub(beforeLocked, addr.State.Locked)
+		if !isMarketSettlement(escrowDiff, lockedDiff, addr.IsProvider) {
+			return "", fmt.Errorf("unexplained market balance change for %s between heights %d and %d: escrow=%s, locked=%s", addr.ParsedAddress, addr.State.Height, height, escrowDiff, lockedDiff)
+		}
+		if escrowDiff.Sign() != 0 || lockedDiff.Sign() != 0 {
+			warnings = append(warnings, fmt.Sprintf("unverified settlement between heights %d and %d: escrow=%s, locked=%s", addr.State.Height, height, escrowDiff, lockedDiff))
+		}
+	}
+	addr.State.Height = height
+	addr.State.Escrow = beforeEscrow
+	addr.State.Locked = beforeLocked
+
+	if err := applyMarketBalanceStateFromTransactions(height, addr.EquivalentAddresses, addr.State, parsedTxData.Txs); err != nil {
+		return "", internal.Failure(internal.FailureParse, fmt.Errorf("failed to apply market balance state from transactions: %w", err))
+	}
+	if addr.State.Escrow.Sign() < 0 {
+		return "", fmt.Errorf("negative escrow balance for %s", addr.ParsedAddress)
+	}
+
+	after, err := rpcClient.FullNodeClient().StateMarketBalance(ctx, addr.ParsedAddress, nextTipset.Key())
+	if err != nil {
+		return "", internal.Failure(internal.FailureNode, fmt.Errorf("failed to get onchain market balance: %w", err))
+	}
+	afterEscrow, afterLocked := toBigInt(after.Escrow), toBigInt(after.Locked)
+
+	parsedEscrow, parsedLocked := addr.State.Escrow, addr.State.Locked
+	addr.State.Escrow = afterEscrow
+	addr.State.Locked = afterLocked
+
+	escrowDiff := new(big.Int).Sub(afterEscrow, parsedEscrow)
+	lockedDiff := new(big.Int).Sub(afterLocked, parsedLocked)
+	if !isMarketSettlement(escrowDiff, lockedDiff, addr.IsProvider) {
+		return "", fmt.Errorf("market balance mismatch for %s: onchain escrow=%s locked=%s, parsed escrow=%s locked=%s", addr.ParsedAddress, afterEscrow, afterLocked, parsedEscrow, parsedLocked)
+	}
+	if escrowDiff.Sign() != 0 || lockedDiff.Sign() != 0 {
+		warnings = append(warnings, fmt.Sprintf("unverified settlement at height %d: escrow=%s, locked=%s", height, escrowDiff, lockedDiff))
+	}
+	if len(warnings) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%s for %s: %s", marketSettlementWarning, addr.ParsedAddress, strings.Join(warnings, "; ")), nil
+}
+
+// isMarketSettlement reports whether an escrow/locked difference can be explained by cron settlements.
+// Settlements never lock funds: clients pay from escrow and locked by the same amount and get collateral
+// unlocked, providers receive payments into escrow, get collateral unlocked or slashed (escrow and locked).
+func isMarketSettlement(escrowDiff, lockedDiff *big.Int, isProvider bool) bool {
+	if lockedDiff.Sign() > 0 {
+		return false
+	}
+	if escrowDiff.Cmp(lockedDiff) < 0 {
+		return false
+	}
+	if !isProvider && escrowDiff.Sign() > 0 {
+		return false
+	}
+	return true
+}
+
+func applyMarketBalanceStateFromTransactions(height int64, equivalentAddresses map[string]bool, marketState *types.MarketState, txs []*parserTypes.Transaction) error {
+	if marketState.Escrow == nil {
+		marketState.Escrow = big.NewInt(0)
+	}
+	if marketState.Locked == nil {
+		marketState.Locked = big.NewInt(0)
+	}
+	for _, tx := range txs {
+		if tx.Status != "Ok" || tx.TxTo != marketActorAddr {
+			continue
+		}
+		metadata := types.MarketTxMetadata{}
+		switch tx.TxType {
+		case parser.MethodAddBalance, parser.MethodAddBalanceExported,
+			parser.MethodWithdrawBalance, parser.MethodWithdrawBalanceExported,
+			parser.MethodPublishStorageDeals, parser.MethodPublishStorageDealsExported:
+			if err := json.Unmarshal([]byte(tx.TxMetadata), &metadata); err != nil {
+				return fmt.Errorf("failed to parse %s metadata(%s): %w", tx.TxType, tx.TxMetadata, err)
+			}
+		default:
+			continue
+		}
+
+		switch tx.TxType {
+		case parser.MethodAddBalance, parser.MethodAddBalanceExported:
+			var beneficiary string
+			if err := json.Unmarshal(metadata.Params, &beneficiary); err != nil {
+				return fmt.Errorf("failed to parse addBalance(%s): %w", string(metadata.Params), err)
+			}
+			if !equivalentAddresses[beneficiary] || tx.Amount == nil {
+				continue
+			}
+			marketState.Height = height
+			marketState.Escrow = new(big.Int).Add(marketState.Escrow, tx.Amount)
+		case parser.MethodWithdrawBalance, parser.MethodWithdrawBalanceExported:
+			withdrawBalance := types.WithdrawBalanceParams{}
+			if err := json.Unmarshal(metadata.Params, &withdrawBalance); err != nil {
+				return fmt.Errorf("failed to parse withdrawBalance(%s): %w", string(metadata.Params), err)
+			}
+			if !equivalentAddresses[withdrawBalance.ProviderOrClientAddress] {
+				continue
+			}
+			amount, err := withdrawnAmount(withdrawBalance, metadata.Return, marketState)
+			if err != nil {
+				return err
+			}
+			marketState.Height = height
+			marketState.Escrow = new(big.Int).Sub(marketState.Escrow, amount)
+		case parser.MethodPublishStorageDeals, parser.MethodPublishStorageDealsExported:
+			publishStorageDeals := types.PublishStorageDealsParams{}
+			if err := json.Unmarshal(metadata.Params, &publishStorageDeals); err != nil {
+				return fmt.Errorf("failed to parse publishStorageDeals(%s): %w", string(metadata.Params), err)
+			}
+			validDeals, err := publishedDeals(metadata.Return, len(publishStorageDeals.Deals))
+			if err != nil {
+				return err
+			}
+			for i, deal := range publishStorageDeals.Deals {
+				if !validDeals[i] {
+					continue
+				}
+				locked, err := dealLockedAmount(deal.Proposal, equivalentAddresses)
+				if err != nil {
+					return err
+				}
+				if locked.Sign() == 0 {
+					continue
+				}
+				marketState.Height = height
+				marketState.Locked = new(big.Int).Add(marketState.Locked, locked)
+			}
+		}
+	}
+	return nil
+}
+
+// withdrawnAmount returns the amount that left escrow. Older actor versions do not return the
+// withdrawn amount, in which case it is capped by the available (unlocked) balance.
+func withdrawnAmount(params types.WithdrawBalanceParams, rawReturn json.RawMessage, marketState *types.MarketState) (*big.Int, error) {
+	if len(rawReturn) > 0 && string(rawReturn) != "null" {
+		var returned string
+		if err := json.Unmarshal(rawReturn, &returned); err != nil {
+			return nil, fmt.Errorf("failed to parse withdrawBalance return(%s): %w", string(rawReturn), err)
+		}
+		amount, ok := new(big.Int).SetString(returned, 10)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse withdrawBalance return amount: %s", returned)
+		}
+		return amount, nil
+	}
+	amount, ok := new(big.Int).SetString(params.Amount, 10)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse withdrawBalance amount: %s", params.Amount)
+	}
+	available := new(big.Int).Sub(marketState.Escrow, marketState.Locked)
+	if available.Cmp(amount) < 0 {
+		amount = available
+	}
+	if amount.Sign() < 0 {
+		amount = big.NewInt(0)
+	}
+	return amount, nil
+}
+
+// publishedDeals returns which proposals were accepted. Since actors v7 invalid deals are
+// dropped and reported through the ValidDeals bitfield instead of failing the whole message.
+func publishedDeals(rawReturn json.RawMessage, count int) (map[int]bool, error) {
+	valid := make(map[int]bool, count)
+	ret := types.PublishStorageDealsReturn{}
+	if len(rawReturn) > 0 && string(rawReturn) != "null" {
+		if err := json.Unmarshal(rawReturn, &ret); err != nil {
+			return nil, fmt.Errorf("failed to parse publishStorageDeals return(%s): %w", string(rawReturn), err)
+		}
+	}
+	if ret.ValidDeals == nil {
+		for i := 0; i < count; i++ {
+			valid[i] = true
+		}
+		return valid, nil
+	}
+	if err := ret.ValidDeals.ForEach(func(i uint64) error {
+		valid[int(i)] = true // #nosec G115
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read valid deals: %w", err)
+	}
+	return valid, nil
+}
+
+// dealLockedAmount returns the funds locked for the address by a published deal:
+// the total storage fee plus client collateral for the client and the provider collateral for the provider.
+func dealLockedAmount(proposal types.DealProposal, equivalentAddresses map[string]bool) (*big.Int, error) {
+	locked := big.NewInt(0)
+	if equivalentAddresses[proposal.Client] {
+		price, ok := new(big.Int).SetString(proposal.StoragePricePerEpoch, 10)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse storage price per epoch: %s", proposal.StoragePricePerEpoch)
+		}
+		collateral, ok := new(big.Int).SetString(proposal.ClientCollateral, 10)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse client collateral: %s", proposal.ClientCollateral)
+		}
+		duration := big.NewInt(proposal.EndEpoch - proposal.StartEpoch)
+		locked.Add(locked, price.Mul(price, duration))
+		locked.Add(locked, collateral)
+	}
+	if equivalentAddresses[proposal.Provider] {
+		collateral, ok := new(big.Int).SetString(proposal.ProviderCollateral, 10)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse provider collateral: %s", proposal.ProviderCollateral)
+		}
+		locked.Add(locked, collateral)
+	}
+	return locked, nil
+}
+
+func toBigInt(value lotusBig.Int) *big.Int {
+	if value.Int == nil {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(value.Int)
+}
@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"math/big"
+	"testing"
+
+	address "github.com/filecoin-project/go-address"
+	lotusAPI "github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+	types "github.com/zondax/fil-trace-check/internal/types"
+)
+
+func TestApplyMarketBalanceStateFromTransactions(t *testing.T) {
+	tests := []struct {
+		name           string
+		addr           string
+		initialState   *types.MarketState
+		txs            []*parserTypes.Transaction
+		expectedEscrow *big.Int
+		expectedLocked *big.Int
+	}{
+		{
+			name:         "add balance for address",
+			addr:         "f01234",
+			initialState: &types.MarketState{},
+			txs: []*parserTypes.Transaction{
+				{
+					TxTo:       marketActorAddr,
+					TxFrom:     "f05678",
+					TxType:     "AddBalance",
+					Amount:     big.NewInt(1000),
+					Status:     "Ok",
+					TxMetadata: `{"Params":"f01234"}`,
+				},
+			},
+			expectedEscrow: big.NewInt(1000),
+			expectedLocked: big.NewInt(0),
+		},
+		{
+			name:         "add balance for another address",
+			addr:         "f01234",
+			initialState: &types.MarketState{},
+			txs: []*parserTypes.Transaction{
+				{
+					TxTo:       marketActorAddr,
+					TxFrom:     "f01234",
+					TxType:     "AddBalance",
+					Amount:     big.NewInt(1000),
+					Status:     "Ok",
+					TxMetadata: `{"Params":"f09999"}`,
+				},
+			},
+			expectedEscrow: big.NewInt(0),
+			expectedLocked: big.NewInt(0),
+		},
+		{
+			name:         "failed add balance is ignored",
+			addr:         "f01234",
+			initialState: &types.MarketState{},
+			txs: []*parserTypes.Transaction{
+				{
+					TxTo:       marketActorAddr,
+					TxFrom:     "f01234",
+					TxType:     "AddBalance",
+					Amount:     big.NewInt(1000),
+					Status:     "Error",
+					TxMetadata: `{"Params":"f01234"}`,
+				},
+			},
+			expectedEscrow: big.NewInt(0),
+			expectedLocked: big.NewInt(0),
+		},
+		{
+			name: "withdraw balance uses returned amount",
+			addr: "f01234",
+			initialState: &types.MarketState{
+				Escrow: big.NewInt(1000),
+				Locked: big.NewInt(0),
+			},
+			txs: []*parserTypes.Transaction{
+				{
+					TxTo:       marketActorAddr,
+					TxFrom:     "f01234",
+					TxType:     "WithdrawBalance",
+					Status:     "Ok",
+					TxMetadata: `{"Params":{"ProviderOrClientAddress":"f01234","Amount":"800"},"Return":"300"}`,
+				},
+			},
+			expectedEscrow: big.NewInt(700),
+			expectedLocked: big.NewInt(0),
+		},
+		{
+			name: "withdraw balance without return is capped by available balance",
+			addr: "f01234",
+			initialState: &types.MarketState{
+				Escrow: big.NewInt(1000),
+				Locked: big.NewInt(400),
+			},
+			txs: []*parserTypes.Transaction{
+				{
+					TxTo:       marketActorAddr,
+					TxFrom:     "f01234",
+					TxType:     "WithdrawBalance",
+					Status:     "Ok",
+					TxMetadata: `{"Params":{"ProviderOrClientAddress":"f01234","Amount":"800"}}`,
+				},
+			},
+			expectedEscrow: big.NewInt(400),
+			expectedLocked: big.NewInt(400),
+		},
+		{
+			name: "publish storage deals locks client and provider funds",
+			addr: "f01234",
+			initialState: &types.MarketState{
+				Escrow: big.NewInt(10000),
+				Locked: big.NewInt(0),
+			},
+			txs: []*parserTypes.Transaction{
+				{
+					TxTo:   marketActorAddr,
+					TxFrom: "f07777",
+					TxType: "PublishStorageDeals",
+					Status: "Ok",
+					TxMetadata: `{"Params":{"Deals":[` +
+						`{"Proposal":{"Client":"f01234","Provider":"f07777","StartEpoch":10,"EndEpoch":20,"StoragePricePerEpoch":"5","ProviderCollateral":"100","ClientCollateral":"50"}},` +
+						`{"Proposal":{"Client":"f05555","Provider":"f01234","StartEpoch":10,"EndEpoch":20,"StoragePricePerEpoch":"5","ProviderCollateral":"100","ClientCollateral":"50"}},` +
+						`{"Proposal":{"Client":"f05555","Provider":"f07777","StartEpoch":10,"EndEpoch":20,"StoragePricePerEpoch":"5","ProviderCollateral":"100","ClientCollateral":"50"}}` +
+						`]}}`,
+				},
+			},
+			expectedEscrow: big.NewInt(10000),
+			// client: 5*10 + 50, provider: 100
+			expectedLocked: big.NewInt(200),
+		},
+		{
+			name: "publish storage deals skips invalid deals",
+			addr: "f01234",
+			initialState: &types.MarketState{
+				Escrow: big.NewInt(10000),
+				Locked: big.NewInt(0),
+			},
+			txs: []*parserTypes.Transaction{
+				{
+					TxTo:   marketActorAddr,
+					TxFrom: "f07777",
+					TxType: "PublishStorageDealsExported",
+					Status: "Ok",
+					TxMetadata: `{"Params":{"Deals":[` +
+						`{"Proposal":{"Client":"f01234","Provider":"f07777","StartEpoch":10,"EndEpoch":20,"StoragePricePerEpoch":"5","ProviderCollateral":"100","ClientCollateral":"50"}},` +
+						`{"Proposal":{"Client":"f01234","Provider":"f07777","StartEpoch":10,"EndEpoch":20,"StoragePricePerEpoch":"1","ProviderCollateral":"100","ClientCollateral":"0"}}` +
+						`]},"Return":{"IDs":[42],"ValidDeals":[1,1]}}`,
+				},
+			},
+			expectedEscrow: big.NewInt(10000),
+			expectedLocked: big.NewInt(10),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &types.MarketState{}
+			if tt.initialState.Escrow != nil {
+				state.Escrow = new(big.Int).Set(tt.initialState.Escrow)
+			}
+			if tt.initialState.Locked != nil {
+				state.Locked = new(big.Int).Set(tt.initialState.Locked)
+			}
+
+			err := applyMarketBalanceStateFromTransactions(0, map[string]bool{
+				tt.addr: true,
+			}, state, tt.txs)
+			require.NoError(t, err)
+
+			assert.Equal(t, 0, tt.expectedEscrow.Cmp(state.Escrow), "escrow: expected %s, got %s", tt.expectedEscrow, state.Escrow)
+			assert.Equal(t, 0, tt.expectedLocked.Cmp(state.Locked), "locked: expected %s, got %s", tt.expectedLocked, state.Locked)
+		})
+	}
+}
+
+func TestIsMarketSettlement(t *testing.T) {
+	tests := []struct {
+		name       string
+		escrowDiff int64
+		lockedDiff int64
+		isProvider bool
+		expected   bool
+	}{
+		{name: "no change", escrowDiff: 0, lockedDiff: 0, expected: true},
+		{name: "client pays provider", escrowDiff: -10, lockedDiff: -10, expected: true},
+		{name: "client collateral unlocked", escrowDiff: 0, lockedDiff: -10, expected: true},
+		{name: "client escrow increase", escrowDiff: 10, lockedDiff: 0, expected: false},
+		{name: "client missing withdraw", escrowDiff: -10, lockedDiff: 0, expected: false},
+		{name: "locked increase", escrowDiff: 10, lockedDiff: 10, isProvider: true, expected: false},
+		{name: "provider receives payment", escrowDiff: 10, lockedDiff: 0, isProvider: true, expected: true},
+		{name: "provider collateral slashed", escrowDiff: -10, lockedDiff: -10, isProvider: true, expected: true},
+		{name: "provider missing withdraw", escrowDiff: -10, lockedDiff: 0, isProvider: true, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := isMarketSettlement(big.NewInt(tt.escrowDiff), big.NewInt(tt.lockedDiff), tt.isProvider)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCompareMarketBalance(t *testing.T) {
+	provider, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	tipset, nextTipset := testTipSet(t, 100), testTipSet(t, 101)
+	marketBalance := func(escrow, locked int64) lotusAPI.MarketBalance {
+		return lotusAPI.MarketBalance{Escrow: filTypes.NewInt(uint64(escrow)), Locked: filTypes.NewInt(uint64(locked))}
+	}
+	compare := func(state *types.MarketState, before, after lotusAPI.MarketBalance) (string, error) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("StateMarketBalance", mock.Anything, provider, tipset.Key()).Return(before, nil)
+		fullNodeMock.On("StateMarketBalance", mock.Anything, provider, nextTipset.Key()).Return(after, nil).Maybe()
+		addr := &MarketAddress{ParsedAddress: provider, IsProvider: true, State: state}
+		return compareMarketBalance(t.Context(), 100, addr, tipset, nextTipset, &parserTypes.TxsParsedResult{}, &MockRPCClient{client: fullNodeMock})
+	}
+
+	warning, err := compare(&types.MarketState{Height: 90, Escrow: big.NewInt(100), Locked: big.NewInt(50)}, marketBalance(100, 50), marketBalance(100, 50))
+	require.NoError(t, err)
+	assert.Empty(t, warning)
+
+	// a payment received by cron is accepted but reported
+	warning, err = compare(&types.MarketState{Height: 90, Escrow: big.NewInt(100), Locked: big.NewInt(50)}, marketBalance(110, 50), marketBalance(110, 40))
+	require.NoError(t, err)
+	assert.Equal(t, "unverified market settlement for f01000: unverified settlement between heights 90 and 100: escrow=10, locked=0; unverified settlement at height 100: escrow=0, locked=-10", warning)
+
+	_, err = compare(&types.MarketState{Height: 90, Escrow: big.NewInt(100), Locked: big.NewInt(50)}, marketBalance(90, 50), marketBalance(90, 50))
+	assert.ErrorContains(t, err, "unexplained market balance change for f01000 between heights 90 and 100")
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/zondax/fil-trace-check/api"
+	"go.uber.org/zap"
+)
+
+// AddMetrics serves prometheus metrics while a command runs when metrics_port is set in the config
+func AddMetrics(root *cobra.Command) {
+	root.PersistentPreRunE = func(_ *cobra.Command, _ []string) error {
+		config := api.GetGlobalConfigs()
+		if config.MetricsPort == "" {
+			return nil
+		}
+		log := initLogger()
+		if err := api.StartMetrics(config.MetricsPort, config.MetricsPath); err != nil {
+			log.Error("failed to start metrics", zap.Error(err))
+			return err
+		}
+		log.Info("serving metrics", zap.String("port", config.MetricsPort), zap.String("path", config.MetricsPath))
+		return nil
+	}
+}
@@ -0,0 +1,476 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	address "github.com/filecoin-project/go-address"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/spf13/cobra"
+	fil_parser "github.com/zondax/fil-parser"
+	"github.com/zondax/fil-parser/parser"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	types "github.com/zondax/fil-trace-check/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxReportedSectors caps the sector numbers written to a progress message
+	maxReportedSectors = 50
+)
+
+func ValidateMinerSectorsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.MinerSectorsCheck,
+		Short: "Validate Miner Sectors Sequentially from start=1 (unless defined) to end",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return validateMinerSectors(cmd)
+		},
+	}
+	cmd.Flags().String(internal.AddressFileFlag, "", "path to a newline separated address file for miners to check sectors")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
+	cmd.Flags().Int64(internal.StartFlag, 1, "optional start height to validate")
+	cmd.Flags().Int64(internal.EndFlag, 0, "end height to validate")
+	cmd.Flags().Int64(internal.CheckpointIntervalFlag, 2880, "number of epochs between on-chain sector checks")
+	return cmd
+}
+
+type MinerSectorsAddress struct {
+	Address             string
+	EquivalentAddresses map[string]bool
+	State               *types.MinerSectorsState
+	ParsedAddress       address.Address
+}
+
+// sectorDiff holds the sectors where the traces and the chain disagree
+type sectorDiff struct {
+	// Lost are proven sectors on chain that the traces never activated
+	Lost []uint64
+	// Invented are sectors activated by the traces that are not on chain
+	Invented []uint64
+	// NotFaulty are sectors declared faulty in the traces (and never recovered) that are healthy on chain
+	NotFaulty []uint64
+}
+
+func (d sectorDiff) empty() bool {
+	return len(d.Lost) == 0 && len(d.Invented) == 0 && len(d.NotFaulty) == 0
+}
+
+func validateMinerSectors(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("could not get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
+
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("could not get db path", zap.Error(err))
+		return err
+	}
+	db, err := api.NewDB(dbPath, internal.MinerSectorsCheck)
+	if err != nil {
+		log.Error("could not create db", zap.Error(err))
+		return err
+	}
+	stateDB, err := api.NewDB(dbPath, internal.MinerSectorsCheck+".state")
+	if err != nil {
+		log.Error("could not create state db", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error("failed to close database", zap.Error(err))
+		}
+		if err := stateDB.Close(); err != nil {
+			log.Error("failed to close state database", zap.Error(err))
+		}
+	}()
+	addressCache, closeAddressCache := openAddressCache(ctx, dbPath, log)
+	defer closeAddressCache()
+
+	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
+	if err != nil {
+		log.Error("could not get address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+	addresses, err := internal.ReadAddressFile(addressFile)
+	if err != nil {
+		log.Error("could not read address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+
+	start := int64(1)
+	if cmd.Flags().Changed(internal.StartFlag) {
+		startHeight, err := cmd.Flags().GetInt64(internal.StartFlag)
+		if err != nil {
+			log.Error("could not get start height", zap.Error(err), zap.Int64("start-height", startHeight))
+			return err
+		}
+		start = startHeight
+	}
+	endHeight, err := cmd.Flags().GetInt64(internal.EndFlag)
+	if err != nil {
+		log.Error("could not get end height", zap.Error(err), zap.Int64("end-height", endHeight))
+		return err
+	}
+	if endHeight < start {
+		log.Error("end height is less than start height", zap.Int64("start-height", start), zap.Int64("end-height", endHeight))
+		return errors.New("end height is less than start height")
+	}
+	checkpointInterval, err := cmd.Flags().GetInt64(internal.CheckpointIntervalFlag)
+	if err != nil {
+		log.Error("could not get checkpoint interval", zap.Error(err))
+		return err
+	}
+	if checkpointInterval <= 0 {
+		log.Error("checkpoint interval must be positive", zap.Int64("checkpoint-interval", checkpointInterval))
+		return errors.New("checkpoint interval must be positive")
+	}
+
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("could not create rpc client", zap.Error(err), zap.String("node-url", config.NodeURL))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	dataStore, err := api.GetDataStoreClient(&config)
+	if err != nil {
+		log.Error("could not create data store client", zap.Error(err))
+		return err
+	}
+
+	parser, err := fil_parser.NewFilecoinParserWithActorV2(
+		rpcClient.RosettaLib(), api.GetDataSource(network, rpcClient),
+		getParserLogger(),
+	)
+	if err != nil {
+		log.Error("failed to create parser", zap.Error(err))
+		return err
+	}
+
+	latestHeight, err := resumeHeight(cmd, db)
+	if err != nil {
+		log.Error("failed to get latest height", zap.Error(err))
+		return err
+	}
+	if latestHeight < endHeight && latestHeight > start {
+		log.Info("resuming from latest height", zap.Int64("latest-height", latestHeight))
+		start = latestHeight + 1
+	}
+
+	// sectors before any message at start is applied
+	startTipset, err := api.ChainGetTipSetByHeight(ctx, start, rpcClient)
+	if err != nil {
+		log.Error("failed to get start tipset", zap.Error(err), zap.Int64("height", start))
+		return err
+	}
+
+	minerMap := map[string]*MinerSectorsAddress{}
+	parsedAddresses := map[string]address.Address{}
+	for _, addr := range addresses {
+		parsedAddress, err := address.NewFromString(addr)
+		if err != nil {
+			log.Error("failed to parse provided address", zap.Error(err), zap.String("address", addr))
+			internal.FailProgressAddress(addr, 0, internal.FailureParse, err.Error(), db)
+			return err
+		}
+		parsedAddresses[addr] = parsedAddress
+
+		state := &types.MinerSectorsState{}
+		if err := internal.GetProgressAddressState(addr, state, stateDB); err != nil {
+			log.Error("failed to get last state", zap.Error(err), zap.String("address", addr))
+			return err
+		}
+		if state.Height != start-1 {
+			if state.Height > 0 {
+				log.Info("miner state not at resume height, loading sectors from chain", zap.String("address", addr), zap.Int64("state-height", state.Height), zap.Int64("start-height", start))
+			}
+			state, err = getMinerSectorsState(ctx, parsedAddress, start-1, startTipset, rpcClient)
+			if err != nil {
+				log.Error("failed to get onchain sectors", zap.Error(err), zap.String("address", addr))
+				return err
+			}
+		}
+
+		minerMap[addr] = &MinerSectorsAddress{
+			Address:       addr,
+			State:         state,
+			ParsedAddress: parsedAddress,
+		}
+	}
+
+	for height := start; height <= endHeight; height++ {
+		log.Info("processing height", zap.Int64("height", height))
+		data, err := api.GetTraceFromDataStore(height, dataStore, &config)
+		if err != nil {
+			log.Error("failed to get trace", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureTrace, err.Error(), db)
+			continue
+		}
+		tipset, err := api.ChainGetTipSetByHeight(ctx, height, rpcClient)
+		if err != nil {
+			log.Error("failed to get tipset", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			continue
+		}
+		// on-chain state is applied on the next tipset
+		nextTipset, err := api.ChainGetNextTipSet(ctx, tipset, rpcClient)
+		if err != nil {
+			log.Error("failed to get next tipset", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			continue
+		}
+		equivalentAddresses, allEquivalentAddresses, err := heightEquivalentAddresses(ctx, parsedAddresses, tipset, nextTipset, rpcClient, addressCache)
+		if err != nil {
+			log.Error("failed to get equivalent addresses", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			continue
+		}
+		data, err = filterTrace(network, height, allEquivalentAddresses, data)
+		if err != nil {
+			log.Error("failed to filter trace", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureParse, err.Error(), db)
+			continue
+		}
+
+		txsData := parserTypes.TxsData{
+			Traces: data,
+			Tipset: &parserTypes.ExtendedTipSet{
+				TipSet: *tipset,
+			},
+		}
+		nodeInfo := network.HeightToNodeVersion(height)
+		txsData.Metadata.NodeInfo = *nodeInfo
+
+		parsedTxData, err := parser.ParseTransactions(ctx, txsData)
+		if err != nil {
+			log.Error("failed to parse transactions", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureParse, err.Error(), db)
+			continue
+		}
+		minerEvents := &parserTypes.MinerEvents{}
+		if len(parsedTxData.Txs) > 0 {
+			minerEvents, err = parser.ParseMinerEvents(ctx, parsedTxData.Txs, parsedTxData.Txs[0].TipsetCid, tipset.Key())
+			if err != nil {
+				log.Error("failed to parse miner events", zap.Error(err), zap.Int64("height", height))
+				internal.FailProgressHeight(height, internal.FailureParse, err.Error(), db)
+				continue
+			}
+		}
+
+		checkpoint := height%checkpointInterval == 0 || height == endHeight
+		for _, addr := range addresses {
+			if equivalentAddresses[addr] == nil {
+				log.Debug("actor does not exist at height", zap.String("address", addr), zap.Int64("height", height))
+				continue
+			}
+			miner := minerMap[addr]
+			miner.EquivalentAddresses = equivalentAddresses[addr]
+			if err := applyMinerSectorEvents(height, miner.EquivalentAddresses, miner.State, minerEvents.MinerSectors); err != nil {
+				log.Error("failed to apply sector events", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureParse), err.Error(), db)
+			}
+			if checkpoint {
+				log.Info("processing address", zap.String("address", addr), zap.Int64("height", height))
+				if err := compareMinerSectors(ctx, height, miner, nextTipset, rpcClient); err != nil {
+					log.Error("miner sectors check failed", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+					internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureMismatch), err.Error(), db)
+				} else {
+					internal.UpdateProgressAddress(addr, height, true, internal.ProgressOK, db)
+				}
+			}
+			if err := internal.UpdateProgressAddressState(addr, miner.State, stateDB); err != nil {
+				log.Error("failed to update state", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+			}
+		}
+		internal.UpdateProgressHeight(height, true, internal.ProgressOK, db)
+	}
+	return nil
+}
+
+func getOnchainSectors(ctx context.Context, addr address.Address, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) (map[uint64]int64, map[uint64]bool, error) {
+	sectors, err := rpcClient.FullNodeClient().StateMinerSectors(ctx, addr, nil, tipset.Key())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get onchain miner sectors: %w", err)
+	}
+	faults, err := rpcClient.FullNodeClient().StateMinerFaults(ctx, addr, tipset.Key())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get onchain miner faults: %w", err)
+	}
+	onchainSectors := make(map[uint64]int64, len(sectors))
+	for _, sector := range sectors {
+		onchainSectors[uint64(sector.SectorNumber)] = int64(sector.Expiration)
+	}
+	onchainFaults := map[uint64]bool{}
+	if err := faults.ForEach(func(sectorNumber uint64) error {
+		onchainFaults[sectorNumber] = true
+		return nil
+	}); err != nil {
+		return nil, nil, fmt.Errorf("failed to read onchain miner faults: %w", err)
+	}
+	return onchainSectors, onchainFaults, nil
+}
+
+func getMinerSectorsState(ctx context.Context, addr address.Address, height int64, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) (*types.MinerSectorsState, error) {
+	onchainSectors, onchainFaults, err := getOnchainSectors(ctx, addr, tipset, rpcClient)
+	if err != nil {
+		return nil, err
+	}
+	state := &types.MinerSectorsState{
+		Height:  height,
+		Sectors: make(map[uint64]*types.SectorState, len(onchainSectors)),
+	}
+	for sectorNumber, expiration := range onchainSectors {
+		status := types.SectorActive
+		if onchainFaults[sectorNumber] {
+			status = types.SectorFaulty
+		}
+		state.Sectors[sectorNumber] = &types.SectorState{Status: status, Expiration: expiration}
+	}
+	return state, nil
+}
+
+func compareMinerSectors(ctx context.Context, height int64, miner *MinerSectorsAddress, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) error {
+	onchainSectors, onchainFaults, err := getOnchainSectors(ctx, miner.ParsedAddress, tipset, rpcClient)
+	if err != nil {
+		return internal.Failure(internal.FailureNode, err)
+	}
+	diff := reconcileMinerSectors(height, miner.State, onchainSectors, onchainFaults)
+	if diff.empty() {
+		return nil
+	}
+	return fmt.Errorf("sector mismatch for %s at height %d: lost=%s, invented=%s, not faulty=%s", miner.Address, height, formatSectors(diff.Lost), formatSectors(diff.Invented), formatSectors(diff.NotFaulty))
+}
+
+// reconcileMinerSectors compares the sectors rebuilt from the traces with the chain and syncs the state
+// so every mismatch is only reported once. Expirations and fault-driven terminations are processed by
+// cron and are not part of the traces, so sectors past their expiration or faulty are allowed to disappear.
+func reconcileMinerSectors(height int64, state *types.MinerSectorsState, onchainSectors map[uint64]int64, onchainFaults map[uint64]bool) sectorDiff {
+	diff := sectorDiff{}
+	if state.Sectors == nil {
+		state.Sectors = map[uint64]*types.SectorState{}
+	}
+
+	for sectorNumber, expiration := range onchainSectors {
+		sector, ok := state.Sectors[sectorNumber]
+		if !ok || sector.Status == types.SectorPreCommitted {
+			diff.Lost = append(diff.Lost, sectorNumber)
+			sector = &types.SectorState{Status: types.SectorActive}
+			state.Sectors[sectorNumber] = sector
+		}
+		sector.Expiration = expiration
+		switch {
+		case onchainFaults[sectorNumber]:
+			// faults can also be detected by cron on a missed window post
+			sector.Status = types.SectorFaulty
+		case sector.Status == types.SectorFaulty:
+			diff.NotFaulty = append(diff.NotFaulty, sectorNumber)
+			sector.Status = types.SectorActive
+		case sector.Status == types.SectorRecovering:
+			sector.Status = types.SectorActive
+		}
+	}
+
+	for sectorNumber, sector := range state.Sectors {
+		if _, ok := onchainSectors[sectorNumber]; ok || sector.Status == types.SectorPreCommitted {
+			continue
+		}
+		expired := sector.Expiration > 0 && sector.Expiration <= height
+		terminated := sector.Status == types.SectorFaulty || sector.Status == types.SectorRecovering
+		if !expired && !terminated {
+			diff.Invented = append(diff.Invented, sectorNumber)
+		}
+		delete(state.Sectors, sectorNumber)
+	}
+
+	for _, sectors := range [][]uint64{diff.Lost, diff.Invented, diff.NotFaulty} {
+		sort.Slice(sectors, func(i, j int) bool { return sectors[i] < sectors[j] })
+	}
+	return diff
+}
+
+func applyMinerSectorEvents(height int64, equivalentAddresses map[string]bool, sectorsState *types.MinerSectorsState, events []*parserTypes.MinerSectorEvent) error {
+	if sectorsState.Sectors == nil {
+		sectorsState.Sectors = map[uint64]*types.SectorState{}
+	}
+	for _, event := range events {
+		if !equivalentAddresses[event.MinerAddress] {
+			continue
+		}
+		data := types.SectorEventData{}
+		if event.Data != "" {
+			if err := json.Unmarshal([]byte(event.Data), &data); err != nil {
+				return fmt.Errorf("failed to parse %s sector event(%s): %w", event.ActionType, event.Data, err)
+			}
+		}
+		sector, tracked := sectorsState.Sectors[event.SectorNumber]
+		if !tracked {
+			sector = &types.SectorState{}
+		}
+
+		switch event.ActionType {
+		case parser.MethodPreCommitSector, parser.MethodPreCommitSectorBatch, parser.MethodPreCommitSectorBatch2:
+			sector.Status = types.SectorPreCommitted
+			sector.Expiration = data.Expiration
+		case parser.MethodProveCommitSector, parser.MethodProveCommitAggregate, parser.MethodConfirmSectorProofsValid, parser.MethodProveCommitSectors3:
+			sector.Status = types.SectorActive
+		case parser.MethodProveCommitSectorsNI:
+			// non-interactive porep has no pre-commit
+			sector.Status = types.SectorActive
+			sector.Expiration = data.Expiration
+		case parser.MethodTerminateSectors:
+			delete(sectorsState.Sectors, event.SectorNumber)
+			continue
+		case parser.MethodDeclareFaults:
+			sector.Status = types.SectorFaulty
+		case parser.MethodDeclareFaultsRecovered:
+			if sector.Status != types.SectorFaulty {
+				continue
+			}
+			sector.Status = types.SectorRecovering
+		case parser.MethodExtendSectorExpiration, parser.MethodExtendSectorExpiration2:
+			if !tracked {
+				continue
+			}
+			sector.Expiration = data.NewExpiration
+		default:
+			continue
+		}
+		sectorsState.Sectors[event.SectorNumber] = sector
+	}
+	sectorsState.Height = height
+	return nil
+}
+
+func formatSectors(sectors []uint64) string {
+	if len(sectors) == 0 {
+		return "[]"
+	}
+	shown := sectors
+	if len(shown) > maxReportedSectors {
+		shown = shown[:maxReportedSectors]
+	}
+	parts := make([]string, 0, len(shown))
+	for _, sector := range shown {
+		parts = append(parts, fmt.Sprint(sector))
+	}
+	if len(shown) < len(sectors) {
+		return fmt.Sprintf("[%s ...](%d total)", strings.Join(parts, " "), len(sectors))
+	}
+	return fmt.Sprintf("[%s]", strings.Join(parts, " "))
+}
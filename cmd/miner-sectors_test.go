@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	parserTypes "github.com/zondax/fil-parser/types"
+	types "github.com/zondax/fil-trace-check/internal/types"
+)
+
+func TestApplyMinerSectorEvents(t *testing.T) {
+	tests := []struct {
+		name            string
+		initialSectors  map[uint64]*types.SectorState
+		events          []*parserTypes.MinerSectorEvent
+		expectedSectors map[uint64]*types.SectorState
+	}{
+		{
+			name: "pre-commit and prove-commit activates sector",
+			events: []*parserTypes.MinerSectorEvent{
+				{MinerAddress: "f01234", SectorNumber: 1, ActionType: "PreCommitSectorBatch2", Data: `{"SectorNumber":1,"Expiration":5000,"SectorSize":34359738368,"DealIDs":[]}`},
+				{MinerAddress: "f01234", SectorNumber: 2, ActionType: "PreCommitSectorBatch2", Data: `{"SectorNumber":2,"Expiration":6000,"SectorSize":34359738368,"DealIDs":[]}`},
+				{MinerAddress: "f01234", SectorNumber: 1, ActionType: "ProveCommitAggregate", Data: `{"SectorNumbers":[1]}`},
+			},
+			expectedSectors: map[uint64]*types.SectorState{
+				1: {Status: types.SectorActive, Expiration: 5000},
+				2: {Status: types.SectorPreCommitted, Expiration: 6000},
+			},
+		},
+		{
+			name: "non-interactive prove-commit activates sector without pre-commit",
+			events: []*parserTypes.MinerSectorEvent{
+				{MinerAddress: "f01234", SectorNumber: 7, ActionType: "ProveCommitSectorsNI", Data: `{"SectorNumber":7,"SealerID":1234,"Expiration":9000}`},
+			},
+			expectedSectors: map[uint64]*types.SectorState{
+				7: {Status: types.SectorActive, Expiration: 9000},
+			},
+		},
+		{
+			name: "faults, recoveries, extensions and terminations",
+			initialSectors: map[uint64]*types.SectorState{
+				1: {Status: types.SectorActive, Expiration: 5000},
+				2: {Status: types.SectorActive, Expiration: 5000},
+				3: {Status: types.SectorActive, Expiration: 5000},
+				4: {Status: types.SectorFaulty, Expiration: 5000},
+			},
+			events: []*parserTypes.MinerSectorEvent{
+				{MinerAddress: "f01234", SectorNumber: 1, ActionType: "DeclareFaults", Data: `{"Deadline":1,"Partition":0}`},
+				{MinerAddress: "f01234", SectorNumber: 2, ActionType: "ExtendSectorExpiration2", Data: `{"NewExpiration":8000}`},
+				{MinerAddress: "f01234", SectorNumber: 3, ActionType: "TerminateSectors", Data: `{"Deadline":1,"Partition":0}`},
+				{MinerAddress: "f01234", SectorNumber: 4, ActionType: "DeclareFaultsRecovered", Data: `{"Deadline":1,"Partition":0}`},
+			},
+			expectedSectors: map[uint64]*types.SectorState{
+				1: {Status: types.SectorFaulty, Expiration: 5000},
+				2: {Status: types.SectorActive, Expiration: 8000},
+				4: {Status: types.SectorRecovering, Expiration: 5000},
+			},
+		},
+		{
+			name: "events for other miners are ignored",
+			initialSectors: map[uint64]*types.SectorState{
+				1: {Status: types.SectorActive, Expiration: 5000},
+			},
+			events: []*parserTypes.MinerSectorEvent{
+				{MinerAddress: "f09999", SectorNumber: 1, ActionType: "TerminateSectors", Data: `{}`},
+				{MinerAddress: "f09999", SectorNumber: 2, ActionType: "PreCommitSector", Data: `{"Expiration":5000}`},
+			},
+			expectedSectors: map[uint64]*types.SectorState{
+				1: {Status: types.SectorActive, Expiration: 5000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &types.MinerSectorsState{Sectors: map[uint64]*types.SectorState{}}
+			for sectorNumber, sector := range tt.initialSectors {
+				state.Sectors[sectorNumber] = &types.SectorState{Status: sector.Status, Expiration: sector.Expiration}
+			}
+
+			err := applyMinerSectorEvents(10, map[string]bool{"f01234": true}, state, tt.events)
+			require.NoError(t, err)
+
+			assert.Equal(t, int64(10), state.Height)
+			assert.Equal(t, tt.expectedSectors, state.Sectors)
+		})
+	}
+
+	t.Run("invalid event data", func(t *testing.T) {
+		state := &types.MinerSectorsState{}
+		err := applyMinerSectorEvents(10, map[string]bool{"f01234": true}, state, []*parserTypes.MinerSectorEvent{
+			{MinerAddress: "f01234", SectorNumber: 1, ActionType: "PreCommitSector", Data: `{"Expiration":"abc"}`},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestReconcileMinerSectors(t *testing.T) {
+	state := &types.MinerSectorsState{
+		Height: 100,
+		Sectors: map[uint64]*types.SectorState{
+			// healthy on both sides
+			1: {Status: types.SectorActive, Expiration: 5000},
+			// pre-commit never proven in the traces
+			2: {Status: types.SectorPreCommitted, Expiration: 5000},
+			// declared faulty but healthy on chain
+			3: {Status: types.SectorFaulty, Expiration: 5000},
+			// recovered on chain
+			4: {Status: types.SectorRecovering, Expiration: 5000},
+			// expired
+			5: {Status: types.SectorActive, Expiration: 90},
+			// terminated by cron after a long fault
+			6: {Status: types.SectorFaulty, Expiration: 5000},
+			// not on chain
+			7: {Status: types.SectorActive, Expiration: 5000},
+			// pending pre-commit
+			8: {Status: types.SectorPreCommitted, Expiration: 5000},
+		},
+	}
+	onchainSectors := map[uint64]int64{
+		1:  6000,
+		2:  5000,
+		3:  5000,
+		4:  5000,
+		9:  5000,
+		10: 5000,
+	}
+	onchainFaults := map[uint64]bool{10: true}
+
+	diff := reconcileMinerSectors(100, state, onchainSectors, onchainFaults)
+	assert.Equal(t, []uint64{2, 9, 10}, diff.Lost)
+	assert.Equal(t, []uint64{7}, diff.Invented)
+	assert.Equal(t, []uint64{3}, diff.NotFaulty)
+
+	assert.Equal(t, map[uint64]*types.SectorState{
+		1:  {Status: types.SectorActive, Expiration: 6000},
+		2:  {Status: types.SectorActive, Expiration: 5000},
+		3:  {Status: types.SectorActive, Expiration: 5000},
+		4:  {Status: types.SectorActive, Expiration: 5000},
+		8:  {Status: types.SectorPreCommitted, Expiration: 5000},
+		9:  {Status: types.SectorActive, Expiration: 5000},
+		10: {Status: types.SectorFaulty, Expiration: 5000},
+	}, state.Sectors)
+
+	// mismatches are reported only once
+	diff = reconcileMinerSectors(100, state, onchainSectors, onchainFaults)
+	assert.True(t, diff.empty())
+}
@@ -25,6 +25,7 @@ func ValidateMultisigStateSequentialCmd() *cobra.Command {
 
 	cmd.Flags().String(internal.AddressFileFlag, "", "path to a newline separated address file for addresses to check state")
 	cmd.Flags().String(internal.DBPathFlag, ".", "path to a db file")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
 	cmd.Flags().Int64(internal.StartFlag, 1, "optional start height to validate")
 	cmd.Flags().Int64(internal.EndFlag, 100, "end height")
 	return cmd
@@ -42,6 +43,15 @@ func validateMultisigStateSequential(cmd *cobra.Command) error {
 	config := api.GetGlobalConfigs()
 	log := initLogger()
 	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("could not get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
 
 	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
 	if err != nil {
@@ -66,6 +76,8 @@ func validateMultisigStateSequential(cmd *cobra.Command) error {
 			log.Error("failed to close state database", zap.Error(err))
 		}
 	}()
+	addressCache, closeAddressCache := openAddressCache(ctx, dbPath, log)
+	defer closeAddressCache()
 
 	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
 	if err != nil {
@@ -97,11 +109,12 @@ func validateMultisigStateSequential(cmd *cobra.Command) error {
 		return errors.New("end height is less than start height")
 	}
 
-	rpcClient, err := api.NewFilecoinRPCClient(ctx, config.NodeURL, config.NodeToken)
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
 	if err != nil {
 		log.Error("failed to get rpc client", zap.Error(err))
 		return err
 	}
+	defer closeRPCClient(rpcClient)
 	dataStore, err := api.GetDataStoreClient(&config)
 	if err != nil {
 		log.Error("failed to get data store client", zap.Error(err))
@@ -109,7 +122,7 @@ func validateMultisigStateSequential(cmd *cobra.Command) error {
 	}
 
 	parser, err := fil_parser.NewFilecoinParserWithActorV2(
-		rpcClient.RosettaLib(), api.GetDataSource(&config, rpcClient),
+		rpcClient.RosettaLib(), api.GetDataSource(network, rpcClient),
 		getParserLogger(),
 	)
 	if err != nil {
@@ -117,30 +130,22 @@ func validateMultisigStateSequential(cmd *cobra.Command) error {
 		return err
 	}
 
-	latestHeight, err := db.GetLatestHeight()
+	latestHeight, err := resumeHeight(cmd, db)
 	if err != nil {
 		log.Error("failed to get latest height", zap.Error(err))
 		return err
 	}
 
 	addressMap := map[string]*MsigAddress{}
-	// all addresses equivalent addresses used for filtering the traces
-	allEquivalentAddresses := map[string]bool{}
+	parsedAddresses := map[string]address.Address{}
 	for _, addr := range addresses {
 		parsedAddress, err := address.NewFromString(addr)
 		if err != nil {
 			log.Error("failed to parse provided address", zap.Error(err), zap.String("address", addr))
-			internal.UpdateProgressAddress(addr, 0, false, err.Error(), db)
+			internal.FailProgressAddress(addr, 0, internal.FailureParse, err.Error(), db)
 			return err
 		}
-		equivalentAddresses, err := internal.GetEquivalentAddresses(ctx, parsedAddress, rpcClient.FullNodeClient())
-		if err != nil {
-			log.Error("failed to get equivalent addresses", zap.Error(err), zap.String("address", addr))
-			return err
-		}
-		for equivalentAddress := range equivalentAddresses {
-			allEquivalentAddresses[equivalentAddress] = true
-		}
+		parsedAddresses[addr] = parsedAddress
 		actor, err := rpcClient.FullNodeClient().StateGetActor(ctx, parsedAddress, filTypes.EmptyTSK)
 		if err != nil {
 			log.Error("failed to get onchain actor", zap.Error(err), zap.String("address", addr))
@@ -159,11 +164,10 @@ func validateMultisigStateSequential(cmd *cobra.Command) error {
 			latestHeight = start
 		}
 		address := MsigAddress{
-			Address:             addr,
-			Actor:               actor,
-			ParsedAddress:       parsedAddress,
-			State:               state,
-			EquivalentAddresses: equivalentAddresses,
+			Address:       addr,
+			Actor:         actor,
+			ParsedAddress: parsedAddress,
+			State:         state,
 		}
 		addressMap[addr] = &address
 	}
@@ -178,26 +182,32 @@ func validateMultisigStateSequential(cmd *cobra.Command) error {
 		data, err := api.GetTraceFromDataStore(height, dataStore, &config)
 		if err != nil {
 			log.Error("failed to get trace", zap.Error(err), zap.Int64("height", height))
-			internal.UpdateProgressHeight(height, false, err.Error(), db)
-			continue
-		}
-		data, err = filterTrace(height, allEquivalentAddresses, data)
-		if err != nil {
-			log.Error("failed to filter trace", zap.Error(err), zap.Int64("height", height))
-			internal.UpdateProgressHeight(height, false, err.Error(), db)
+			internal.FailProgressHeight(height, internal.FailureTrace, err.Error(), db)
 			continue
 		}
 		tipset, err := api.ChainGetTipSetByHeight(ctx, height, rpcClient)
 		if err != nil {
 			log.Error("failed to get onchain tipset", zap.Error(err), zap.Int64("height", height))
-			internal.UpdateProgressHeight(height, false, err.Error(), db)
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
 			continue
 		}
 		// on-chain state is applied on the next tipset
-		nextTipset, err := api.ChainGetTipSetByHeight(ctx, height+1, rpcClient)
+		nextTipset, err := api.ChainGetNextTipSet(ctx, tipset, rpcClient)
 		if err != nil {
 			log.Error("failed to get next onchain tipset", zap.Error(err), zap.Int64("height", height))
-			internal.UpdateProgressHeight(height, false, err.Error(), db)
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			continue
+		}
+		equivalentAddresses, allEquivalentAddresses, err := heightEquivalentAddresses(ctx, parsedAddresses, tipset, nextTipset, rpcClient, addressCache)
+		if err != nil {
+			log.Error("failed to get equivalent addresses", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			continue
+		}
+		data, err = filterTrace(network, height, allEquivalentAddresses, data)
+		if err != nil {
+			log.Error("failed to filter trace", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureParse, err.Error(), db)
 			continue
 		}
 
@@ -207,13 +217,13 @@ func validateMultisigStateSequential(cmd *cobra.Command) error {
 				TipSet: *tipset,
 			},
 		}
-		nodeInfo := api.HeightToNodeVersion(height)
+		nodeInfo := network.HeightToNodeVersion(height)
 		txsData.Metadata.NodeInfo = *nodeInfo
 
 		parsedTxData, err := parser.ParseTransactions(ctx, txsData)
 		if err != nil {
 			log.Error("failed to parse transactions", zap.Error(err), zap.Int64("height", height))
-			internal.UpdateProgressHeight(height, false, err.Error(), db)
+			internal.FailProgressHeight(height, internal.FailureParse, err.Error(), db)
 			continue
 		}
 		if len(parsedTxData.Txs) == 0 {
@@ -222,14 +232,19 @@ func validateMultisigStateSequential(cmd *cobra.Command) error {
 		msigEvents, err := parser.ParseMultisigEvents(ctx, parsedTxData.Txs, parsedTxData.Txs[0].TipsetCid, tipset.Key())
 		if err != nil {
 			log.Error("failed to parse multisig events", zap.Error(err), zap.Int64("height", height))
-			internal.UpdateProgressHeight(height, false, err.Error(), db)
+			internal.FailProgressHeight(height, internal.FailureParse, err.Error(), db)
 			continue
 		}
 		for _, addr := range addresses {
+			if equivalentAddresses[addr] == nil {
+				log.Debug("actor does not exist at height", zap.String("address", addr), zap.Int64("height", height))
+				continue
+			}
+			addressMap[addr].EquivalentAddresses = equivalentAddresses[addr]
 			log.Info("processing address", zap.String("address", addr), zap.Int64("height", height))
-			if err := compareMultisigAddress(ctx, height, addressMap[addr], msigEvents, nextTipset, rpcClient); err != nil {
+			if err := compareMultisigAddress(ctx, height, addressMap[addr], msigEvents, nextTipset, rpcClient, addressCache); err != nil {
 				log.Error("multisig state check failed", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureMismatch), err.Error(), db)
 			} else {
 				internal.UpdateProgressAddress(addr, height, true, internal.ProgressOK, db)
 			}
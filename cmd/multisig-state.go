@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 
@@ -29,8 +30,12 @@ func ValidateMultisigStateCmd() *cobra.Command {
 
 	cmd.Flags().String(internal.AddressFileFlag, "", "path to a newline separated address file for addresses to check state")
 	cmd.Flags().String(internal.DBPathFlag, ".", "path to a db file")
-	cmd.Flags().String(internal.EventProviderFlag, "beryx", "event provider to use")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
+	cmd.Flags().String(internal.EventProviderFlag, types.EventProviderBeryx, "event provider to use (beryx, trace-index, lotus)")
 	cmd.Flags().String(internal.EventProviderTokenFlag, "", "event provider token")
+	cmd.Flags().Int64(internal.EventStartFlag, 0, "start height of the event provider range, required by lotus")
+	cmd.Flags().Int64(internal.EventEndFlag, 0, "end height of the event provider range, required by lotus")
+	cmd.Flags().Bool(internal.ActorEventsFlag, false, "also use actor event emitters in the lotus event provider")
 	return cmd
 }
 
@@ -38,6 +43,15 @@ func validateMultisigState(cmd *cobra.Command) error {
 	config := api.GetGlobalConfigs()
 	log := initLogger()
 	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("failed to get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
 
 	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
 	if err != nil {
@@ -62,6 +76,8 @@ func validateMultisigState(cmd *cobra.Command) error {
 			log.Error("failed to close state db", zap.Error(err))
 		}
 	}()
+	addressCache, closeAddressCache := openAddressCache(ctx, dbPath, log)
+	defer closeAddressCache()
 
 	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
 	if err != nil {
@@ -78,9 +94,24 @@ func validateMultisigState(cmd *cobra.Command) error {
 		log.Error("failed to get event provider token", zap.Error(err))
 		return err
 	}
-	eventProvider, err := types.NewEventProvider(eventProvideName, eventProviderToken)
+	eventStart, err := cmd.Flags().GetInt64(internal.EventStartFlag)
 	if err != nil {
-		log.Error("failed to create event provider", zap.Error(err))
+		log.Error("failed to get event start", zap.Error(err))
+		return err
+	}
+	eventEnd, err := cmd.Flags().GetInt64(internal.EventEndFlag)
+	if err != nil {
+		log.Error("failed to get event end", zap.Error(err))
+		return err
+	}
+	actorEvents, err := cmd.Flags().GetBool(internal.ActorEventsFlag)
+	if err != nil {
+		log.Error("failed to get actor events", zap.Error(err))
+		return err
+	}
+	noResume, err := cmd.Flags().GetBool(internal.NoResumeFlag)
+	if err != nil {
+		log.Error("failed to get no resume", zap.Error(err))
 		return err
 	}
 	addresses, err := internal.ReadAddressFile(addressFile)
@@ -89,11 +120,31 @@ func validateMultisigState(cmd *cobra.Command) error {
 		return err
 	}
 
-	rpcClient, err := api.NewFilecoinRPCClient(ctx, config.NodeURL, config.NodeToken)
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
 	if err != nil {
 		log.Error("failed to get rpc client", zap.Error(err))
 		return err
 	}
+	defer closeRPCClient(rpcClient)
+	eventProvider, err := types.NewEventProvider(eventProvideName, types.EventProviderOptions{
+		Token:       eventProviderToken,
+		Network:     network,
+		IndexPath:   dbPath,
+		Resolver:    equivalentAddressResolver(rpcClient),
+		RPCClient:   rpcClient,
+		Start:       eventStart,
+		End:         eventEnd,
+		ActorEvents: actorEvents,
+	})
+	if err != nil {
+		log.Error("failed to create event provider", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := eventProvider.Close(); err != nil {
+			log.Error("failed to close event provider", zap.Error(err))
+		}
+	}()
 	dataStore, err := api.GetDataStoreClient(&config)
 	if err != nil {
 		log.Error("failed to get data store client", zap.Error(err))
@@ -101,7 +152,7 @@ func validateMultisigState(cmd *cobra.Command) error {
 	}
 
 	parser, err := fil_parser.NewFilecoinParserWithActorV2(
-		rpcClient.RosettaLib(), api.GetDataSource(&config, rpcClient),
+		rpcClient.RosettaLib(), api.GetDataSource(network, rpcClient),
 		getParserLogger(),
 	)
 	if err != nil {
@@ -109,40 +160,51 @@ func validateMultisigState(cmd *cobra.Command) error {
 		return err
 	}
 
-	for _, addr := range addresses {
-		log.Debug(fmt.Sprintf("Validating multisig state for address %s", addr))
-		parsedAddr, err := address.NewFromString(addr)
+	// a bounded range starts from the chain state before any message at event-start is applied, the events before
+	// it are not validated
+	var startTipset *filTypes.TipSet
+	if eventStart > 0 {
+		startTipset, err = api.ChainGetTipSetByHeight(ctx, eventStart, rpcClient)
 		if err != nil {
-			internal.UpdateProgressAddress(addr, 0, false, err.Error(), db)
-			continue
+			log.Error("failed to get start tipset", zap.Error(err), zap.Int64("height", eventStart))
+			return err
 		}
+	}
 
-		actor, err := rpcClient.FullNodeClient().StateGetActor(ctx, parsedAddr, filTypes.EmptyTSK)
+	for _, addr := range addresses {
+		log.Debug(fmt.Sprintf("Validating multisig state for address %s", addr))
+		parsedAddr, err := address.NewFromString(addr)
 		if err != nil {
-			log.Error("failed to get onchain actor", zap.Error(err), zap.String("address", addr))
-			internal.UpdateProgressAddress(addr, 0, false, err.Error(), db)
+			internal.FailProgressAddress(addr, 0, internal.FailureParse, err.Error(), db)
 			continue
 		}
 
 		heights, err := eventProvider.GetAddressEventHeights(ctx, addr)
 		if err != nil {
 			log.Error("failed to get onchain address events", zap.Error(err), zap.String("address", addr))
-			internal.UpdateProgressAddress(addr, 0, false, err.Error(), db)
-			continue
-		}
-		equivalentAddresses, err := internal.GetEquivalentAddresses(ctx, parsedAddr, rpcClient.FullNodeClient())
-		if err != nil {
-			log.Error("failed to get equivalent addresses", zap.Error(err), zap.String("address", addr))
-			internal.UpdateProgressAddress(addr, 0, false, err.Error(), db)
+			internal.FailProgressAddress(addr, 0, internal.FailureNode, err.Error(), db)
 			continue
 		}
 
 		processedHeights := map[int64]bool{}
 		// try load state
 		state := &types.MultisigState{}
-		err = internal.GetProgressAddressState(addr, state, stateDB)
-		if err != nil {
-			log.Error("failed to get last state", zap.Error(err), zap.String("address", addr))
+		if !noResume {
+			err = internal.GetProgressAddressState(addr, state, stateDB)
+			if err != nil {
+				log.Error("failed to get last state", zap.Error(err), zap.String("address", addr))
+			}
+		}
+		if startTipset != nil && state.Height < eventStart {
+			if state.Height > 0 {
+				log.Info("multisig state before event start, loading state from chain", zap.String("address", addr), zap.Int64("state-height", state.Height), zap.Int64("event-start", eventStart))
+			}
+			state, err = getMultisigState(ctx, parsedAddr, eventStart-1, startTipset, rpcClient, addressCache)
+			if err != nil {
+				log.Error("failed to get onchain multisig state", zap.Error(err), zap.String("address", addr))
+				internal.FailProgressAddress(addr, 0, internal.FailureNode, err.Error(), db)
+				continue
+			}
 		}
 
 		if state.Height > 0 {
@@ -154,11 +216,9 @@ func validateMultisigState(cmd *cobra.Command) error {
 		}
 
 		msigAddress := &MsigAddress{
-			Address:             addr,
-			Actor:               actor,
-			ParsedAddress:       parsedAddr,
-			State:               state,
-			EquivalentAddresses: equivalentAddresses,
+			Address:       addr,
+			ParsedAddress: parsedAddr,
+			State:         state,
 		}
 		lastHeight := int64(0)
 		for _, height := range heights {
@@ -169,29 +229,39 @@ func validateMultisigState(cmd *cobra.Command) error {
 			data, err := api.GetTraceFromDataStore(height, dataStore, &config)
 			if err != nil {
 				log.Error("failed to get trace", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
-				continue
-			}
-
-			data, err = filterTrace(height, msigAddress.EquivalentAddresses, data)
-			if err != nil {
-				log.Error("failed to filter trace", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureTrace, err.Error(), db)
 				continue
 			}
 
 			tipset, err := api.ChainGetTipSetByHeight(ctx, height, rpcClient)
 			if err != nil {
 				log.Error("failed to get onchain tipset", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
 				continue
 			}
 
 			// on-chain state is applied on the next tipset
-			nextTipset, err := api.ChainGetTipSetByHeight(ctx, height+1, rpcClient)
+			nextTipset, err := api.ChainGetNextTipSet(ctx, tipset, rpcClient)
 			if err != nil {
 				log.Error("failed to get onchain tipset", zap.Error(err), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
+				continue
+			}
+			equivalentAddresses, err := equivalentAddressesAt(ctx, parsedAddr, tipset, nextTipset, rpcClient, addressCache)
+			if errors.Is(err, internal.ErrActorNotFound) {
+				log.Warn("actor does not exist at event height", zap.String("address", addr), zap.Int64("height", height))
+				continue
+			}
+			if err != nil {
+				log.Error("failed to get equivalent addresses", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
+				continue
+			}
+			msigAddress.EquivalentAddresses = equivalentAddresses
+			data, err = filterTrace(network, height, msigAddress.EquivalentAddresses, data)
+			if err != nil {
+				log.Error("failed to filter trace", zap.Error(err), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureParse, err.Error(), db)
 				continue
 			}
 
@@ -201,13 +271,13 @@ func validateMultisigState(cmd *cobra.Command) error {
 					TipSet: *tipset,
 				},
 			}
-			nodeInfo := api.HeightToNodeVersion(height)
+			nodeInfo := network.HeightToNodeVersion(height)
 			txsData.Metadata.NodeInfo = *nodeInfo
 
 			parsedTxData, err := parser.ParseTransactions(ctx, txsData)
 			if err != nil {
 				log.Error("failed to parse transactions", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureParse, err.Error(), db)
 				continue
 			}
 
@@ -218,12 +288,12 @@ func validateMultisigState(cmd *cobra.Command) error {
 			msigEvents, err := parser.ParseMultisigEvents(ctx, parsedTxData.Txs, parsedTxData.Txs[0].TipsetCid, tipset.Key())
 			if err != nil {
 				log.Error("failed to parse multisig events", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureParse, err.Error(), db)
 				continue
 			}
-			if err := compareMultisigAddress(ctx, height, msigAddress, msigEvents, nextTipset, rpcClient); err != nil {
+			if err := compareMultisigAddress(ctx, height, msigAddress, msigEvents, nextTipset, rpcClient, addressCache); err != nil {
 				log.Error("failed to compare multisig state", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
-				internal.UpdateProgressAddress(addr, height, false, err.Error(), db)
+				internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureMismatch), err.Error(), db)
 			} else {
 				internal.UpdateProgressAddress(addr, height, true, internal.ProgressOK, db)
 			}
@@ -238,37 +308,81 @@ func validateMultisigState(cmd *cobra.Command) error {
 	return nil
 }
 
-func compareMultisigAddress(ctx context.Context, height int64, addr *MsigAddress, msigEvents *parserTypes.MultisigEvents, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) error {
-	if err := applyMultisigStateFromEvents(ctx, height, addr.State, msigEvents.MultisigInfo, rpcClient); err != nil {
-		return fmt.Errorf("failed to apply multisig state from events")
-
+// getMultisigState returns the multisig state of addr in the state of tipset, at height. A multisig created later
+// has no state yet.
+func getMultisigState(ctx context.Context, addr address.Address, height int64, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface, cache *internal.AddressCache) (*types.MultisigState, error) {
+	exists, err := actorExistsAt(ctx, addr, tipset, rpcClient, cache)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return &types.MultisigState{Height: height}, nil
 	}
-	msigOnChainState, err := rpcClient.FullNodeClient().StateReadState(ctx, addr.ParsedAddress, tipset.Key())
+	state, err := readMultisigState(ctx, addr, tipset, rpcClient)
 	if err != nil {
-		return fmt.Errorf("failed to read state: %s", err)
+		return nil, err
 	}
+	state.Height = height
+	return state, nil
+}
 
-	onChainState := msigOnChainState.State.(map[string]interface{})
+// readMultisigState reads the signers, locked balance and unlock duration of the multisig addr in the state of tipset
+func readMultisigState(ctx context.Context, addr address.Address, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) (*types.MultisigState, error) {
+	msigOnChainState, err := rpcClient.FullNodeClient().StateReadState(ctx, addr, tipset.Key())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %s", err)
+	}
+
+	onChainState, ok := msigOnChainState.State.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to decode multisig state")
+	}
 
 	onChainUnlockDurationRaw, ok := onChainState["UnlockDuration"].(float64)
 	if !ok {
-		return fmt.Errorf("failed to get unlock duration")
+		return nil, fmt.Errorf("failed to get unlock duration")
 	}
-	onChainUnlockDuration := int64(onChainUnlockDurationRaw)
 
 	onChainSigners, ok := onChainState["Signers"].([]any)
 	if !ok {
-		return fmt.Errorf("failed to get signers")
+		return nil, fmt.Errorf("failed to get signers")
+	}
+	signers := make([]string, 0, len(onChainSigners))
+	for _, signer := range onChainSigners {
+		signerAddr, ok := signer.(string)
+		if !ok {
+			return nil, fmt.Errorf("failed to get signer address")
+		}
+		signers = append(signers, signerAddr)
 	}
 
 	onChainLockedBalanceStr, ok := onChainState["InitialBalance"].(string)
 	if !ok {
-		return fmt.Errorf("failed to get locked balance")
+		return nil, fmt.Errorf("failed to get locked balance")
 	}
 	onChainLockedBalance, ok := big.NewInt(0).SetString(onChainLockedBalanceStr, 10)
 	if !ok {
-		return fmt.Errorf("failed to paarse locked balance")
+		return nil, fmt.Errorf("failed to parse locked balance")
+	}
+
+	return &types.MultisigState{
+		Signers:        signers,
+		LockedBalance:  onChainLockedBalance.String(),
+		UnlockDuration: int64(onChainUnlockDurationRaw),
+	}, nil
+}
+
+func compareMultisigAddress(ctx context.Context, height int64, addr *MsigAddress, msigEvents *parserTypes.MultisigEvents, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface, addressCache *internal.AddressCache) error {
+	if err := applyMultisigStateFromEvents(ctx, height, tipset, addr.State, msigEvents.MultisigInfo, rpcClient, addressCache); err != nil {
+		return internal.Failure(internal.FailureParse, fmt.Errorf("failed to apply multisig state from events: %w", err))
+	}
+	onChainState, err := readMultisigState(ctx, addr.ParsedAddress, tipset, rpcClient)
+	if err != nil {
+		return internal.Failure(internal.FailureNode, err)
 	}
+	onChainUnlockDuration := onChainState.UnlockDuration
+	onChainSigners := onChainState.Signers
+	onChainLockedBalance := onChainState.LockedBalance
 
 	// check we have the same number of signers
 	if len(addr.State.Signers) != len(onChainSigners) {
@@ -278,16 +392,15 @@ func compareMultisigAddress(ctx context.Context, height int64, addr *MsigAddress
 	// check that the signers are the same ( including equivalent addresses )
 	onChainSignerMap := map[string]bool{}
 	for _, signer := range onChainSigners {
-		// onChainSignerMap[signer.String()] = true
-		onChainSignerMap[signer.(string)] = true
-		signerAddr, err := address.NewFromString(signer.(string))
+		onChainSignerMap[signer] = true
+		signerAddr, err := address.NewFromString(signer)
 		if err != nil {
-			return fmt.Errorf("failed to parse signer address: %s : %w", signer.(string), err)
+			return internal.Failure(internal.FailureParse, fmt.Errorf("failed to parse signer address: %s : %w", signer, err))
 		}
 		// get equivalent addresses for the signer
-		equivalentAddresses, err := internal.GetEquivalentAddresses(ctx, signerAddr, rpcClient.FullNodeClient())
+		equivalentAddresses, err := internal.GetEquivalentAddressesAt(ctx, signerAddr, tipset, rpcClient.FullNodeClient(), addressCache)
 		if err != nil {
-			return fmt.Errorf("failed to get equivalent addresses for signer: %s :%w", signerAddr.String(), err)
+			return internal.Failure(internal.FailureNode, fmt.Errorf("failed to get equivalent addresses for signer: %s :%w", signerAddr.String(), err))
 
 		}
 		for equivalentAddress := range equivalentAddresses {
@@ -312,8 +425,8 @@ func compareMultisigAddress(ctx context.Context, height int64, addr *MsigAddress
 	if addr.State.LockedBalance == "" {
 		addr.State.LockedBalance = big.NewInt(0).String()
 	}
-	if addr.State.LockedBalance != onChainLockedBalance.String() {
-		return fmt.Errorf("multisig locked balance mismatch for %s at height: %d: onchain=%s, parsed=%s", addr.Address, tipset.Height(), onChainLockedBalance.String(), addr.State.LockedBalance)
+	if addr.State.LockedBalance != onChainLockedBalance {
+		return fmt.Errorf("multisig locked balance mismatch for %s at height: %d: onchain=%s, parsed=%s", addr.Address, tipset.Height(), onChainLockedBalance, addr.State.LockedBalance)
 	}
 
 	if addr.State.UnlockDuration != onChainUnlockDuration {
@@ -323,7 +436,7 @@ func compareMultisigAddress(ctx context.Context, height int64, addr *MsigAddress
 	return nil
 }
 
-func applyMultisigStateFromEvents(ctx context.Context, height int64, msigState *types.MultisigState, msigEvents []*parserTypes.MultisigInfo, rpcClient api.RPCClientInterface) error {
+func applyMultisigStateFromEvents(ctx context.Context, height int64, tipset *filTypes.TipSet, msigState *types.MultisigState, msigEvents []*parserTypes.MultisigInfo, rpcClient api.RPCClientInterface, addressCache *internal.AddressCache) error {
 	for _, msigEvent := range msigEvents {
 		switch msigEvent.ActionType {
 		case parser.MethodConstructor:
@@ -350,9 +463,9 @@ func applyMultisigStateFromEvents(ctx context.Context, height int64, msigState *
 				return fmt.Errorf("failed to parse swapSigner.From(%s): %s", swapSigner.From, err)
 			}
 			// get equivalent signer for swapSigner.From
-			equivalentSignerFrom, err := internal.GetEquivalentAddresses(ctx, addr, rpcClient.FullNodeClient())
+			equivalentSignerFrom, err := internal.GetEquivalentAddressesAt(ctx, addr, tipset, rpcClient.FullNodeClient(), addressCache)
 			if err != nil {
-				return fmt.Errorf("failed to get equivalent swapsigner.From(%s): %s", swapSigner.From, err)
+				return internal.Failure(internal.FailureNode, fmt.Errorf("failed to get equivalent swapsigner.From(%s): %s", swapSigner.From, err))
 			}
 			newSigners := []string{swapSigner.To}
 			for _, signer := range msigState.Signers {
@@ -373,9 +486,9 @@ func applyMultisigStateFromEvents(ctx context.Context, height int64, msigState *
 				return fmt.Errorf("failed to parse removeSigner.Signer(%s): %s", removeSigner.Signer, err)
 			}
 			// get equivalent signer for removeSigner.Signer
-			equivalentSignerRemove, err := internal.GetEquivalentAddresses(ctx, addr, rpcClient.FullNodeClient())
+			equivalentSignerRemove, err := internal.GetEquivalentAddressesAt(ctx, addr, tipset, rpcClient.FullNodeClient(), addressCache)
 			if err != nil {
-				return fmt.Errorf("failed to get equivalent removeSigner.Signer(%s): %s", removeSigner.Signer, err)
+				return internal.Failure(internal.FailureNode, fmt.Errorf("failed to get equivalent removeSigner.Signer(%s): %s", removeSigner.Signer, err))
 			}
 
 			newSigners := []string{}
@@ -5,8 +5,10 @@ import (
 	"testing"
 
 	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
 	lotusAPI "github.com/filecoin-project/lotus/api"
 	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -48,7 +50,7 @@ func TestApplyMultisigStateFromEvents_Constructor(t *testing.T) {
 		},
 	}
 
-	err = applyMultisigStateFromEvents(t.Context(), 0, state, events, nil)
+	err = applyMultisigStateFromEvents(t.Context(), 0, nil, state, events, nil, nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, constructor.Signers, state.Signers)
@@ -74,7 +76,7 @@ func TestApplyMultisigStateFromEvents_AddSigner(t *testing.T) {
 		},
 	}
 
-	err = applyMultisigStateFromEvents(t.Context(), 0, state, events, nil)
+	err = applyMultisigStateFromEvents(t.Context(), 0, nil, state, events, nil, nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, []string{"f1234", "f5678", "f9012"}, state.Signers)
@@ -105,7 +107,7 @@ func TestApplyMultisigStateFromEvents_RemoveSigner(t *testing.T) {
 		client: fullNodeMock,
 	}
 
-	err = applyMultisigStateFromEvents(t.Context(), 0, state, events, mockRPCClient)
+	err = applyMultisigStateFromEvents(t.Context(), 0, nil, state, events, mockRPCClient, nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, []string{"f01234", "f09012"}, state.Signers)
@@ -137,7 +139,7 @@ func TestApplyMultisigStateFromEvents_SwapSigner(t *testing.T) {
 		client: fullNodeMock,
 	}
 
-	err = applyMultisigStateFromEvents(t.Context(), 0, state, events, mockRPCClient)
+	err = applyMultisigStateFromEvents(t.Context(), 0, nil, state, events, mockRPCClient, nil)
 	require.NoError(t, err)
 
 	assert.ElementsMatch(t, []string{"f01234", "f09012", "f03456"}, state.Signers)
@@ -163,7 +165,7 @@ func TestApplyMultisigStateFromEvents_LockBalance(t *testing.T) {
 		},
 	}
 
-	err = applyMultisigStateFromEvents(t.Context(), 0, state, events, nil)
+	err = applyMultisigStateFromEvents(t.Context(), 0, nil, state, events, nil, nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, lockBalance.Amount, state.LockedBalance)
@@ -226,7 +228,7 @@ func TestApplyMultisigStateFromEvents_MultipleEvents(t *testing.T) {
 		client: fullNodeMock,
 	}
 
-	err := applyMultisigStateFromEvents(t.Context(), 0, state, events, mockRPCClient)
+	err := applyMultisigStateFromEvents(t.Context(), 0, nil, state, events, mockRPCClient, nil)
 	require.NoError(t, err)
 
 	// Final state should have signers: f05678, f09012
@@ -234,3 +236,55 @@ func TestApplyMultisigStateFromEvents_MultipleEvents(t *testing.T) {
 	assert.Equal(t, "2000000", state.LockedBalance)
 	assert.Equal(t, int64(200), state.UnlockDuration)
 }
+
+func testTipSet(t *testing.T, height int64) *filTypes.TipSet {
+	blockCid, err := cid.Decode("bafyreicmaj5hhoy5mgqvamfhgexxyergw7hdeshizghodwkjg6qmpoco7i")
+	require.NoError(t, err)
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	tipset, err := filTypes.NewTipSet([]*filTypes.BlockHeader{
+		{
+			Miner:                 miner,
+			Height:                abi.ChainEpoch(height),
+			ParentStateRoot:       blockCid,
+			ParentMessageReceipts: blockCid,
+			Messages:              blockCid,
+			ParentWeight:          filTypes.NewInt(0),
+			ParentBaseFee:         filTypes.NewInt(0),
+		},
+	})
+	require.NoError(t, err)
+	return tipset
+}
+
+func TestGetMultisigState(t *testing.T) {
+	msig, err := address.NewActorAddress([]byte("msig"))
+	require.NoError(t, err)
+	id, err := address.NewIDAddress(100)
+	require.NoError(t, err)
+	tipset := testTipSet(t, 100)
+
+	t.Run("loaded from chain", func(t *testing.T) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("StateLookupID", mock.Anything, msig, tipset.Key()).Return(id, nil)
+		fullNodeMock.On("StateGetActor", mock.Anything, msig, tipset.Key()).Return(&filTypes.Actor{}, nil)
+		fullNodeMock.On("StateReadState", mock.Anything, msig, tipset.Key()).Return(&lotusAPI.ActorState{State: map[string]interface{}{
+			"Signers":        []any{"f0101", "f0102"},
+			"InitialBalance": "1000",
+			"UnlockDuration": float64(10),
+		}}, nil)
+
+		state, err := getMultisigState(t.Context(), msig, 99, tipset, &MockRPCClient{client: fullNodeMock}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, &types.MultisigState{Height: 99, Signers: []string{"f0101", "f0102"}, LockedBalance: "1000", UnlockDuration: 10}, state)
+	})
+
+	t.Run("created after the start", func(t *testing.T) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("StateLookupID", mock.Anything, msig, tipset.Key()).Return(address.Undef, &lotusAPI.ErrActorNotFound{})
+
+		state, err := getMultisigState(t.Context(), msig, 99, tipset, &MockRPCClient{client: fullNodeMock}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, &types.MultisigState{Height: 99}, state)
+	})
+}
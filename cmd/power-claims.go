@@ -0,0 +1,369 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	address "github.com/filecoin-project/go-address"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/spf13/cobra"
+	fil_parser "github.com/zondax/fil-parser"
+	"github.com/zondax/fil-parser/parser"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	types "github.com/zondax/fil-trace-check/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	powerActorAddr = "f04"
+)
+
+func ValidatePowerClaimsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.PowerClaimsCheck,
+		Short: "Validate Miner Power Claims Sequentially from start=1 (unless defined) to end",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return validatePowerClaims(cmd)
+		},
+	}
+	cmd.Flags().String(internal.AddressFileFlag, "", "path to a newline separated address file for miners to check power claims")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
+	cmd.Flags().Int64(internal.StartFlag, 1, "optional start height to validate")
+	cmd.Flags().Int64(internal.EndFlag, 0, "end height to validate")
+	return cmd
+}
+
+type MinerAddress struct {
+	Address             string
+	EquivalentAddresses map[string]bool
+	State               *types.PowerState
+	ParsedAddress       address.Address
+	// Resync reloads the claims from chain at the next height, the deltas of a skipped height are missing from State
+	Resync bool
+}
+
+// resyncMiners reloads the claims of every miner at the next height, after a height that could not be processed
+func resyncMiners(minerMap map[string]*MinerAddress) {
+	for _, miner := range minerMap {
+		miner.Resync = true
+	}
+}
+
+func validatePowerClaims(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("could not get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
+
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("could not get db path", zap.Error(err))
+		return err
+	}
+	db, err := api.NewDB(dbPath, internal.PowerClaimsCheck)
+	if err != nil {
+		log.Error("could not create db", zap.Error(err))
+		return err
+	}
+	stateDB, err := api.NewDB(dbPath, internal.PowerClaimsCheck+".state")
+	if err != nil {
+		log.Error("could not create state db", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error("failed to close database", zap.Error(err))
+		}
+		if err := stateDB.Close(); err != nil {
+			log.Error("failed to close state database", zap.Error(err))
+		}
+	}()
+	addressCache, closeAddressCache := openAddressCache(ctx, dbPath, log)
+	defer closeAddressCache()
+
+	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
+	if err != nil {
+		log.Error("could not get address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+	addresses, err := internal.ReadAddressFile(addressFile)
+	if err != nil {
+		log.Error("could not read address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+
+	start := int64(1)
+	if cmd.Flags().Changed(internal.StartFlag) {
+		startHeight, err := cmd.Flags().GetInt64(internal.StartFlag)
+		if err != nil {
+			log.Error("could not get start height", zap.Error(err), zap.Int64("start-height", startHeight))
+			return err
+		}
+		start = startHeight
+	}
+	endHeight, err := cmd.Flags().GetInt64(internal.EndFlag)
+	if err != nil {
+		log.Error("could not get end height", zap.Error(err), zap.Int64("end-height", endHeight))
+		return err
+	}
+	if endHeight < start {
+		log.Error("end height is less than start height", zap.Int64("start-height", start), zap.Int64("end-height", endHeight))
+		return errors.New("end height is less than start height")
+	}
+
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("could not create rpc client", zap.Error(err), zap.String("node-url", config.NodeURL))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	dataStore, err := api.GetDataStoreClient(&config)
+	if err != nil {
+		log.Error("could not create data store client", zap.Error(err))
+		return err
+	}
+
+	parser, err := fil_parser.NewFilecoinParserWithActorV2(
+		rpcClient.RosettaLib(), api.GetDataSource(network, rpcClient),
+		getParserLogger(),
+	)
+	if err != nil {
+		log.Error("failed to create parser", zap.Error(err))
+		return err
+	}
+
+	latestHeight, err := resumeHeight(cmd, db)
+	if err != nil {
+		log.Error("failed to get latest height", zap.Error(err))
+		return err
+	}
+	if latestHeight < endHeight && latestHeight > start {
+		log.Info("resuming from latest height", zap.Int64("latest-height", latestHeight))
+		start = latestHeight + 1
+	}
+
+	// power claims before any message at start is applied
+	startTipset, err := api.ChainGetTipSetByHeight(ctx, start, rpcClient)
+	if err != nil {
+		log.Error("failed to get start tipset", zap.Error(err), zap.Int64("height", start))
+		return err
+	}
+
+	minerMap := map[string]*MinerAddress{}
+	parsedAddresses := map[string]address.Address{}
+	for _, addr := range addresses {
+		parsedAddress, err := address.NewFromString(addr)
+		if err != nil {
+			log.Error("failed to parse provided address", zap.Error(err), zap.String("address", addr))
+			internal.FailProgressAddress(addr, 0, internal.FailureParse, err.Error(), db)
+			return err
+		}
+		parsedAddresses[addr] = parsedAddress
+
+		state := &types.PowerState{}
+		if err := internal.GetProgressAddressState(addr, state, stateDB); err != nil {
+			log.Error("failed to get last state", zap.Error(err), zap.String("address", addr))
+			return err
+		}
+		if state.Height != start-1 {
+			if state.Height > 0 {
+				log.Info("miner state not at resume height, loading claims from chain", zap.String("address", addr), zap.Int64("state-height", state.Height), zap.Int64("start-height", start))
+			}
+			state, err = getPowerState(ctx, parsedAddress, start-1, startTipset, rpcClient)
+			if err != nil {
+				log.Error("failed to get onchain power claim", zap.Error(err), zap.String("address", addr))
+				return err
+			}
+		}
+
+		minerMap[addr] = &MinerAddress{
+			Address:       addr,
+			State:         state,
+			ParsedAddress: parsedAddress,
+		}
+	}
+
+	for height := start; height <= endHeight; height++ {
+		log.Info("processing height", zap.Int64("height", height))
+		data, err := api.GetTraceFromDataStore(height, dataStore, &config)
+		if err != nil {
+			log.Error("failed to get trace", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureTrace, err.Error(), db)
+			resyncMiners(minerMap)
+			continue
+		}
+		tipset, err := api.ChainGetTipSetByHeight(ctx, height, rpcClient)
+		if err != nil {
+			log.Error("failed to get tipset", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			resyncMiners(minerMap)
+			continue
+		}
+		// on-chain state is applied on the next tipset
+		nextTipset, err := api.ChainGetNextTipSet(ctx, tipset, rpcClient)
+		if err != nil {
+			log.Error("failed to get next tipset", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			resyncMiners(minerMap)
+			continue
+		}
+		equivalentAddresses, allEquivalentAddresses, err := heightEquivalentAddresses(ctx, parsedAddresses, tipset, nextTipset, rpcClient, addressCache)
+		if err != nil {
+			log.Error("failed to get equivalent addresses", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureNode, err.Error(), db)
+			resyncMiners(minerMap)
+			continue
+		}
+		data, err = filterTraceWithSubcalls(network, height, allEquivalentAddresses, data)
+		if err != nil {
+			log.Error("failed to filter trace", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureParse, err.Error(), db)
+			resyncMiners(minerMap)
+			continue
+		}
+
+		txsData := parserTypes.TxsData{
+			Traces: data,
+			Tipset: &parserTypes.ExtendedTipSet{
+				TipSet: *tipset,
+			},
+		}
+		nodeInfo := network.HeightToNodeVersion(height)
+		txsData.Metadata.NodeInfo = *nodeInfo
+
+		parsedTxData, err := parser.ParseTransactions(ctx, txsData)
+		if err != nil {
+			log.Error("failed to parse transactions", zap.Error(err), zap.Int64("height", height))
+			internal.FailProgressHeight(height, internal.FailureParse, err.Error(), db)
+			resyncMiners(minerMap)
+			continue
+		}
+
+		for _, addr := range addresses {
+			if equivalentAddresses[addr] == nil {
+				log.Debug("actor does not exist at height", zap.String("address", addr), zap.Int64("height", height))
+				continue
+			}
+			miner := minerMap[addr]
+			miner.EquivalentAddresses = equivalentAddresses[addr]
+			if miner.Resync {
+				// claims before any message at height is applied
+				state, err := getPowerState(ctx, miner.ParsedAddress, height-1, tipset, rpcClient)
+				if err != nil {
+					log.Error("failed to reload onchain power claim", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+					internal.FailProgressAddress(addr, height, internal.FailureNode, err.Error(), db)
+					continue
+				}
+				log.Info("reloaded power claims from chain after a skipped height", zap.String("address", addr), zap.Int64("height", height))
+				miner.State = state
+				miner.Resync = false
+			}
+			active, err := applyPowerClaimsFromTransactions(miner.EquivalentAddresses, miner.State, parsedTxData.Txs)
+			if err != nil {
+				log.Error("failed to apply power claims", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+				internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureParse), err.Error(), db)
+				miner.Resync = true
+			}
+			miner.State.Height = height
+			// claims are checked at every epoch with activity and always at the end of the range
+			if err == nil && (active || height == endHeight) {
+				log.Info("processing address", zap.String("address", addr), zap.Int64("height", height))
+				if err := comparePowerClaims(ctx, miner, nextTipset, rpcClient); err != nil {
+					log.Error("power claims check failed", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+					internal.FailProgressAddress(addr, height, internal.FailureCategoryOf(err, internal.FailureMismatch), err.Error(), db)
+				} else {
+					internal.UpdateProgressAddress(addr, height, true, internal.ProgressOK, db)
+				}
+			}
+			// claims missing deltas are not saved, a resumed run reloads them from chain
+			if miner.Resync {
+				continue
+			}
+			if err := internal.UpdateProgressAddressState(addr, miner.State, stateDB); err != nil {
+				log.Error("failed to update state", zap.Error(err), zap.String("address", addr), zap.Int64("height", height))
+			}
+		}
+		internal.UpdateProgressHeight(height, true, internal.ProgressOK, db)
+	}
+	return nil
+}
+
+func getPowerState(ctx context.Context, addr address.Address, height int64, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) (*types.PowerState, error) {
+	power, err := rpcClient.FullNodeClient().StateMinerPower(ctx, addr, tipset.Key())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get onchain miner power: %w", err)
+	}
+	return &types.PowerState{
+		Height:          height,
+		RawBytePower:    toBigInt(power.MinerPower.RawBytePower),
+		QualityAdjPower: toBigInt(power.MinerPower.QualityAdjPower),
+	}, nil
+}
+
+// comparePowerClaims compares the claims accumulated from the traces with the chain and syncs them on a mismatch, so
+// every mismatch is only reported once
+func comparePowerClaims(ctx context.Context, miner *MinerAddress, tipset *filTypes.TipSet, rpcClient api.RPCClientInterface) error {
+	onchain, err := getPowerState(ctx, miner.ParsedAddress, miner.State.Height, tipset, rpcClient)
+	if err != nil {
+		return internal.Failure(internal.FailureNode, err)
+	}
+	parsed := miner.State
+	if parsed.RawBytePower.Cmp(onchain.RawBytePower) == 0 && parsed.QualityAdjPower.Cmp(onchain.QualityAdjPower) == 0 {
+		return nil
+	}
+	miner.State = onchain
+	if parsed.RawBytePower.Cmp(onchain.RawBytePower) != 0 {
+		return fmt.Errorf("raw byte power mismatch for %s at height %d: onchain=%s, parsed=%s", miner.Address, parsed.Height, onchain.RawBytePower, parsed.RawBytePower)
+	}
+	return fmt.Errorf("quality adjusted power mismatch for %s at height %d: onchain=%s, parsed=%s", miner.Address, parsed.Height, onchain.QualityAdjPower, parsed.QualityAdjPower)
+}
+
+// applyPowerClaimsFromTransactions adds the deltas of every UpdateClaimedPower call made by the miner
+// to the power actor and reports whether the claims changed.
+func applyPowerClaimsFromTransactions(equivalentAddresses map[string]bool, powerState *types.PowerState, txs []*parserTypes.Transaction) (bool, error) {
+	if powerState.RawBytePower == nil {
+		powerState.RawBytePower = big.NewInt(0)
+	}
+	if powerState.QualityAdjPower == nil {
+		powerState.QualityAdjPower = big.NewInt(0)
+	}
+	active := false
+	for _, tx := range txs {
+		if tx.Status != "Ok" || tx.TxType != parser.MethodUpdateClaimedPower {
+			continue
+		}
+		if tx.TxTo != powerActorAddr || !equivalentAddresses[tx.TxFrom] {
+			continue
+		}
+		metadata := types.UpdateClaimedPowerMetadata{}
+		if err := json.Unmarshal([]byte(tx.TxMetadata), &metadata); err != nil {
+			return active, fmt.Errorf("failed to parse updateClaimedPower(%s): %w", tx.TxMetadata, err)
+		}
+		rawDelta, ok := new(big.Int).SetString(metadata.Params.RawByteDelta, 10)
+		if !ok {
+			return active, fmt.Errorf("failed to parse raw byte delta: %s", metadata.Params.RawByteDelta)
+		}
+		qaDelta, ok := new(big.Int).SetString(metadata.Params.QualityAdjustedDelta, 10)
+		if !ok {
+			return active, fmt.Errorf("failed to parse quality adjusted delta: %s", metadata.Params.QualityAdjustedDelta)
+		}
+		powerState.RawBytePower = new(big.Int).Add(powerState.RawBytePower, rawDelta)
+		powerState.QualityAdjPower = new(big.Int).Add(powerState.QualityAdjPower, qaDelta)
+		active = true
+	}
+	return active, nil
+}
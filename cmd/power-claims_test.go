@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"math/big"
+	"testing"
+
+	address "github.com/filecoin-project/go-address"
+	lotusAPI "github.com/filecoin-project/lotus/api"
+	"github.com/filecoin-project/lotus/chain/actors/builtin/power"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+	types "github.com/zondax/fil-trace-check/internal/types"
+)
+
+func TestApplyPowerClaimsFromTransactions(t *testing.T) {
+	tests := []struct {
+		name           string
+		initialState   *types.PowerState
+		txs            []*parserTypes.Transaction
+		expectedActive bool
+		expectedRaw    *big.Int
+		expectedQA     *big.Int
+	}{
+		{
+			name:         "sector activation adds power",
+			initialState: &types.PowerState{},
+			txs: []*parserTypes.Transaction{
+				{
+					TxFrom:     "f01234",
+					TxTo:       powerActorAddr,
+					TxType:     "UpdateClaimedPower",
+					Status:     "Ok",
+					TxMetadata: `{"Params":{"RawByteDelta":"34359738368","QualityAdjustedDelta":"343597383680"}}`,
+				},
+			},
+			expectedActive: true,
+			expectedRaw:    big.NewInt(34359738368),
+			expectedQA:     big.NewInt(343597383680),
+		},
+		{
+			name: "termination removes power",
+			initialState: &types.PowerState{
+				RawBytePower:    big.NewInt(1000),
+				QualityAdjPower: big.NewInt(5000),
+			},
+			txs: []*parserTypes.Transaction{
+				{
+					TxFrom:     "f01234",
+					TxTo:       powerActorAddr,
+					TxType:     "UpdateClaimedPower",
+					Status:     "Ok",
+					TxMetadata: `{"Params":{"RawByteDelta":"-400","QualityAdjustedDelta":"-2000"}}`,
+				},
+				{
+					TxFrom:     "f01234",
+					TxTo:       powerActorAddr,
+					TxType:     "UpdateClaimedPower",
+					Status:     "Ok",
+					TxMetadata: `{"Params":{"RawByteDelta":"100","QualityAdjustedDelta":"100"}}`,
+				},
+			},
+			expectedActive: true,
+			expectedRaw:    big.NewInt(700),
+			expectedQA:     big.NewInt(3100),
+		},
+		{
+			name: "other miners and failed calls are ignored",
+			initialState: &types.PowerState{
+				RawBytePower:    big.NewInt(1000),
+				QualityAdjPower: big.NewInt(1000),
+			},
+			txs: []*parserTypes.Transaction{
+				{
+					TxFrom:     "f09999",
+					TxTo:       powerActorAddr,
+					TxType:     "UpdateClaimedPower",
+					Status:     "Ok",
+					TxMetadata: `{"Params":{"RawByteDelta":"100","QualityAdjustedDelta":"100"}}`,
+				},
+				{
+					TxFrom:     "f01234",
+					TxTo:       powerActorAddr,
+					TxType:     "UpdateClaimedPower",
+					Status:     "Error",
+					TxMetadata: `{"Params":{"RawByteDelta":"100","QualityAdjustedDelta":"100"}}`,
+				},
+				{
+					TxFrom: "f01234",
+					TxTo:   "f05678",
+					TxType: "Send",
+					Status: "Ok",
+					Amount: big.NewInt(10),
+				},
+			},
+			expectedActive: false,
+			expectedRaw:    big.NewInt(1000),
+			expectedQA:     big.NewInt(1000),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &types.PowerState{}
+			if tt.initialState.RawBytePower != nil {
+				state.RawBytePower = new(big.Int).Set(tt.initialState.RawBytePower)
+			}
+			if tt.initialState.QualityAdjPower != nil {
+				state.QualityAdjPower = new(big.Int).Set(tt.initialState.QualityAdjPower)
+			}
+
+			active, err := applyPowerClaimsFromTransactions(map[string]bool{"f01234": true}, state, tt.txs)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedActive, active)
+			assert.Equal(t, 0, tt.expectedRaw.Cmp(state.RawBytePower), "raw byte power: expected %s, got %s", tt.expectedRaw, state.RawBytePower)
+			assert.Equal(t, 0, tt.expectedQA.Cmp(state.QualityAdjPower), "quality adjusted power: expected %s, got %s", tt.expectedQA, state.QualityAdjPower)
+		})
+	}
+
+	t.Run("invalid delta", func(t *testing.T) {
+		state := &types.PowerState{}
+		_, err := applyPowerClaimsFromTransactions(map[string]bool{"f01234": true}, state, []*parserTypes.Transaction{
+			{
+				TxFrom:     "f01234",
+				TxTo:       powerActorAddr,
+				TxType:     "UpdateClaimedPower",
+				Status:     "Ok",
+				TxMetadata: `{"Params":{"RawByteDelta":"abc","QualityAdjustedDelta":"1"}}`,
+			},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestComparePowerClaims(t *testing.T) {
+	minerAddress, err := address.NewIDAddress(1234)
+	require.NoError(t, err)
+	tipset := testTipSet(t, 101)
+	fullNodeMock := mocks.NewFullNode(t)
+	fullNodeMock.On("StateMinerPower", mock.Anything, minerAddress, tipset.Key()).Return(&lotusAPI.MinerPower{
+		MinerPower: power.Claim{RawBytePower: filTypes.NewInt(1000), QualityAdjPower: filTypes.NewInt(5000)},
+	}, nil)
+	rpcClient := &MockRPCClient{client: fullNodeMock}
+	miner := &MinerAddress{
+		Address:       minerAddress.String(),
+		ParsedAddress: minerAddress,
+		State:         &types.PowerState{Height: 100, RawBytePower: big.NewInt(900), QualityAdjPower: big.NewInt(5000)},
+	}
+
+	err = comparePowerClaims(t.Context(), miner, tipset, rpcClient)
+	assert.EqualError(t, err, "raw byte power mismatch for f01234 at height 100: onchain=1000, parsed=900")
+
+	// the claims are synced with the chain, the mismatch is not reported again
+	assert.Equal(t, &types.PowerState{Height: 100, RawBytePower: big.NewInt(1000), QualityAdjPower: big.NewInt(5000)}, miner.State)
+	_, err = applyPowerClaimsFromTransactions(map[string]bool{minerAddress.String(): true}, miner.State, []*parserTypes.Transaction{{
+		TxFrom:     minerAddress.String(),
+		TxTo:       powerActorAddr,
+		TxType:     "UpdateClaimedPower",
+		Status:     "Ok",
+		TxMetadata: `{"Params":{"RawByteDelta":"0","QualityAdjustedDelta":"0"}}`,
+	}})
+	require.NoError(t, err)
+	assert.NoError(t, comparePowerClaims(t.Context(), miner, tipset, rpcClient))
+}
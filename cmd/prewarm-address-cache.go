@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+
+	address "github.com/filecoin-project/go-address"
+
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/spf13/cobra"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"go.uber.org/zap"
+)
+
+func PrewarmAddressCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.PrewarmAddressCacheCommand,
+		Short: "Resolve the equivalent addresses of an address file into the address cache",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return prewarmAddressCache(cmd)
+		},
+	}
+	cmd.Flags().String(internal.AddressFileFlag, "", "path to the address file")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	cmd.Flags().Int64(internal.HeightFlag, 0, "height to resolve the addresses at, defaults to the chain head")
+	return cmd
+}
+
+func prewarmAddressCache(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+
+	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
+	if err != nil {
+		log.Error("could not get address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("could not get db path", zap.Error(err), zap.String("db-path", dbPath))
+		return err
+	}
+	height, err := cmd.Flags().GetInt64(internal.HeightFlag)
+	if err != nil {
+		log.Error("could not get height", zap.Error(err), zap.Int64("height", height))
+		return err
+	}
+
+	addresses, err := internal.ReadAddressFile(addressFile)
+	if err != nil {
+		log.Error("could not read address file", zap.Error(err), zap.String("address-file", addressFile))
+		return err
+	}
+
+	// unlike the validations, prewarming is pointless without the cache
+	cache, err := internal.OpenAddressCache(dbPath)
+	if err != nil {
+		log.Error("could not open address cache", zap.Error(err), zap.String("db-path", dbPath))
+		return err
+	}
+	defer func() {
+		if err := cache.Close(); err != nil {
+			log.Error("failed to close address cache", zap.Error(err))
+		}
+	}()
+
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("could not create rpc client", zap.Error(err), zap.String("node-url", config.NodeURL))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	var tipset *filTypes.TipSet
+	if height > 0 {
+		tipset, err = api.ChainGetTipSetByHeight(ctx, height, rpcClient)
+	} else {
+		tipset, err = rpcClient.FullNodeClient().ChainHead(ctx)
+	}
+	if err != nil {
+		log.Error("could not get tipset", zap.Error(err), zap.Int64("height", height))
+		return err
+	}
+
+	failed := 0
+	for _, addr := range addresses {
+		parsedAddress, err := address.NewFromString(addr)
+		if err != nil {
+			log.Error("could not parse address", zap.Error(err), zap.String("address", addr))
+			failed++
+			continue
+		}
+		if _, err := internal.GetEquivalentAddressesAt(ctx, parsedAddress, tipset, rpcClient.FullNodeClient(), cache); err != nil {
+			log.Error("could not get equivalent addresses", zap.Error(err), zap.String("address", addr))
+			failed++
+		}
+	}
+
+	hits, misses := cache.Stats()
+	log.Info("address cache prewarmed", zap.Int64("height", int64(tipset.Height())), zap.Int("addresses", len(addresses)),
+		zap.Int("failed", failed), zap.Int64("hits", hits), zap.Int64("misses", misses))
+	if failed > 0 {
+		return fmt.Errorf("could not resolve %d of %d addresses", failed, len(addresses))
+	}
+	return nil
+}
@@ -22,6 +22,12 @@ func GenerateReportCmd() *cobra.Command {
 					- validate-multisig-state
 					- validate-address-balance-sequential
 					- validate-multisig-state-sequential
+					- validate-market-balance
+					- validate-power-claims
+					- validate-miner-sectors
+					- validate-evm-accounts
+					- validate-actor-creation
+					- validate-event-coverage
 		`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return generateReport(cmd)
@@ -42,6 +48,12 @@ var availableChecks = map[string]bool{
 	internal.MultisigStateCheck:            true,
 	internal.AddressBalanceSequentialCheck: true,
 	internal.MultisigStateSequentialCheck:  true,
+	internal.MarketBalanceCheck:            true,
+	internal.PowerClaimsCheck:              true,
+	internal.MinerSectorsCheck:             true,
+	internal.EvmAccountsCheck:              true,
+	internal.ActorCreationCheck:            true,
+	internal.EventCoverageCheck:            true,
 }
 
 func generateReport(cmd *cobra.Command) error {
@@ -53,7 +65,7 @@ func generateReport(cmd *cobra.Command) error {
 		return err
 	}
 	if _, ok := availableChecks[check]; !ok {
-		log.Error("invalid check, expected one of: validate-null-blocks, validate-json, validate-canonical-chain, validate-address-balance, validate-multisig-state, validate-address-balance-sequential, validate-multisig-state-sequential", zap.String("check", check))
+		log.Error("invalid check, expected one of: validate-null-blocks, validate-json, validate-canonical-chain, validate-address-balance, validate-multisig-state, validate-address-balance-sequential, validate-multisig-state-sequential, validate-market-balance, validate-power-claims, validate-miner-sectors, validate-evm-accounts, validate-actor-creation, validate-event-coverage", zap.String("check", check))
 		return err
 	}
 	reportPath, err := cmd.Flags().GetString(internal.ReportPathFlag)
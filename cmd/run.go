@@ -0,0 +1,406 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRunBatchSize  = 100
+	defaultRunReportPath = "run-report.json"
+)
+
+// runAddressChecks are the checks a plan can run besides the range checks of watchChecks, they validate the epochs
+// of their addresses once the range checks are done
+var runAddressChecks = map[string]func() *cobra.Command{
+	internal.AddressBalanceCheck: ValidateAddressBalanceCmd,
+	internal.MultisigStateCheck:  ValidateMultisigStateCmd,
+	internal.MarketBalanceCheck:  ValidateMarketBalanceCmd,
+	internal.EventCoverageCheck:  ValidateEventCoverageCmd,
+}
+
+// runPlanReservedFlags are set from the plan fields and cannot be set in the options of a check
+var runPlanReservedFlags = []string{internal.StartFlag, internal.EndFlag, internal.DBPathFlag, internal.AddressFileFlag}
+
+// runPlan is the yaml plan of the run command, the range, address file and database of the plan apply to every
+// check that does not set its own
+type runPlan struct {
+	DBPath      string         `mapstructure:"db_path"`
+	ReportPath  string         `mapstructure:"report_path"`
+	BatchSize   int64          `mapstructure:"batch_size"`
+	Start       int64          `mapstructure:"start"`
+	End         int64          `mapstructure:"end"`
+	AddressFile string         `mapstructure:"address_file"`
+	Checks      []runPlanCheck `mapstructure:"checks"`
+}
+
+type runPlanCheck struct {
+	Name        string `mapstructure:"name"`
+	Start       int64  `mapstructure:"start"`
+	End         int64  `mapstructure:"end"`
+	AddressFile string `mapstructure:"address_file"`
+	// Options are the other flags of the check by name
+	Options map[string]string `mapstructure:"options"`
+}
+
+// runStep is a check of the plan with its flags resolved
+type runStep struct {
+	check      string
+	rangeCheck bool
+	start      int64
+	end        int64
+	flags      map[string]string
+	err        error
+}
+
+// runReport is the combined report of every check of a run
+type runReport struct {
+	Checks           []runCheckReport `json:"checks"`
+	TracesDownloaded int64            `json:"traces_downloaded"`
+	TracesReused     int64            `json:"traces_reused"`
+}
+
+type runCheckReport struct {
+	Check  string `json:"check"`
+	Start  int64  `json:"start,omitempty"`
+	End    int64  `json:"end,omitempty"`
+	Passed int    `json:"passed"`
+	Failed int    `json:"failed"`
+	// Error is why the check stopped before the end of its range
+	Error string `json:"error,omitempty"`
+	// Failures are the messages of the failed results by progress key
+	Failures map[string]string `json:"failures,omitempty"`
+	// Warnings are the messages of the passed results that are not ok by progress key
+	Warnings map[string]string `json:"warnings,omitempty"`
+}
+
+func RunCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.RunCommand,
+		Short: "Run the checks of a yaml plan sharing the node client and trace downloads",
+		Long: fmt.Sprintf(`Run the checks of a yaml plan with one node client. Range checks run together batch by batch, each
+trace is downloaded once per batch and read by every range check that needs it. Address checks run after
+the range checks. A combined report of every check is written at the end.
+
+Range checks: %s
+Address checks: %s`,
+			strings.Join(slices.Sorted(maps.Keys(watchChecks)), ", "),
+			strings.Join(slices.Sorted(maps.Keys(runAddressChecks)), ", ")),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return run(cmd)
+		},
+	}
+	cmd.Flags().String(internal.PlanFlag, "plan.yaml", "path to the run plan")
+	return cmd
+}
+
+func run(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx := cmd.Context()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+
+	planPath, err := cmd.Flags().GetString(internal.PlanFlag)
+	if err != nil {
+		log.Error("failed to get plan", zap.Error(err))
+		return err
+	}
+	plan, err := loadRunPlan(planPath)
+	if err != nil {
+		log.Error("failed to load plan", zap.Error(err))
+		return err
+	}
+	steps, err := resolveRunPlan(plan)
+	if err != nil {
+		log.Error("invalid plan", zap.Error(err))
+		return err
+	}
+
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("failed to create rpc client", zap.Error(err))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	api.ShareRPCClient(rpcClient)
+	defer api.ShareRPCClient(nil)
+
+	// the checks run concurrently share one address cache, the database can only be opened once
+	addressCache, closeAddressCache := openAddressCache(ctx, plan.DBPath, log)
+	defer closeAddressCache()
+	ctx = internal.ContextWithAddressCache(ctx, addressCache)
+
+	traceCache := api.NewTraceCache()
+	api.UseTraceCache(traceCache)
+	runRangeSteps(ctx, steps, plan.BatchSize, traceCache, log)
+	api.UseTraceCache(nil)
+
+	for _, step := range steps {
+		if step.rangeCheck || ctx.Err() != nil {
+			continue
+		}
+		log.Info("running check", zap.String("check", step.check))
+		step.err = runCheckCmd(ctx, runAddressChecks[step.check](), step.flags)
+		if step.err != nil {
+			log.Error("check failed", zap.Error(step.err), zap.String("check", step.check))
+		}
+	}
+
+	downloaded, reused := traceCache.Stats()
+	report := runReport{TracesDownloaded: downloaded, TracesReused: reused}
+	for _, step := range steps {
+		checkReport, err := runStepReport(plan.DBPath, step, 0)
+		if err != nil {
+			log.Error("failed to read check results", zap.Error(err), zap.String("check", step.check))
+			return err
+		}
+		report.Checks = append(report.Checks, checkReport)
+		log.Info("check results",
+			zap.String("check", step.check),
+			zap.Int("passed", checkReport.Passed),
+			zap.Int("failed", checkReport.Failed),
+			zap.String("error", checkReport.Error),
+		)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		log.Error("failed to encode report", zap.Error(err))
+		return err
+	}
+	if err := os.WriteFile(plan.ReportPath, data, 0600); err != nil {
+		log.Error("failed to write report", zap.Error(err))
+		return err
+	}
+	log.Info("report generated", zap.String("report-path", plan.ReportPath), zap.Int64("traces-downloaded", downloaded), zap.Int64("traces-reused", reused))
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return runStepsError(steps)
+}
+
+// runStepsError returns an error naming the steps that stopped before the end of their range, nil if none did
+func runStepsError(steps []*runStep) error {
+	failed := []string{}
+	for _, step := range steps {
+		if step.err != nil {
+			failed = append(failed, step.check)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("checks failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func loadRunPlan(path string) (*runPlan, error) {
+	planViper := viper.New()
+	planViper.SetConfigFile(path)
+	if err := planViper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("could not read plan %s: %w", path, err)
+	}
+	plan := &runPlan{}
+	if err := planViper.Unmarshal(plan); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %w", path, err)
+	}
+	if plan.DBPath == "" {
+		plan.DBPath = "."
+	}
+	if plan.ReportPath == "" {
+		plan.ReportPath = defaultRunReportPath
+	}
+	if plan.BatchSize == 0 {
+		plan.BatchSize = defaultRunBatchSize
+	}
+	return plan, nil
+}
+
+// resolveRunPlan returns the steps of plan in order with the flags of every check
+func resolveRunPlan(plan *runPlan) ([]*runStep, error) {
+	if len(plan.Checks) == 0 {
+		return nil, fmt.Errorf("at least one check is required")
+	}
+	if plan.BatchSize < 0 {
+		return nil, fmt.Errorf("batch_size cannot be negative")
+	}
+	steps := []*runStep{}
+	seen := map[string]bool{}
+	for _, planCheck := range plan.Checks {
+		if seen[planCheck.Name] {
+			return nil, fmt.Errorf("check %s is in the plan more than once", planCheck.Name)
+		}
+		seen[planCheck.Name] = true
+
+		newCheckCmd, rangeCheck := watchChecks[planCheck.Name]
+		if !rangeCheck {
+			var ok bool
+			if newCheckCmd, ok = runAddressChecks[planCheck.Name]; !ok {
+				return nil, fmt.Errorf("check %s cannot be run from a plan", planCheck.Name)
+			}
+		}
+		checkCmd := newCheckCmd()
+		step := &runStep{
+			check:      planCheck.Name,
+			rangeCheck: rangeCheck,
+			start:      cmp.Or(planCheck.Start, plan.Start),
+			end:        cmp.Or(planCheck.End, plan.End),
+			flags:      map[string]string{internal.DBPathFlag: plan.DBPath},
+		}
+
+		if checkCmd.Flags().Lookup(internal.AddressFileFlag) != nil {
+			addressFile := cmp.Or(planCheck.AddressFile, plan.AddressFile)
+			if addressFile == "" {
+				return nil, fmt.Errorf("check %s requires address_file", planCheck.Name)
+			}
+			step.flags[internal.AddressFileFlag] = addressFile
+		}
+
+		switch {
+		case rangeCheck:
+			// set per batch
+			if step.start <= 0 || step.end < step.start {
+				return nil, fmt.Errorf("check %s requires a start and an end after it", planCheck.Name)
+			}
+		case checkCmd.Flags().Lookup(internal.StartFlag) != nil:
+			setRunRange(step, internal.StartFlag, internal.EndFlag)
+		case checkCmd.Flags().Lookup(internal.EventStartFlag) != nil:
+			setRunRange(step, internal.EventStartFlag, internal.EventEndFlag)
+		}
+
+		for name, value := range planCheck.Options {
+			if slices.Contains(runPlanReservedFlags, name) {
+				return nil, fmt.Errorf("check %s: %s is set from the plan fields, not options", planCheck.Name, name)
+			}
+			flag := checkCmd.Flags().Lookup(name)
+			if flag == nil {
+				return nil, fmt.Errorf("check %s has no %s option", planCheck.Name, name)
+			}
+			if err := flag.Value.Set(value); err != nil {
+				return nil, fmt.Errorf("check %s: invalid %s: %w", planCheck.Name, name, err)
+			}
+			step.flags[name] = value
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// setRunRange sets the range of a check that is not run by batches, an unset side keeps the check's default
+func setRunRange(step *runStep, startFlag, endFlag string) {
+	if step.start > 0 {
+		step.flags[startFlag] = strconv.FormatInt(step.start, 10)
+	}
+	if step.end > 0 {
+		step.flags[endFlag] = strconv.FormatInt(step.end, 10)
+	}
+}
+
+// runRangeSteps runs the range checks together on every batch of their ranges. The traces of a batch are kept in
+// traceCache until every check is done with it, a check that fails is not run on the next batches.
+func runRangeSteps(ctx context.Context, steps []*runStep, batchSize int64, traceCache *api.TraceCache, log *zap.Logger) {
+	var start, end int64
+	for _, step := range steps {
+		if !step.rangeCheck {
+			continue
+		}
+		if start == 0 || step.start < start {
+			start = step.start
+		}
+		end = max(end, step.end)
+	}
+	if end == 0 {
+		return
+	}
+
+	for batchStart := start; batchStart <= end && ctx.Err() == nil; batchStart += batchSize {
+		batchEnd := min(batchStart+batchSize-1, end)
+		log.Info("running batch", zap.Int64("start", batchStart), zap.Int64("end", batchEnd))
+		var wg sync.WaitGroup
+		for _, step := range steps {
+			if !step.rangeCheck || step.err != nil || step.end < batchStart || step.start > batchEnd {
+				continue
+			}
+			flags := maps.Clone(step.flags)
+			flags[internal.StartFlag] = strconv.FormatInt(max(step.start, batchStart), 10)
+			flags[internal.EndFlag] = strconv.FormatInt(min(step.end, batchEnd), 10)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := runCheckCmd(ctx, watchChecks[step.check](), flags); err != nil {
+					log.Error("check failed, skipping its next batches", zap.Error(err), zap.String("check", step.check))
+					step.err = err
+				}
+			}()
+		}
+		wg.Wait()
+		traceCache.Reset()
+	}
+}
+
+// runStepReport counts the results of step in its range, all of them for checks without a range. It fails if the
+// database of the check is still in use after timeout, 0 waits indefinitely.
+func runStepReport(dbPath string, step *runStep, timeout time.Duration) (runCheckReport, error) {
+	report := runCheckReport{Check: step.check, Start: step.start, End: step.end}
+	if step.err != nil {
+		report.Error = step.err.Error()
+	}
+	db, err := api.NewDBWithTimeout(dbPath, step.check, timeout)
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+	data, err := db.GetAllKVAsJSON()
+	if err != nil {
+		return report, err
+	}
+	results := map[string]struct {
+		Success *bool
+		Message string
+	}{}
+	if err := json.Unmarshal(data, &results); err != nil {
+		return report, err
+	}
+	for key, result := range results {
+		// state entries of the check are not results
+		if result.Success == nil {
+			continue
+		}
+		height, err := strconv.ParseInt(key[strings.LastIndex(key, api.AddressHeightSeparator)+1:], 10, 64)
+		if err == nil && ((step.start > 0 && height < step.start) || (step.end > 0 && height > step.end)) {
+			continue
+		}
+		if *result.Success {
+			report.Passed++
+			if result.Message != internal.ProgressOK {
+				if report.Warnings == nil {
+					report.Warnings = map[string]string{}
+				}
+				report.Warnings[key] = result.Message
+			}
+			continue
+		}
+		report.Failed++
+		if report.Failures == nil {
+			report.Failures = map[string]string{}
+		}
+		report.Failures[key] = result.Message
+	}
+	return report, nil
+}
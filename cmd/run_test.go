@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"github.com/zondax/fil-trace-check/internal/types"
+	"go.uber.org/zap"
+)
+
+const testRunPlan = `
+start: 100
+end: 200
+address_file: addresses.txt
+checks:
+  - name: validate-null-blocks
+  - name: validate-power-claims
+    start: 150
+  - name: validate-address-balance
+    options:
+      event-provider: lotus
+`
+
+func TestLoadRunPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testRunPlan), 0o600))
+
+	plan, err := loadRunPlan(path)
+	require.NoError(t, err)
+	assert.Equal(t, ".", plan.DBPath)
+	assert.Equal(t, defaultRunReportPath, plan.ReportPath)
+	assert.Equal(t, int64(defaultRunBatchSize), plan.BatchSize)
+
+	steps, err := resolveRunPlan(plan)
+	require.NoError(t, err)
+	require.Len(t, steps, 3)
+
+	assert.Equal(t, internal.NullBlocksCheck, steps[0].check)
+	assert.True(t, steps[0].rangeCheck)
+	assert.Equal(t, int64(100), steps[0].start)
+	assert.Equal(t, map[string]string{internal.DBPathFlag: "."}, steps[0].flags)
+
+	assert.Equal(t, int64(150), steps[1].start)
+	assert.Equal(t, "addresses.txt", steps[1].flags[internal.AddressFileFlag])
+
+	assert.False(t, steps[2].rangeCheck)
+	assert.Equal(t, map[string]string{
+		internal.DBPathFlag:        ".",
+		internal.AddressFileFlag:   "addresses.txt",
+		internal.EventStartFlag:    "100",
+		internal.EventEndFlag:      "200",
+		internal.EventProviderFlag: "lotus",
+	}, steps[2].flags)
+
+	_, err = loadRunPlan(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestResolveRunPlanErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		plan runPlan
+	}{
+		{name: "no checks", plan: runPlan{Start: 1, End: 10}},
+		{name: "unknown check", plan: runPlan{Start: 1, End: 10, Checks: []runPlanCheck{{Name: "validate-unknown"}}}},
+		{name: "duplicated check", plan: runPlan{Start: 1, End: 10, Checks: []runPlanCheck{{Name: internal.NullBlocksCheck}, {Name: internal.NullBlocksCheck}}}},
+		{name: "range check without range", plan: runPlan{Checks: []runPlanCheck{{Name: internal.NullBlocksCheck}}}},
+		{name: "end before start", plan: runPlan{Start: 10, End: 1, Checks: []runPlanCheck{{Name: internal.NullBlocksCheck}}}},
+		{name: "missing address file", plan: runPlan{Start: 1, End: 10, Checks: []runPlanCheck{{Name: internal.PowerClaimsCheck}}}},
+		{name: "unknown option", plan: runPlan{Start: 1, End: 10, Checks: []runPlanCheck{{Name: internal.NullBlocksCheck, Options: map[string]string{"unknown": "1"}}}}},
+		{name: "invalid option", plan: runPlan{AddressFile: "a.txt", Checks: []runPlanCheck{{Name: internal.AddressBalanceCheck, Options: map[string]string{internal.EventStartFlag: "x"}}}}},
+		{name: "reserved option", plan: runPlan{Start: 1, End: 10, Checks: []runPlanCheck{{Name: internal.NullBlocksCheck, Options: map[string]string{internal.EndFlag: "5"}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := resolveRunPlan(&tt.plan)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRunStepReport(t *testing.T) {
+	dbPath := t.TempDir()
+	db, err := api.NewDB(dbPath, internal.NullBlocksCheck)
+	require.NoError(t, err)
+	require.NoError(t, db.Insert("99", types.Progress{Success: false, Message: "outside the range"}))
+	require.NoError(t, db.Insert("100", types.Progress{Success: true, Message: internal.ProgressOK}))
+	require.NoError(t, db.Insert("101", types.Progress{Success: false, Message: "trace is null but tipset is not"}))
+	require.NoError(t, db.Insert("f01"+api.AddressHeightSeparator+"102", types.Progress{Success: true, Message: internal.ProgressOK}))
+	require.NoError(t, db.Insert("f01"+api.AddressHeightSeparator+"103", types.Progress{Success: true, Message: "unverified market settlement for f01"}))
+	require.NoError(t, db.Insert("f01", types.AddressState{Height: 102}))
+	require.NoError(t, db.Close())
+
+	report, err := runStepReport(dbPath, &runStep{check: internal.NullBlocksCheck, start: 100, end: 200}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, runCheckReport{
+		Check:    internal.NullBlocksCheck,
+		Start:    100,
+		End:      200,
+		Passed:   3,
+		Failed:   1,
+		Failures: map[string]string{"101": "trace is null but tipset is not"},
+		Warnings: map[string]string{"f01" + api.AddressHeightSeparator + "103": "unverified market settlement for f01"},
+	}, report)
+}
+
+func TestRunStepsError(t *testing.T) {
+	steps := []*runStep{{check: internal.NullBlocksCheck}, {check: internal.ValidateJSONCheck}}
+	assert.NoError(t, runStepsError(steps))
+	steps[1].err = errors.New("failed to get trace")
+	assert.EqualError(t, runStepsError(steps), "checks failed: "+internal.ValidateJSONCheck)
+}
+
+func TestOpenSharedAddressCache(t *testing.T) {
+	dbPath := t.TempDir()
+	log := zap.NewNop()
+	cache, closeCache := openAddressCache(context.Background(), dbPath, log)
+	require.NotNil(t, cache)
+	defer closeCache()
+
+	// the checks of a run use the cache of the run instead of opening the database again
+	ctx := internal.ContextWithAddressCache(context.Background(), cache)
+	shared, closeShared := openAddressCache(ctx, dbPath, log)
+	assert.Same(t, cache, shared)
+	closeShared()
+	_, ok, err := cache.Get("f01", 1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,732 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"github.com/zondax/fil-trace-check/validator"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultServeListen    = ":8080"
+	defaultServeQueueSize = 100
+
+	serveJobsBucket    = "serve-jobs"
+	serveResultsBucket = "serve-results"
+	serveAddressesDir  = "serve-addresses"
+
+	// serveStreamInterval is how often result streams look for new results of running jobs
+	serveStreamInterval = time.Second
+	// serveReportDBTimeout is how long a report waits for the database of a check used by a running job
+	serveReportDBTimeout   = time.Second
+	serveShutdownTimeout   = 10 * time.Second
+	serveReadHeaderTimeout = 10 * time.Second
+	serveMaxRequestSize    = 10 << 20
+)
+
+const (
+	serveJobQueued   = "queued"
+	serveJobRunning  = "running"
+	serveJobDone     = "done"
+	serveJobFailed   = "failed"
+	serveJobCanceled = "canceled"
+)
+
+// serveJobRequest is the body of a job submission, the range and options are those of a check in a run plan
+type serveJobRequest struct {
+	Check string `json:"check"`
+	Start int64  `json:"start,omitempty"`
+	End   int64  `json:"end,omitempty"`
+	// Addresses are validated by the checks that take an address file
+	Addresses []string          `json:"addresses,omitempty"`
+	Options   map[string]string `json:"options,omitempty"`
+}
+
+// serveJob is a submitted job with its state, persisted in the jobs database
+type serveJob struct {
+	ID string `json:"id"`
+	serveJobRequest
+	Status string `json:"status"`
+	// Error is why the check of a failed job stopped
+	Error string `json:"error,omitempty"`
+	// Passed and Failed count the results recorded by the job
+	Passed     int        `json:"passed"`
+	Failed     int        `json:"failed"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func (j *serveJob) finished() bool {
+	return j.Status == serveJobDone || j.Status == serveJobFailed || j.Status == serveJobCanceled
+}
+
+type runningServeJob struct {
+	job    *serveJob
+	cancel context.CancelFunc
+}
+
+// jobServer runs the submitted jobs from a bounded queue. Jobs and their results are persisted, so jobs queued or
+// interrupted by a shutdown are run again on restart.
+type jobServer struct {
+	dbPath  string
+	jobs    *api.DB
+	results *api.DB
+	queue   chan string
+	log     *zap.Logger
+	// run runs the check of a job, its results are recorded from the result subscription
+	run func(ctx context.Context, job *serveJob) error
+
+	mu      sync.Mutex
+	running map[string]*runningServeJob
+	// checkLocks keep the jobs of a check from running together, they share its database
+	checkLocks map[string]*sync.Mutex
+}
+
+func ServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.ServeCommand,
+		Short: "Serve an HTTP API to submit validation jobs and fetch their results",
+		Long: fmt.Sprintf(`Serve an HTTP API to submit validation jobs for a check over a range or an address list, poll their
+status, stream their results and fetch reports from the progress databases. Jobs wait in a bounded queue
+and run on a shared node client, jobs of the same check run one at a time. Job state is kept in the
+database path, jobs queued or running at shutdown run again on restart.
+
+Range checks: %s
+Address checks: %s`,
+			strings.Join(slices.Sorted(maps.Keys(watchChecks)), ", "),
+			strings.Join(slices.Sorted(maps.Keys(runAddressChecks)), ", ")),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return serve(cmd)
+		},
+	}
+	cmd.Flags().String(internal.ListenFlag, defaultServeListen, "address to serve the API on")
+	cmd.Flags().Int(internal.QueueSizeFlag, defaultServeQueueSize, "maximum queued jobs, submissions fail when it is full")
+	cmd.Flags().Int(internal.WorkersFlag, 1, "jobs run at the same time")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	return cmd
+}
+
+func serve(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+
+	listen, err := cmd.Flags().GetString(internal.ListenFlag)
+	if err != nil {
+		log.Error("failed to get listen", zap.Error(err))
+		return err
+	}
+	queueSize, err := cmd.Flags().GetInt(internal.QueueSizeFlag)
+	if err != nil {
+		log.Error("failed to get queue size", zap.Error(err))
+		return err
+	}
+	workers, err := cmd.Flags().GetInt(internal.WorkersFlag)
+	if err != nil {
+		log.Error("failed to get workers", zap.Error(err))
+		return err
+	}
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("failed to get db path", zap.Error(err))
+		return err
+	}
+	if queueSize <= 0 || workers <= 0 {
+		err := fmt.Errorf("queue size and workers must be positive")
+		log.Error("invalid flags", zap.Error(err))
+		return err
+	}
+
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("failed to create rpc client", zap.Error(err))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	api.ShareRPCClient(rpcClient)
+	defer api.ShareRPCClient(nil)
+
+	// the jobs run by the workers share one address cache, the database can only be opened once
+	addressCache, closeAddressCache := openAddressCache(ctx, dbPath, log)
+	defer closeAddressCache()
+	ctx = internal.ContextWithAddressCache(ctx, addressCache)
+
+	server, err := newJobServer(dbPath, queueSize, log)
+	if err != nil {
+		log.Error("failed to open job databases", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := server.Close(); err != nil {
+			log.Error("failed to close job databases", zap.Error(err))
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server.work(ctx)
+		}()
+	}
+	if err := server.requeue(ctx); err != nil {
+		log.Error("failed to requeue jobs", zap.Error(err))
+		stop()
+		wg.Wait()
+		return err
+	}
+
+	httpServer := &http.Server{
+		Addr:              listen,
+		Handler:           server.handler(),
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		// result streams end on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Error("failed to shut down server", zap.Error(err))
+		}
+	}()
+	log.Info("serving validation jobs", zap.String("listen", listen), zap.Int("queue-size", queueSize), zap.Int("workers", workers))
+	err = httpServer.ListenAndServe()
+	stop()
+	wg.Wait()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("failed to serve", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func newJobServer(dbPath string, queueSize int, log *zap.Logger) (*jobServer, error) {
+	if err := os.MkdirAll(filepath.Join(dbPath, serveAddressesDir), 0700); err != nil {
+		return nil, err
+	}
+	jobs, err := api.NewDB(dbPath, serveJobsBucket)
+	if err != nil {
+		return nil, err
+	}
+	results, err := api.NewDB(dbPath, serveResultsBucket)
+	if err != nil {
+		return nil, errors.Join(err, jobs.Close())
+	}
+	server := &jobServer{
+		dbPath:     dbPath,
+		jobs:       jobs,
+		results:    results,
+		queue:      make(chan string, queueSize),
+		log:        log,
+		running:    map[string]*runningServeJob{},
+		checkLocks: map[string]*sync.Mutex{},
+	}
+	server.run = server.runCheck
+	return server, nil
+}
+
+func (s *jobServer) Close() error {
+	return errors.Join(s.jobs.Close(), s.results.Close())
+}
+
+func (s *jobServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.submitJob)
+	mux.HandleFunc("GET /jobs", s.listJobs)
+	mux.HandleFunc("GET /jobs/{id}", s.getJob)
+	mux.HandleFunc("DELETE /jobs/{id}", s.cancelJob)
+	mux.HandleFunc("GET /jobs/{id}/results", s.streamResults)
+	mux.HandleFunc("GET /jobs/{id}/report", s.jobReport)
+	mux.HandleFunc("GET /reports/{check}", s.checkReport)
+	return mux
+}
+
+// requeue queues the jobs left queued or running by the last shutdown in submission order, waiting for the
+// workers when there are more than the queue holds
+func (s *jobServer) requeue(ctx context.Context) error {
+	pending := []*serveJob{}
+	if err := s.jobs.ForEachAfter("", "", func(_ string, value []byte) error {
+		job := &serveJob{}
+		if err := json.Unmarshal(value, job); err != nil {
+			return err
+		}
+		if job.Status == serveJobQueued || job.Status == serveJobRunning {
+			pending = append(pending, job)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, job := range pending {
+		if job.Status == serveJobRunning {
+			job.Status = serveJobQueued
+			if err := s.jobs.Insert(job.ID, job); err != nil {
+				return err
+			}
+		}
+		s.log.Info("requeuing job", zap.String("job", job.ID), zap.String("check", job.Check))
+		select {
+		case s.queue <- job.ID:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// work runs the queued jobs until ctx is done
+func (s *jobServer) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			s.runJob(ctx, id)
+		}
+	}
+}
+
+func (s *jobServer) checkLock(check string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, ok := s.checkLocks[check]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.checkLocks[check] = lock
+	}
+	return lock
+}
+
+// runJob runs a queued job once no other job of its check is running. A job interrupted because ctx is done stays
+// running and is run again on restart.
+func (s *jobServer) runJob(ctx context.Context, id string) {
+	s.mu.Lock()
+	job, err := s.loadJob(id)
+	s.mu.Unlock()
+	if err != nil || job == nil {
+		s.log.Error("failed to load job", zap.Error(err), zap.String("job", id))
+		return
+	}
+	lock := s.checkLock(job.Check)
+	lock.Lock()
+	defer lock.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	// the job may have been canceled while waiting
+	job, err = s.loadJob(id)
+	if err != nil || job == nil || job.Status != serveJobQueued {
+		s.mu.Unlock()
+		return
+	}
+	if err := s.clearResults(job); err != nil {
+		s.mu.Unlock()
+		s.log.Error("failed to clear job results", zap.Error(err), zap.String("job", id))
+		return
+	}
+	startedAt := time.Now().UTC()
+	job.Status = serveJobRunning
+	job.StartedAt = &startedAt
+	s.saveJob(job)
+	s.running[id] = &runningServeJob{job: job, cancel: cancel}
+	s.mu.Unlock()
+
+	s.log.Info("running job", zap.String("job", id), zap.String("check", job.Check))
+	unsubscribe := api.SubscribeResults(job.Check, func(event api.ResultEvent) {
+		s.recordResult(job, event)
+	})
+	err = s.run(jobCtx, job)
+	unsubscribe()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, id)
+	if ctx.Err() != nil {
+		s.log.Info("job interrupted, it runs again on restart", zap.String("job", id))
+		return
+	}
+	switch {
+	case jobCtx.Err() != nil:
+		job.Status = serveJobCanceled
+	case err != nil:
+		job.Status = serveJobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = serveJobDone
+	}
+	finishedAt := time.Now().UTC()
+	job.FinishedAt = &finishedAt
+	s.saveJob(job)
+	s.log.Info("job finished", zap.String("job", id), zap.String("status", job.Status), zap.Int("passed", job.Passed), zap.Int("failed", job.Failed))
+}
+
+// runCheck runs the check command of job with the flags of a one check run plan
+func (s *jobServer) runCheck(ctx context.Context, job *serveJob) (err error) {
+	step, newCheckCmd, err := s.resolveJob(job)
+	if err != nil {
+		return err
+	}
+	// a check that panics fails its job instead of the server
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("check panicked: %v", r)
+		}
+	}()
+	return runCheckCmd(ctx, newCheckCmd(), step.flags)
+}
+
+// resolveJob returns the run step of job and its check command
+func (s *jobServer) resolveJob(job *serveJob) (*runStep, func() *cobra.Command, error) {
+	newCheckCmd, rangeCheck := watchChecks[job.Check]
+	if !rangeCheck {
+		var ok bool
+		if newCheckCmd, ok = runAddressChecks[job.Check]; !ok {
+			return nil, nil, fmt.Errorf("check %s cannot be run as a job", job.Check)
+		}
+	}
+	takesAddresses := newCheckCmd().Flags().Lookup(internal.AddressFileFlag) != nil
+	if takesAddresses && len(job.Addresses) == 0 {
+		return nil, nil, fmt.Errorf("check %s requires addresses", job.Check)
+	}
+	if !takesAddresses && len(job.Addresses) > 0 {
+		return nil, nil, fmt.Errorf("check %s does not take addresses", job.Check)
+	}
+	if _, ok := job.Options[internal.NoResumeFlag]; ok {
+		return nil, nil, fmt.Errorf("check %s: %s is always set for jobs", job.Check, internal.NoResumeFlag)
+	}
+
+	plan := &runPlan{
+		DBPath: s.dbPath,
+		Start:  job.Start,
+		End:    job.End,
+		Checks: []runPlanCheck{{Name: job.Check, Options: job.Options}},
+	}
+	if takesAddresses {
+		plan.AddressFile = s.addressFile(job.ID)
+	}
+	steps, err := resolveRunPlan(plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	step := steps[0]
+	if step.rangeCheck {
+		step.flags[internal.StartFlag] = strconv.FormatInt(step.start, 10)
+		step.flags[internal.EndFlag] = strconv.FormatInt(step.end, 10)
+	}
+	// a job validates its whole range, even if its check already has results after it
+	step.flags[internal.NoResumeFlag] = "true"
+	return step, newCheckCmd, nil
+}
+
+func (s *jobServer) addressFile(id string) string {
+	return filepath.Join(s.dbPath, serveAddressesDir, id+".txt")
+}
+
+// recordResult stores a result of the check of job under the job with the next sequence number
+func (s *jobServer) recordResult(job *serveJob, event api.ResultEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := resultKey(job.ID, job.Passed+job.Failed)
+	result := validator.Result{
+		Check:   event.Check,
+		Height:  event.Height,
+		Address: event.Address,
+		Success: event.Success,
+	}
+	if event.Success {
+		job.Passed++
+	} else {
+		job.Failed++
+		result.Message = event.Message
+		result.Category = event.Category
+	}
+	if err := s.results.Insert(key, result); err != nil {
+		s.log.Error("failed to store job result", zap.Error(err), zap.String("job", job.ID))
+	}
+}
+
+// clearResults deletes the results of a previous run of job, a job run again after a restart validates its whole
+// range again
+func (s *jobServer) clearResults(job *serveJob) error {
+	job.Passed, job.Failed = 0, 0
+	return s.results.DeletePrefix(job.ID + "/")
+}
+
+func resultKey(id string, sequence int) string {
+	return fmt.Sprintf("%s/%012d", id, sequence)
+}
+
+// loadJob returns the job with id, a copy of the in memory one if it is running, nil if there is none. It is called
+// with mu held.
+func (s *jobServer) loadJob(id string) (*serveJob, error) {
+	if running, ok := s.running[id]; ok {
+		job := *running.job
+		return &job, nil
+	}
+	job := &serveJob{}
+	if err := s.jobs.Get(id, job); err != nil {
+		return nil, err
+	}
+	if job.ID == "" {
+		return nil, nil
+	}
+	return job, nil
+}
+
+func (s *jobServer) saveJob(job *serveJob) {
+	if err := s.jobs.Insert(job.ID, job); err != nil {
+		s.log.Error("failed to save job", zap.Error(err), zap.String("job", job.ID))
+	}
+}
+
+func (s *jobServer) submitJob(w http.ResponseWriter, r *http.Request) {
+	request := serveJobRequest{}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, serveMaxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeServeError(w, http.StatusBadRequest, fmt.Errorf("invalid job: %w", err))
+		return
+	}
+	job := &serveJob{
+		ID:              uuid.Must(uuid.NewV7()).String(),
+		serveJobRequest: request,
+		Status:          serveJobQueued,
+		CreatedAt:       time.Now().UTC(),
+	}
+	if _, _, err := s.resolveJob(job); err != nil {
+		writeServeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == cap(s.queue) {
+		writeServeError(w, http.StatusServiceUnavailable, fmt.Errorf("job queue is full"))
+		return
+	}
+	if len(job.Addresses) > 0 {
+		if err := os.WriteFile(s.addressFile(job.ID), []byte(strings.Join(job.Addresses, "\n")+"\n"), 0600); err != nil {
+			s.log.Error("failed to write address file", zap.Error(err), zap.String("job", job.ID))
+			writeServeError(w, http.StatusInternalServerError, fmt.Errorf("could not store addresses"))
+			return
+		}
+	}
+	if err := s.jobs.Insert(job.ID, job); err != nil {
+		s.log.Error("failed to save job", zap.Error(err), zap.String("job", job.ID))
+		writeServeError(w, http.StatusInternalServerError, fmt.Errorf("could not store job"))
+		return
+	}
+	s.queue <- job.ID
+	s.log.Info("job queued", zap.String("job", job.ID), zap.String("check", job.Check))
+	writeServeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *jobServer) listJobs(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := []*serveJob{}
+	if err := s.jobs.ForEachAfter("", "", func(id string, value []byte) error {
+		job := &serveJob{}
+		if err := json.Unmarshal(value, job); err != nil {
+			return err
+		}
+		if running, ok := s.running[id]; ok {
+			*job = *running.job
+		}
+		if status == "" || job.Status == status {
+			jobs = append(jobs, job)
+		}
+		return nil
+	}); err != nil {
+		s.log.Error("failed to list jobs", zap.Error(err))
+		writeServeError(w, http.StatusInternalServerError, fmt.Errorf("could not list jobs"))
+		return
+	}
+	writeServeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *jobServer) getJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.requestJob(w, r)
+	if ok {
+		writeServeJSON(w, http.StatusOK, job)
+	}
+}
+
+// cancelJob cancels a queued or running job, running jobs are canceled once their check returns
+func (s *jobServer) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if running, ok := s.running[id]; ok {
+		running.cancel()
+		writeServeJSON(w, http.StatusAccepted, running.job)
+		return
+	}
+	job, err := s.loadJob(id)
+	if err != nil {
+		s.log.Error("failed to load job", zap.Error(err), zap.String("job", id))
+		writeServeError(w, http.StatusInternalServerError, fmt.Errorf("could not load job"))
+		return
+	}
+	if job == nil {
+		writeServeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+		return
+	}
+	if job.Status != serveJobQueued {
+		writeServeError(w, http.StatusConflict, fmt.Errorf("job %s is already %s", id, job.Status))
+		return
+	}
+	finishedAt := time.Now().UTC()
+	job.Status = serveJobCanceled
+	job.FinishedAt = &finishedAt
+	s.saveJob(job)
+	s.log.Info("job canceled", zap.String("job", id))
+	writeServeJSON(w, http.StatusOK, job)
+}
+
+// streamResults writes the results of a job as newline delimited JSON, following them until the job finishes
+func (s *jobServer) streamResults(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.requestJob(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	after := ""
+	for {
+		// the results are read after the status, so those of a finished job are all written
+		finished := job.finished()
+		// the results are copied before writing them, so slow clients do not hold the database
+		var lines []byte
+		if err := s.results.ForEachAfter(job.ID+"/", after, func(key string, value []byte) error {
+			after = key
+			lines = append(append(lines, value...), '\n')
+			return nil
+		}); err != nil {
+			s.log.Error("failed to read job results", zap.Error(err), zap.String("job", job.ID))
+			return
+		}
+		if _, err := w.Write(lines); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if finished {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(serveStreamInterval):
+		}
+		s.mu.Lock()
+		current, err := s.loadJob(job.ID)
+		s.mu.Unlock()
+		if err != nil || current == nil {
+			s.log.Error("failed to load job", zap.Error(err), zap.String("job", job.ID))
+			return
+		}
+		job = current
+	}
+}
+
+// jobReport counts the results in the database of the job check over the job range, including heights validated
+// before the job
+func (s *jobServer) jobReport(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.requestJob(w, r)
+	if !ok {
+		return
+	}
+	step := &runStep{check: job.Check, start: job.Start, end: job.End}
+	if job.Error != "" {
+		step.err = errors.New(job.Error)
+	}
+	s.writeReport(w, step)
+}
+
+// checkReport counts every result in the database of a check
+func (s *jobServer) checkReport(w http.ResponseWriter, r *http.Request) {
+	check := r.PathValue("check")
+	if !availableChecks[check] {
+		writeServeError(w, http.StatusNotFound, fmt.Errorf("check %s not found", check))
+		return
+	}
+	s.writeReport(w, &runStep{check: check})
+}
+
+func (s *jobServer) writeReport(w http.ResponseWriter, step *runStep) {
+	report, err := runStepReport(s.dbPath, step, serveReportDBTimeout)
+	if errors.Is(err, bolt.ErrTimeout) {
+		writeServeError(w, http.StatusConflict, fmt.Errorf("database of check %s is in use by a running job", step.check))
+		return
+	}
+	if err != nil {
+		s.log.Error("failed to read check results", zap.Error(err), zap.String("check", step.check))
+		writeServeError(w, http.StatusInternalServerError, fmt.Errorf("could not read results of check %s", step.check))
+		return
+	}
+	writeServeJSON(w, http.StatusOK, report)
+}
+
+// requestJob returns the job of the id path value, writing the error response if there is none
+func (s *jobServer) requestJob(w http.ResponseWriter, r *http.Request) (*serveJob, bool) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	job, err := s.loadJob(id)
+	s.mu.Unlock()
+	if err != nil {
+		s.log.Error("failed to load job", zap.Error(err), zap.String("job", id))
+		writeServeError(w, http.StatusInternalServerError, fmt.Errorf("could not load job"))
+		return nil, false
+	}
+	if job == nil {
+		writeServeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+		return nil, false
+	}
+	return job, true
+}
+
+func writeServeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeServeError(w http.ResponseWriter, status int, err error) {
+	writeServeJSON(w, status, map[string]string{"error": err.Error()})
+}
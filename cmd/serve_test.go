@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"github.com/zondax/fil-trace-check/internal/types"
+	"github.com/zondax/fil-trace-check/validator"
+	"go.uber.org/zap"
+)
+
+func newTestJobServer(t *testing.T, dbPath string, queueSize int) *jobServer {
+	server, err := newJobServer(dbPath, queueSize, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Close() })
+	return server
+}
+
+func serveRequest(t *testing.T, server *jobServer, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	server.handler().ServeHTTP(recorder, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+	return recorder
+}
+
+func decodeServeJob(t *testing.T, recorder *httptest.ResponseRecorder) *serveJob {
+	job := &serveJob{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), job), recorder.Body.String())
+	return job
+}
+
+func TestServeSubmitJob(t *testing.T) {
+	server := newTestJobServer(t, t.TempDir(), 1)
+
+	for body, message := range map[string]string{
+		`{"check":"unknown","start":1,"end":2}`:                                              "check unknown cannot be run as a job",
+		`{"check":"validate-null-blocks"}`:                                                   "check validate-null-blocks requires a start and an end after it",
+		`{"check":"validate-address-balance"}`:                                               "check validate-address-balance requires addresses",
+		`{"check":"validate-null-blocks","start":1,"end":2,"addresses":["f01"]}`:             "check validate-null-blocks does not take addresses",
+		`{"check":"validate-null-blocks","start":1,"end":2,"options":{"db-path":"x"}}`:       "check validate-null-blocks: db-path is set from the plan fields, not options",
+		`{"check":"validate-null-blocks","start":1,"end":2,"options":{"no-resume":"false"}}`: "check validate-null-blocks: no-resume is always set for jobs",
+	} {
+		recorder := serveRequest(t, server, http.MethodPost, "/jobs", body)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, body)
+		assert.Contains(t, recorder.Body.String(), message, body)
+	}
+
+	recorder := serveRequest(t, server, http.MethodPost, "/jobs", `{"check":"validate-address-balance","addresses":["f01","f02"],"start":10,"end":20}`)
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	job := decodeServeJob(t, recorder)
+	assert.Equal(t, serveJobQueued, job.Status)
+	addresses, err := os.ReadFile(server.addressFile(job.ID))
+	require.NoError(t, err)
+	assert.Equal(t, "f01\nf02\n", string(addresses))
+
+	step, _, err := server.resolveJob(job)
+	require.NoError(t, err)
+	assert.Equal(t, server.addressFile(job.ID), step.flags[internal.AddressFileFlag])
+	assert.Equal(t, "10", step.flags[internal.EventStartFlag])
+	assert.Equal(t, "true", step.flags[internal.NoResumeFlag])
+
+	recorder = serveRequest(t, server, http.MethodPost, "/jobs", `{"check":"validate-null-blocks","start":1,"end":2}`)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	recorder = serveRequest(t, server, http.MethodGet, "/jobs?status=queued", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	jobs := []*serveJob{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &jobs))
+	require.Len(t, jobs, 1)
+	assert.Equal(t, job.ID, jobs[0].ID)
+
+	assert.Equal(t, http.StatusNotFound, serveRequest(t, server, http.MethodGet, "/jobs/missing", "").Code)
+}
+
+func TestServeRunJob(t *testing.T) {
+	server := newTestJobServer(t, t.TempDir(), 10)
+	server.run = func(_ context.Context, job *serveJob) error {
+		step, _, err := server.resolveJob(job)
+		require.NoError(t, err)
+		assert.Equal(t, "100", step.flags[internal.StartFlag])
+		assert.Equal(t, "101", step.flags[internal.EndFlag])
+		assert.Equal(t, "true", step.flags[internal.NoResumeFlag])
+		api.PublishResult(api.ResultEvent{Check: job.Check, Height: 100, Success: true, Message: internal.ProgressOK})
+		api.PublishResult(api.ResultEvent{Check: internal.CanonicalChainCheck, Height: 100, Success: true})
+		api.PublishResult(api.ResultEvent{Check: job.Check, Height: 101, Message: "trace is null but tipset is not"})
+		return nil
+	}
+
+	recorder := serveRequest(t, server, http.MethodPost, "/jobs", `{"check":"validate-null-blocks","start":100,"end":101}`)
+	require.Equal(t, http.StatusAccepted, recorder.Code, recorder.Body.String())
+	id := decodeServeJob(t, recorder).ID
+	server.runJob(context.Background(), <-server.queue)
+
+	job := decodeServeJob(t, serveRequest(t, server, http.MethodGet, "/jobs/"+id, ""))
+	assert.Equal(t, serveJobDone, job.Status)
+	assert.Equal(t, 1, job.Passed)
+	assert.Equal(t, 1, job.Failed)
+	assert.NotNil(t, job.FinishedAt)
+
+	recorder = serveRequest(t, server, http.MethodGet, "/jobs/"+id+"/results", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	results := []validator.Result{}
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		result := validator.Result{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &result))
+		results = append(results, result)
+	}
+	assert.Equal(t, []validator.Result{
+		{Check: internal.NullBlocksCheck, Height: 100, Success: true},
+		{Check: internal.NullBlocksCheck, Height: 101, Message: "trace is null but tipset is not"},
+	}, results)
+
+	assert.Equal(t, http.StatusConflict, serveRequest(t, server, http.MethodDelete, "/jobs/"+id, "").Code)
+}
+
+func TestServeCancelJob(t *testing.T) {
+	server := newTestJobServer(t, t.TempDir(), 10)
+	server.run = func(ctx context.Context, _ *serveJob) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	queued := decodeServeJob(t, serveRequest(t, server, http.MethodPost, "/jobs", `{"check":"validate-json","start":1,"end":2}`))
+	recorder := serveRequest(t, server, http.MethodDelete, "/jobs/"+queued.ID, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, serveJobCanceled, decodeServeJob(t, recorder).Status)
+	// canceled jobs are skipped by the workers
+	server.runJob(context.Background(), <-server.queue)
+	assert.Equal(t, serveJobCanceled, decodeServeJob(t, serveRequest(t, server, http.MethodGet, "/jobs/"+queued.ID, "")).Status)
+
+	running := decodeServeJob(t, serveRequest(t, server, http.MethodPost, "/jobs", `{"check":"validate-json","start":1,"end":2}`))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.runJob(context.Background(), <-server.queue)
+	}()
+	require.Eventually(t, func() bool {
+		return decodeServeJob(t, serveRequest(t, server, http.MethodGet, "/jobs/"+running.ID, "")).Status == serveJobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusAccepted, serveRequest(t, server, http.MethodDelete, "/jobs/"+running.ID, "").Code)
+	<-done
+	assert.Equal(t, serveJobCanceled, decodeServeJob(t, serveRequest(t, server, http.MethodGet, "/jobs/"+running.ID, "")).Status)
+}
+
+func TestServeRequeue(t *testing.T) {
+	dbPath := t.TempDir()
+	server := newTestJobServer(t, dbPath, 10)
+	server.run = func(ctx context.Context, job *serveJob) error {
+		api.PublishResult(api.ResultEvent{Check: job.Check, Height: 1, Success: true})
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	first := decodeServeJob(t, serveRequest(t, server, http.MethodPost, "/jobs", `{"check":"validate-json","start":1,"end":2}`))
+	second := decodeServeJob(t, serveRequest(t, server, http.MethodPost, "/jobs", `{"check":"validate-null-blocks","start":1,"end":2}`))
+
+	// a shutdown interrupts the first job, the second is still queued
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.runJob(ctx, <-server.queue)
+	}()
+	require.Eventually(t, func() bool {
+		return decodeServeJob(t, serveRequest(t, server, http.MethodGet, "/jobs/"+first.ID, "")).Status == serveJobRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	require.NoError(t, server.Close())
+
+	server = newTestJobServer(t, dbPath, 10)
+	require.NoError(t, server.requeue(context.Background()))
+	require.Len(t, server.queue, 2)
+	assert.Equal(t, first.ID, <-server.queue)
+	assert.Equal(t, second.ID, <-server.queue)
+	job := decodeServeJob(t, serveRequest(t, server, http.MethodGet, "/jobs/"+first.ID, ""))
+	assert.Equal(t, serveJobQueued, job.Status)
+
+	// the interrupted job validates its whole range again, replacing the results of the interrupted run
+	server.run = func(_ context.Context, job *serveJob) error {
+		api.PublishResult(api.ResultEvent{Check: job.Check, Height: 1, Success: true})
+		api.PublishResult(api.ResultEvent{Check: job.Check, Height: 2, Success: true})
+		return nil
+	}
+	server.runJob(context.Background(), first.ID)
+	job = decodeServeJob(t, serveRequest(t, server, http.MethodGet, "/jobs/"+first.ID, ""))
+	assert.Equal(t, serveJobDone, job.Status)
+	assert.Equal(t, 2, job.Passed)
+	recorder := serveRequest(t, server, http.MethodGet, "/jobs/"+first.ID+"/results", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 2, bytes.Count(recorder.Body.Bytes(), []byte("\n")))
+}
+
+func TestServeReports(t *testing.T) {
+	dbPath := t.TempDir()
+	server := newTestJobServer(t, dbPath, 10)
+	db, err := api.NewDB(dbPath, internal.NullBlocksCheck)
+	require.NoError(t, err)
+	require.NoError(t, db.Insert("100", types.Progress{Success: true, Message: internal.ProgressOK}))
+	require.NoError(t, db.Insert("101", types.Progress{Success: false, Message: "trace is null but tipset is not"}))
+
+	// the database is in use
+	recorder := serveRequest(t, server, http.MethodGet, "/reports/"+internal.NullBlocksCheck, "")
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	require.NoError(t, db.Close())
+
+	recorder = serveRequest(t, server, http.MethodGet, "/reports/"+internal.NullBlocksCheck, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	report := runCheckReport{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, 1, report.Passed)
+	assert.Equal(t, 1, report.Failed)
+
+	job := decodeServeJob(t, serveRequest(t, server, http.MethodPost, "/jobs", `{"check":"validate-null-blocks","start":101,"end":200}`))
+	recorder = serveRequest(t, server, http.MethodGet, "/jobs/"+job.ID+"/report", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	report = runCheckReport{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.Equal(t, runCheckReport{
+		Check:    internal.NullBlocksCheck,
+		Start:    101,
+		End:      200,
+		Failed:   1,
+		Failures: map[string]string{"101": "trace is null but tipset is not"},
+	}, report)
+
+	assert.Equal(t, http.StatusNotFound, serveRequest(t, server, http.MethodGet, "/reports/unknown", "").Code)
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/zondax/fil-trace-check/api"
+	"go.uber.org/zap"
+)
+
+// AddRunSummary logs the requests and the time spent waiting for the rate limiters when a command ends, the summary
+// is logged from a deferred finalizer so failed commands log it too
+func AddRunSummary() {
+	cobra.OnFinalize(logRunSummary)
+}
+
+func logRunSummary() {
+	log := initLogger()
+	for _, stats := range api.GetRateLimiterStats() {
+		log.Info("run summary",
+			zap.String("limiter", stats.Name),
+			zap.Int64("requests", stats.Requests),
+			zap.Duration("waited", stats.Waited),
+		)
+	}
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"github.com/zondax/fil-trace-check/validator"
+	"go.uber.org/zap"
+)
+
+// traceCheckEnv is what the checks are created with
+type traceCheckEnv struct {
+	network      *api.NetworkProfile
+	rpcClient    api.RPCClientInterface
+	addressCache *internal.AddressCache
+	log          *zap.Logger
+}
+
+type traceCheckDefinition struct {
+	// node is true for checks that query the node
+	node bool
+	// addressCache is true for checks that resolve equivalent addresses
+	addressCache bool
+	new          func(env *traceCheckEnv) validator.Check
+}
+
+// traceChecks are the checks validateTraces can run in one pass
+var traceChecks = map[string]traceCheckDefinition{
+	internal.ValidateJSONCheck: {
+		new: func(env *traceCheckEnv) validator.Check { return validator.NewJSONCheck(env.network) },
+	},
+	internal.NullBlocksCheck: {
+		node: true,
+		new:  func(_ *traceCheckEnv) validator.Check { return validator.NullBlocksCheck{} },
+	},
+	internal.CanonicalChainCheck: {
+		node:         true,
+		addressCache: true,
+		new: func(env *traceCheckEnv) validator.Check {
+			return validator.NewCanonicalChainCheck(env.network, env.rpcClient, env.log).WithAddressCache(env.addressCache)
+		},
+	},
+}
+
+func ValidateTracesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.ValidateTracesCommand,
+		Short: "Run several trace checks in one pass over a range",
+		Long: fmt.Sprintf(`Run the selected checks in one pass over a range, every trace is downloaded and decoded once per
+epoch. Each check stores its results in its own database as if run on its own.
+
+Supported checks: %s`, strings.Join(slices.Sorted(maps.Keys(traceChecks)), ", ")),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			checks, err := cmd.Flags().GetStringSlice(internal.ChecksFlag)
+			if err != nil {
+				initLogger().Error("failed to get checks", zap.Error(err))
+				return err
+			}
+			return validateTraces(cmd, checks)
+		},
+	}
+	cmd.Flags().StringSlice(internal.ChecksFlag, nil, "comma separated checks to run")
+	cmd.Flags().Int64(internal.StartFlag, 1, "start height to validate")
+	cmd.Flags().Int64(internal.EndFlag, 100, "end height to validate")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	cmd.Flags().Bool(internal.NoResumeFlag, false, "validate the whole range again instead of resuming after the latest validated height")
+	return cmd
+}
+
+// validateTraces runs checks over the range of the start and end flags with a validator.TraceValidator storing the
+// results in the databases in the db path
+func validateTraces(cmd *cobra.Command, checks []string) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx := cmd.Context()
+	if err := config.Validate(); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	network, err := config.Network()
+	if err != nil {
+		log.Error("could not get network profile", zap.Error(err), zap.String("network", config.NetworkName))
+		return err
+	}
+
+	start, err := cmd.Flags().GetInt64(internal.StartFlag)
+	if err != nil {
+		log.Error("failed to get start", zap.Error(err))
+		return err
+	}
+	end, err := cmd.Flags().GetInt64(internal.EndFlag)
+	if err != nil {
+		log.Error("failed to get end", zap.Error(err))
+		return err
+	}
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("failed to get db path", zap.Error(err))
+		return err
+	}
+	noResume, err := cmd.Flags().GetBool(internal.NoResumeFlag)
+	if err != nil {
+		log.Error("failed to get no resume", zap.Error(err))
+		return err
+	}
+	if err := validateTraceChecks(checks); err != nil {
+		log.Error("invalid checks", zap.Error(err))
+		return err
+	}
+
+	env := &traceCheckEnv{network: network, log: log}
+	var node, addressCache bool
+	for _, check := range checks {
+		node = node || traceChecks[check].node
+		addressCache = addressCache || traceChecks[check].addressCache
+	}
+	requirements := []api.Requirement{api.RequireTraceSource}
+	if node {
+		requirements = append(requirements, api.RequireNode)
+	}
+	if err := config.Require(requirements...); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+	if addressCache {
+		var closeAddressCache func()
+		env.addressCache, closeAddressCache = openAddressCache(ctx, dbPath, log)
+		defer closeAddressCache()
+	}
+	if node {
+		rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+		if err != nil {
+			log.Error("failed to create rpc client", zap.Error(err))
+			return err
+		}
+		defer closeRPCClient(rpcClient)
+		env.rpcClient = rpcClient
+	}
+	traces, err := validator.NewDataStoreTraceSource(&config)
+	if err != nil {
+		log.Error("failed to create data store client", zap.Error(err))
+		return err
+	}
+	store := validator.NewDBProgressStore(dbPath)
+	defer func() {
+		if err := store.Close(); err != nil {
+			log.Error("failed to close database", zap.Error(err))
+		}
+	}()
+	traceValidator, err := validator.NewTraceValidator(validator.TraceValidatorConfig{
+		RPCClient: env.rpcClient,
+		Traces:    traces,
+		Store:     store,
+		Log:       log,
+	})
+	if err != nil {
+		log.Error("failed to create validator", zap.Error(err))
+		return err
+	}
+
+	options := validator.TraceOptions{Start: start, End: end, NoResume: noResume}
+	for _, check := range checks {
+		options.Checks = append(options.Checks, traceChecks[check].new(env))
+	}
+	report, err := traceValidator.Validate(ctx, options)
+	if err != nil {
+		log.Error("failed to validate traces", zap.Error(err))
+		return err
+	}
+	for _, check := range checks {
+		checkReport := report.Checks[check]
+		log.Info("check results", zap.String("check", check), zap.Int("passed", checkReport.Passed), zap.Int("failed", checkReport.Failed))
+	}
+	return nil
+}
+
+func validateTraceChecks(checks []string) error {
+	if len(checks) == 0 {
+		return fmt.Errorf("at least one check is required")
+	}
+	for i, check := range checks {
+		if _, ok := traceChecks[check]; !ok {
+			return fmt.Errorf("check %s cannot run in a trace pass, expected one of %s", check, strings.Join(slices.Sorted(maps.Keys(traceChecks)), ", "))
+		}
+		if slices.Contains(checks[:i], check) {
+			return fmt.Errorf("check %s is selected more than once", check)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zondax/fil-trace-check/internal"
+)
+
+func TestValidateTraceChecks(t *testing.T) {
+	assert.NoError(t, validateTraceChecks([]string{internal.ValidateJSONCheck, internal.NullBlocksCheck, internal.CanonicalChainCheck}))
+
+	assert.Error(t, validateTraceChecks(nil))
+	assert.Error(t, validateTraceChecks([]string{internal.PowerClaimsCheck}))
+	assert.Error(t, validateTraceChecks([]string{internal.ValidateJSONCheck, internal.ValidateJSONCheck}))
+
+	for name, definition := range traceChecks {
+		assert.Equal(t, name, definition.new(&traceCheckEnv{}).Name())
+	}
+}
@@ -1,25 +1,46 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/bytedance/sonic"
+	address "github.com/filecoin-project/go-address"
 	apitypes "github.com/filecoin-project/lotus/api"
 	lotusTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/spf13/cobra"
 	parserV1 "github.com/zondax/fil-parser/parser/v1"
 	typesV1 "github.com/zondax/fil-parser/parser/v1/types"
 	parserV2 "github.com/zondax/fil-parser/parser/v2"
 	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"go.uber.org/zap"
 )
 
-func filterTrace(height int64, equivalentAddresses map[string]bool, data []byte) ([]byte, error) {
-	switch api.HeightToParserVersion(height) {
+// filterTrace keeps the successful messages sent or received by the addresses with their matching subcalls
+func filterTrace(network *api.NetworkProfile, height int64, equivalentAddresses map[string]bool, data []byte) ([]byte, error) {
+	return filterTraceMessages(network, height, equivalentAddresses, false, data)
+}
+
+// filterTraceWithSubcalls is filterTrace that also keeps the messages only reaching the addresses in their
+// subcalls, e.g. the implicit cron messages that update the power claims of miners
+func filterTraceWithSubcalls(network *api.NetworkProfile, height int64, equivalentAddresses map[string]bool, data []byte) ([]byte, error) {
+	return filterTraceMessages(network, height, equivalentAddresses, true, data)
+}
+
+// filterTraceMessages filters data by the parser version of height. Messages only reaching the addresses in their
+// subcalls are kept with keepSubcallMatches, v1 traces always keep them.
+func filterTraceMessages(network *api.NetworkProfile, height int64, equivalentAddresses map[string]bool, keepSubcallMatches bool, data []byte) ([]byte, error) {
+	switch network.HeightToParserVersion(height) {
 	case parserV1.Version:
 		return filterTraceV1(equivalentAddresses, data)
 	case parserV2.Version:
-		return filterTraceV2(equivalentAddresses, data)
+		return filterTraceV2(equivalentAddresses, keepSubcallMatches, data)
 	default:
-		return nil, fmt.Errorf("unknown compute state version: %s", api.HeightToParserVersion(height))
+		return nil, fmt.Errorf("unknown compute state version: %s", network.HeightToParserVersion(height))
 	}
 }
 
@@ -89,7 +110,7 @@ func filterSubcallsV1(equivalentAddresses map[string]bool, subcalls []typesV1.Ex
 	return filteredSubcalls
 }
 
-func filterTraceV2(equivalentAddresses map[string]bool, data []byte) ([]byte, error) {
+func filterTraceV2(equivalentAddresses map[string]bool, keepSubcallMatches bool, data []byte) ([]byte, error) {
 	var computeState apitypes.ComputeStateOutput
 	err := sonic.Unmarshal(data, &computeState)
 	if err != nil {
@@ -103,11 +124,16 @@ func filterTraceV2(equivalentAddresses map[string]bool, data []byte) ([]byte, er
 		}
 		filteredSubcalls := filterSubcallsV2(equivalentAddresses, trace.ExecutionTrace.Subcalls)
 		trace.ExecutionTrace.Subcalls = filteredSubcalls
+		added := false
 		if trace.Msg != nil {
 			if equivalentAddresses[trace.Msg.To.String()] || equivalentAddresses[trace.Msg.From.String()] {
 				filteredTrace = append(filteredTrace, trace)
+				added = true
 			}
 		}
+		if keepSubcallMatches && !added && len(filteredSubcalls) > 0 {
+			filteredTrace = append(filteredTrace, trace)
+		}
 	}
 	computeState.Trace = filteredTrace
 
@@ -146,3 +172,168 @@ func filterSubcallsV2(equivalentAddresses map[string]bool, subcalls []lotusTypes
 
 	return filteredSubcalls
 }
+
+// equivalentAddressesAt resolves the equivalent addresses addr has in the trace of tipset: those of its actor once the
+// messages of tipset are applied, at nextTipset, so actors created by them are included, or before they are applied,
+// at tipset, for actors deleted by them. It returns an internal.ErrActorNotFound error if the actor exists in
+// neither state.
+func equivalentAddressesAt(ctx context.Context, addr address.Address, tipset, nextTipset *lotusTypes.TipSet, rpcClient api.RPCClientInterface, cache *internal.AddressCache) (map[string]bool, error) {
+	addresses, err := internal.GetEquivalentAddressesAt(ctx, addr, nextTipset, rpcClient.FullNodeClient(), cache)
+	if !errors.Is(err, internal.ErrActorNotFound) {
+		return addresses, err
+	}
+	return internal.GetEquivalentAddressesAt(ctx, addr, tipset, rpcClient.FullNodeClient(), cache)
+}
+
+// heightEquivalentAddresses resolves the equivalent addresses of every address in the trace of tipset with
+// equivalentAddressesAt, and returns them by address together with all of them to filter the trace. Addresses whose
+// actor exists in neither state are left out, they have no state to validate at this height.
+func heightEquivalentAddresses(ctx context.Context, addresses map[string]address.Address, tipset, nextTipset *lotusTypes.TipSet, rpcClient api.RPCClientInterface, cache *internal.AddressCache) (map[string]map[string]bool, map[string]bool, error) {
+	byAddress := map[string]map[string]bool{}
+	all := map[string]bool{}
+	for addr, parsedAddress := range addresses {
+		equivalentAddresses, err := equivalentAddressesAt(ctx, parsedAddress, tipset, nextTipset, rpcClient, cache)
+		if errors.Is(err, internal.ErrActorNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get equivalent addresses of %s: %w", addr, err)
+		}
+		byAddress[addr] = equivalentAddresses
+		maps.Copy(all, equivalentAddresses)
+	}
+	return byAddress, all, nil
+}
+
+// resumeHeight returns the latest height validated in db for the command to resume after, 0 with --no-resume so
+// that the whole range is validated again
+func resumeHeight(cmd *cobra.Command, db *api.DB) (int64, error) {
+	noResume, err := cmd.Flags().GetBool(internal.NoResumeFlag)
+	if err != nil {
+		return 0, err
+	}
+	if noResume {
+		return 0, nil
+	}
+	return db.GetLatestHeight()
+}
+
+// actorExistsAt reports whether the actor of addr is in the state tipset was computed from
+func actorExistsAt(ctx context.Context, addr address.Address, tipset *lotusTypes.TipSet, rpcClient api.RPCClientInterface, cache *internal.AddressCache) (bool, error) {
+	_, err := internal.GetEquivalentAddressesAt(ctx, addr, tipset, rpcClient.FullNodeClient(), cache)
+	if errors.Is(err, internal.ErrActorNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// openAddressCache opens the shared address equivalence cache in dbPath, validations still run without it, with a
+// nil cache, when it cannot be opened, e.g. while another process holds it. The returned func closes it and logs its
+// stats. The cache passed in ctx by a command running several checks is returned instead, closing it is left to
+// that command.
+func openAddressCache(ctx context.Context, dbPath string, log *zap.Logger) (*internal.AddressCache, func()) {
+	if cache, ok := internal.AddressCacheFromContext(ctx); ok {
+		return cache, func() {}
+	}
+	cache, err := internal.OpenAddressCache(dbPath)
+	if err != nil {
+		log.Warn("running without address cache", zap.Error(err))
+		return nil, func() {}
+	}
+	return cache, func() {
+		hits, misses := cache.Stats()
+		log.Info("address cache stats", zap.Int64("hits", hits), zap.Int64("misses", misses), zap.Float64("hit-rate", cache.HitRate()))
+		if err := cache.Close(); err != nil {
+			log.Error("failed to close address cache", zap.Error(err))
+		}
+	}
+}
+
+// traceAddresses returns the addresses filterTraceWithSubcalls matches in data: senders and receivers of successful
+// messages and of successful subcalls at any depth
+func traceAddresses(network *api.NetworkProfile, height int64, data []byte) ([]string, error) {
+	addresses := map[string]bool{}
+	switch network.HeightToParserVersion(height) {
+	case parserV1.Version:
+		computeState := &typesV1.ComputeStateOutputV1{}
+		if err := sonic.Unmarshal(data, &computeState); err != nil {
+			return nil, fmt.Errorf("error unmarshalling trace: %w", err)
+		}
+		for _, trace := range computeState.Trace {
+			if trace.MsgRct.ExitCode.IsError() {
+				continue
+			}
+			if trace.Msg != nil {
+				addresses[trace.Msg.To.String()] = true
+				addresses[trace.Msg.From.String()] = true
+			}
+			collectSubcallAddressesV1(addresses, trace.ExecutionTrace.Subcalls)
+		}
+	case parserV2.Version:
+		var computeState apitypes.ComputeStateOutput
+		if err := sonic.Unmarshal(data, &computeState); err != nil {
+			return nil, fmt.Errorf("error unmarshalling trace: %w", err)
+		}
+		for _, trace := range computeState.Trace {
+			if trace.MsgRct != nil && trace.MsgRct.ExitCode.IsError() {
+				continue
+			}
+			if trace.Msg != nil {
+				addresses[trace.Msg.To.String()] = true
+				addresses[trace.Msg.From.String()] = true
+			}
+			collectSubcallAddressesV2(addresses, trace.ExecutionTrace.Subcalls)
+		}
+	default:
+		return nil, fmt.Errorf("unknown compute state version: %s", network.HeightToParserVersion(height))
+	}
+	return slices.Sorted(maps.Keys(addresses)), nil
+}
+
+func collectSubcallAddressesV1(addresses map[string]bool, subcalls []typesV1.ExecutionTraceV1) {
+	for _, subcall := range subcalls {
+		// filterSubcallsV1 drops the nested subcalls of failed subcalls too
+		if subcall.MsgRct != nil && subcall.MsgRct.ExitCode.IsError() {
+			continue
+		}
+		if subcall.Msg != nil {
+			addresses[subcall.Msg.To.String()] = true
+			addresses[subcall.Msg.From.String()] = true
+		}
+		collectSubcallAddressesV1(addresses, subcall.Subcalls)
+	}
+}
+
+func collectSubcallAddressesV2(addresses map[string]bool, subcalls []lotusTypes.ExecutionTrace) {
+	for _, subcall := range subcalls {
+		if subcall.MsgRct.ExitCode.IsError() {
+			continue
+		}
+		addresses[subcall.Msg.To.String()] = true
+		addresses[subcall.Msg.From.String()] = true
+		collectSubcallAddressesV2(addresses, subcall.Subcalls)
+	}
+}
+
+// equivalentAddressResolver resolves addresses for event providers that index the raw addresses of the traces
+func equivalentAddressResolver(rpcClient api.RPCClientInterface) func(ctx context.Context, addr string) (map[string]bool, error) {
+	return func(ctx context.Context, addr string) (map[string]bool, error) {
+		parsedAddress, err := address.NewFromString(addr)
+		if err != nil {
+			return nil, err
+		}
+		addresses, err := internal.GetEquivalentAddresses(ctx, parsedAddress, rpcClient.FullNodeClient())
+		if errors.Is(err, internal.ErrActorNotFound) {
+			// deleted actors are only searched by the address they were given with
+			return map[string]bool{addr: true}, nil
+		}
+		return addresses, err
+	}
+}
+
+// closeRPCClient logs the stats of the nodes and closes the connections of clients that support it
+func closeRPCClient(rpcClient api.RPCClientInterface) {
+	if closer, ok := rpcClient.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
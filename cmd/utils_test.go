@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	apitypes "github.com/filecoin-project/lotus/api"
 	"github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	typesV1 "github.com/zondax/fil-parser/parser/v1/types"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal/mocks"
 )
 
 func Test_filterSubcallsV1(t *testing.T) {
@@ -120,3 +128,160 @@ func assertSubCallsV2(t *testing.T, addrs map[string]bool, got []types.Execution
 		assertSubCallsV2(t, addrs, subcall.Subcalls)
 	}
 }
+
+func Test_traceAddresses(t *testing.T) {
+	addr := func(s string) address.Address {
+		a, err := address.NewFromString(s)
+		require.NoError(t, err)
+		return a
+	}
+	computeState := apitypes.ComputeStateOutput{
+		Trace: []*apitypes.InvocResult{
+			{
+				Msg:    &types.Message{From: addr("f01001"), To: addr("f01002")},
+				MsgRct: &types.MessageReceipt{ExitCode: exitcode.Ok},
+				ExecutionTrace: types.ExecutionTrace{
+					Subcalls: []types.ExecutionTrace{
+						{
+							Msg:    types.MessageTrace{From: addr("f01002"), To: addr("f01003")},
+							MsgRct: types.ReturnTrace{ExitCode: exitcode.Ok},
+							Subcalls: []types.ExecutionTrace{
+								{
+									Msg:    types.MessageTrace{From: addr("f01003"), To: addr("f01004")},
+									MsgRct: types.ReturnTrace{ExitCode: exitcode.Ok},
+								},
+							},
+						},
+						{
+							// failed subcalls and their nested subcalls are skipped
+							Msg:    types.MessageTrace{From: addr("f01002"), To: addr("f01005")},
+							MsgRct: types.ReturnTrace{ExitCode: exitcode.ErrForbidden},
+							Subcalls: []types.ExecutionTrace{
+								{
+									Msg:    types.MessageTrace{From: addr("f01005"), To: addr("f01006")},
+									MsgRct: types.ReturnTrace{ExitCode: exitcode.Ok},
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				Msg:    &types.Message{From: addr("f01007"), To: addr("f01008")},
+				MsgRct: &types.MessageReceipt{ExitCode: exitcode.SysErrOutOfGas},
+			},
+		},
+	}
+	data, err := json.Marshal(computeState)
+	require.NoError(t, err)
+	mainnet, err := api.GetNetworkProfile(api.MainnetNetwork)
+	require.NoError(t, err)
+
+	got, err := traceAddresses(mainnet, 5_000_000, data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"f01001", "f01002", "f01003", "f01004"}, got)
+}
+
+func Test_filterTrace(t *testing.T) {
+	addr := func(s string) address.Address {
+		a, err := address.NewFromString(s)
+		require.NoError(t, err)
+		return a
+	}
+	mainnet, err := api.GetNetworkProfile(api.MainnetNetwork)
+	require.NoError(t, err)
+	cronMessage := func(to string) *apitypes.InvocResult {
+		return &apitypes.InvocResult{
+			Msg:    &types.Message{From: addr("f00"), To: addr("f03")},
+			MsgRct: &types.MessageReceipt{ExitCode: exitcode.Ok},
+			ExecutionTrace: types.ExecutionTrace{
+				Msg:    types.MessageTrace{From: addr("f00"), To: addr("f03")},
+				MsgRct: types.ReturnTrace{ExitCode: exitcode.Ok},
+				Subcalls: []types.ExecutionTrace{{
+					Msg:    types.MessageTrace{From: addr("f03"), To: addr(to)},
+					MsgRct: types.ReturnTrace{ExitCode: exitcode.Ok},
+				}},
+			},
+		}
+	}
+	message := func(from, to string) *apitypes.InvocResult {
+		return &apitypes.InvocResult{
+			Msg:    &types.Message{From: addr(from), To: addr(to)},
+			MsgRct: &types.MessageReceipt{ExitCode: exitcode.Ok},
+			ExecutionTrace: types.ExecutionTrace{
+				Msg:    types.MessageTrace{From: addr(from), To: addr(to)},
+				MsgRct: types.ReturnTrace{ExitCode: exitcode.Ok},
+			},
+		}
+	}
+	filteredMessages := func(t *testing.T, data []byte) []string {
+		computeState := apitypes.ComputeStateOutput{}
+		require.NoError(t, json.Unmarshal(data, &computeState))
+		messages := []string{}
+		for _, trace := range computeState.Trace {
+			messages = append(messages, trace.Msg.From.String()+">"+trace.Msg.To.String())
+		}
+		return messages
+	}
+
+	for name, test := range map[string]struct {
+		// address is the one validated, only reached by the cron message in a subcall
+		address string
+		trace   []*apitypes.InvocResult
+		want    []string
+	}{
+		"validate-address-balance": {
+			address: "f01001",
+			trace:   []*apitypes.InvocResult{message("f01001", "f01002"), cronMessage("f01001"), message("f01003", "f01004")},
+			want:    []string{"f01001>f01002"},
+		},
+		"validate-multisig-state": {
+			address: "f02001",
+			trace:   []*apitypes.InvocResult{cronMessage("f02001"), message("f01001", "f02001")},
+			want:    []string{"f01001>f02001"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(apitypes.ComputeStateOutput{Trace: test.trace})
+			require.NoError(t, err)
+			addresses := map[string]bool{test.address: true}
+
+			// implicit messages only reaching the address in subcalls are not kept
+			filtered, err := filterTrace(mainnet, 5_000_000, addresses, data)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, filteredMessages(t, filtered))
+
+			filtered, err = filterTraceWithSubcalls(mainnet, 5_000_000, addresses, data)
+			require.NoError(t, err)
+			assert.Contains(t, filteredMessages(t, filtered), "f00>f03")
+		})
+	}
+}
+
+func Test_heightEquivalentAddresses(t *testing.T) {
+	tipset := testTipSet(t, 100)
+	nextTipset := testTipSet(t, 101)
+	miner, err := address.NewIDAddress(100)
+	require.NoError(t, err)
+	deleted, err := address.NewIDAddress(200)
+	require.NoError(t, err)
+	key, err := address.NewActorAddress([]byte("miner"))
+	require.NoError(t, err)
+
+	fullNodeMock := mocks.NewFullNode(t)
+	fullNodeMock.On("StateGetActor", mock.Anything, miner, nextTipset.Key()).Return(&types.Actor{}, nil)
+	fullNodeMock.On("StateAccountKey", mock.Anything, miner, nextTipset.Key()).Return(key, nil)
+	// over rpc the node reports missing id addresses with an untyped error
+	notFound := errors.New("resolution lookup failed (f0200): actor not found")
+	fullNodeMock.On("StateGetActor", mock.Anything, deleted, nextTipset.Key()).Return(nil, notFound)
+	fullNodeMock.On("StateGetActor", mock.Anything, deleted, tipset.Key()).Return(nil, notFound)
+
+	byAddress, all, err := heightEquivalentAddresses(t.Context(), map[string]address.Address{
+		miner.String():   miner,
+		deleted.String(): deleted,
+	}, tipset, nextTipset, &MockRPCClient{client: fullNodeMock}, nil)
+	require.NoError(t, err)
+	equivalentAddresses := map[string]bool{miner.String(): true, key.String(): true}
+	assert.Equal(t, map[string]map[string]bool{miner.String(): equivalentAddresses}, byAddress)
+	assert.Equal(t, equivalentAddresses, all)
+}
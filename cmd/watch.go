@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"go.uber.org/zap"
+)
+
+// watchChecks are the range checks watch can run, those with an address file flag get the watch address file
+var watchChecks = map[string]func() *cobra.Command{
+	internal.NullBlocksCheck:               ValidateNullBlocksCmd,
+	internal.ValidateJSONCheck:             ValidateJSONCmd,
+	internal.CanonicalChainCheck:           ValidateCanonicalChainCmd,
+	internal.ActorCreationCheck:            ValidateActorCreationCmd,
+	internal.AddressBalanceSequentialCheck: ValidateAddressBalanceSequentialCmd,
+	internal.MultisigStateSequentialCheck:  ValidateMultisigStateSequentialCmd,
+	internal.PowerClaimsCheck:              ValidatePowerClaimsCmd,
+	internal.MinerSectorsCheck:             ValidateMinerSectorsCmd,
+	internal.EvmAccountsCheck:              ValidateEvmAccountsCmd,
+	internal.IndexTracesCommand:            IndexTracesCmd,
+}
+
+func WatchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   internal.WatchCommand,
+		Short: "Follow the chain and run range checks on new epochs once they are final",
+		Long: fmt.Sprintf(`Follow the chain head and run the selected range checks on every epoch once it is final and its trace
+is in the store. Progress is saved per check in the watch database, restarts resume after the last
+validated epoch.
+
+Supported checks: %s`, strings.Join(slices.Sorted(maps.Keys(watchChecks)), ", ")),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return watch(cmd)
+		},
+	}
+	cmd.Flags().StringSlice(internal.ChecksFlag, nil, "comma separated checks to run")
+	cmd.Flags().Int64(internal.StartFlag, 0, "height to start from when a check has no saved progress, defaults to the final height")
+	cmd.Flags().Int64(internal.FinalityFlag, api.NodeCacheFinality, "epochs behind the head an epoch is final at")
+	cmd.Flags().Bool(internal.F3Flag, false, "use the latest F3 finality certificate instead of --finality")
+	cmd.Flags().Int64(internal.BatchSizeFlag, 100, "maximum epochs per check run")
+	cmd.Flags().Duration(internal.PollIntervalFlag, 30*time.Second, "interval to check for final epochs and traces without head changes")
+	cmd.Flags().String(internal.AddressFileFlag, "", "address file for the checks that need one")
+	cmd.Flags().String(internal.DBPathFlag, ".", "path to the database")
+	return cmd
+}
+
+func watch(cmd *cobra.Command) error {
+	config := api.GetGlobalConfigs()
+	log := initLogger()
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := config.Require(api.RequireNode, api.RequireTraceSource); err != nil {
+		log.Error("invalid config", zap.Error(err))
+		return err
+	}
+
+	checks, err := cmd.Flags().GetStringSlice(internal.ChecksFlag)
+	if err != nil {
+		log.Error("failed to get checks", zap.Error(err))
+		return err
+	}
+	start, err := cmd.Flags().GetInt64(internal.StartFlag)
+	if err != nil {
+		log.Error("failed to get start", zap.Error(err))
+		return err
+	}
+	finality, err := cmd.Flags().GetInt64(internal.FinalityFlag)
+	if err != nil {
+		log.Error("failed to get finality", zap.Error(err))
+		return err
+	}
+	useF3, err := cmd.Flags().GetBool(internal.F3Flag)
+	if err != nil {
+		log.Error("failed to get f3", zap.Error(err))
+		return err
+	}
+	batchSize, err := cmd.Flags().GetInt64(internal.BatchSizeFlag)
+	if err != nil {
+		log.Error("failed to get batch size", zap.Error(err))
+		return err
+	}
+	pollInterval, err := cmd.Flags().GetDuration(internal.PollIntervalFlag)
+	if err != nil {
+		log.Error("failed to get poll interval", zap.Error(err))
+		return err
+	}
+	addressFile, err := cmd.Flags().GetString(internal.AddressFileFlag)
+	if err != nil {
+		log.Error("failed to get address file", zap.Error(err))
+		return err
+	}
+	dbPath, err := cmd.Flags().GetString(internal.DBPathFlag)
+	if err != nil {
+		log.Error("failed to get db path", zap.Error(err))
+		return err
+	}
+	if err := validateWatchChecks(checks, addressFile); err != nil {
+		log.Error("invalid checks", zap.Error(err))
+		return err
+	}
+	if batchSize <= 0 || finality < 0 || pollInterval <= 0 {
+		err := fmt.Errorf("batch size and poll interval must be positive and finality cannot be negative")
+		log.Error("invalid flags", zap.Error(err))
+		return err
+	}
+
+	db, err := api.NewDB(dbPath, internal.WatchCommand)
+	if err != nil {
+		log.Error("failed to create db", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error("failed to close database", zap.Error(err))
+		}
+	}()
+	rpcClient, err := api.NewFilecoinRPCClient(ctx, &config)
+	if err != nil {
+		log.Error("failed to create rpc client", zap.Error(err))
+		return err
+	}
+	defer closeRPCClient(rpcClient)
+	// the checks run on every batch reuse the watch client instead of dialing the node each time
+	api.ShareRPCClient(rpcClient)
+	defer api.ShareRPCClient(nil)
+	dataStore, err := api.GetDataStoreClient(&config)
+	if err != nil {
+		log.Error("failed to create data store client", zap.Error(err))
+		return err
+	}
+
+	// finalHeight returns the head and the final height
+	finalHeight := func() (int64, int64, error) {
+		head, err := rpcClient.FullNodeClient().ChainHead(ctx)
+		if err != nil {
+			return 0, 0, fmt.Errorf("could not get chain head: %w", err)
+		}
+		if useF3 {
+			final, err := api.F3FinalHeight(ctx, rpcClient)
+			return int64(head.Height()), final, err
+		}
+		return int64(head.Height()), int64(head.Height()) - finality, nil
+	}
+
+	// next height to validate per check
+	next := map[string]int64{}
+	for _, check := range checks {
+		var last int64
+		if err := db.Get(check, &last); err != nil {
+			log.Error("failed to get watch progress", zap.Error(err), zap.String("check", check))
+			return err
+		}
+		switch {
+		case last > 0:
+			next[check] = last + 1
+		case start > 0:
+			next[check] = start
+		default:
+			_, final, err := finalHeight()
+			if err != nil {
+				log.Error("failed to get final height", zap.Error(err))
+				return err
+			}
+			next[check] = final
+		}
+		log.Info("watching", zap.String("check", check), zap.Int64("next-height", next[check]))
+	}
+
+	heads := watchHeads(ctx, rpcClient, pollInterval, log)
+	for ctx.Err() == nil {
+		progressed := false
+		head, final, err := finalHeight()
+		if err != nil {
+			log.Warn("failed to get final height", zap.Error(err))
+		}
+		for _, check := range checks {
+			if err != nil || ctx.Err() != nil {
+				break
+			}
+			api.RecordHeadLag(check, head-next[check])
+			batchEnd, ok := watchBatchEnd(next[check], final, batchSize)
+			if !ok {
+				continue
+			}
+			// traces are written in order, the last one of the batch is enough
+			if _, err := api.GetTraceFromDataStore(batchEnd, dataStore, &config); err != nil {
+				log.Info("waiting for trace", zap.Int64("height", batchEnd), zap.Error(err))
+				break
+			}
+			log.Info("running check", zap.String("check", check), zap.Int64("start", next[check]), zap.Int64("end", batchEnd))
+			if err := runWatchCheck(ctx, check, next[check], batchEnd, addressFile, dbPath); err != nil {
+				log.Error("check failed, retrying on the next head", zap.Error(err), zap.String("check", check))
+				continue
+			}
+			if err := db.Insert(check, batchEnd); err != nil {
+				log.Error("failed to save watch progress", zap.Error(err), zap.String("check", check))
+				return err
+			}
+			next[check] = batchEnd + 1
+			progressed = true
+		}
+
+		// catch up without waiting while checks make progress
+		if progressed {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-heads:
+		case <-time.After(pollInterval):
+		}
+	}
+	log.Info("stopping watch", zap.Error(ctx.Err()))
+	return nil
+}
+
+func validateWatchChecks(checks []string, addressFile string) error {
+	if len(checks) == 0 {
+		return fmt.Errorf("at least one check is required")
+	}
+	for _, check := range checks {
+		newCheckCmd, ok := watchChecks[check]
+		if !ok {
+			return fmt.Errorf("check %s cannot be watched", check)
+		}
+		if newCheckCmd().Flags().Lookup(internal.AddressFileFlag) != nil && addressFile == "" {
+			return fmt.Errorf("check %s requires --%s", check, internal.AddressFileFlag)
+		}
+	}
+	return nil
+}
+
+// watchBatchEnd returns the end of the next batch starting at next, false if next is not final yet
+func watchBatchEnd(next, final, batchSize int64) (int64, bool) {
+	if next > final {
+		return 0, false
+	}
+	return min(final, next+batchSize-1), true
+}
+
+// runWatchCheck runs check as if called from the command line for start..end
+func runWatchCheck(ctx context.Context, check string, start, end int64, addressFile, dbPath string) error {
+	flags := map[string]string{
+		internal.StartFlag:       strconv.FormatInt(start, 10),
+		internal.EndFlag:         strconv.FormatInt(end, 10),
+		internal.DBPathFlag:      dbPath,
+		internal.AddressFileFlag: addressFile,
+	}
+	return runCheckCmd(ctx, watchChecks[check](), flags)
+}
+
+// runCheckCmd runs checkCmd with flags as if called from the command line, flags checkCmd does not have are skipped
+func runCheckCmd(ctx context.Context, checkCmd *cobra.Command, flags map[string]string) error {
+	checkCmd.SetContext(ctx)
+	for name, value := range flags {
+		if checkCmd.Flags().Lookup(name) == nil {
+			continue
+		}
+		if err := checkCmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("could not set --%s: %w", name, err)
+		}
+	}
+	return checkCmd.RunE(checkCmd, nil)
+}
+
+// watchHeads signals head changes from ChainNotify, subscribing again after pollInterval when the subscription
+// fails or ends, e.g. over http where subscriptions are not supported
+func watchHeads(ctx context.Context, rpcClient api.RPCClientInterface, pollInterval time.Duration, log *zap.Logger) <-chan struct{} {
+	heads := make(chan struct{}, 1)
+	go func() {
+		for ctx.Err() == nil {
+			changes, err := rpcClient.FullNodeClient().ChainNotify(ctx)
+			if err != nil {
+				log.Warn("could not subscribe to head changes, polling", zap.Error(err))
+			} else {
+				for range changes {
+					select {
+					case heads <- struct{}{}:
+					default:
+					}
+				}
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(pollInterval):
+			}
+		}
+	}()
+	return heads
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zondax/fil-trace-check/internal"
+)
+
+func TestWatchBatchEnd(t *testing.T) {
+	_, ok := watchBatchEnd(101, 100, 10)
+	assert.False(t, ok)
+
+	end, ok := watchBatchEnd(100, 100, 10)
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), end)
+
+	end, ok = watchBatchEnd(50, 100, 10)
+	assert.True(t, ok)
+	assert.Equal(t, int64(59), end)
+}
+
+func TestValidateWatchChecks(t *testing.T) {
+	assert.NoError(t, validateWatchChecks([]string{internal.NullBlocksCheck, internal.ValidateJSONCheck}, ""))
+	assert.NoError(t, validateWatchChecks([]string{internal.PowerClaimsCheck}, "addresses.txt"))
+
+	assert.Error(t, validateWatchChecks(nil, ""))
+	// needs an address file
+	assert.Error(t, validateWatchChecks([]string{internal.PowerClaimsCheck}, ""))
+	// needs an event provider range
+	assert.Error(t, validateWatchChecks([]string{internal.AddressBalanceCheck}, "addresses.txt"))
+}
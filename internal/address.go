@@ -2,6 +2,8 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,30 +29,74 @@ func ReadAddressFile(addressFile string) ([]string, error) {
 	return addresses, nil
 }
 
+// ErrActorNotFound is returned when the actor of an address is not in the state tree it is resolved at
+var ErrActorNotFound = errors.New("actor not found")
+
+// GetEquivalentAddresses resolves the equivalent addresses of add at the chain head
 func GetEquivalentAddresses(ctx context.Context, add address.Address, rpcClient api.FullNode) (map[string]bool, error) {
+	return GetEquivalentAddressesAt(ctx, add, nil, rpcClient, nil)
+}
+
+// GetEquivalentAddressesAt resolves the equivalent addresses of add at the state of tipset, or the chain head if nil.
+// It returns an ErrActorNotFound error if the actor does not exist in that state. Resolutions at a tipset are read
+// from and stored in cache unless it is nil.
+func GetEquivalentAddressesAt(ctx context.Context, add address.Address, tipset *filTypes.TipSet, rpcClient api.FullNode, cache *AddressCache) (map[string]bool, error) {
+	if tipset == nil {
+		return resolveEquivalentAddresses(ctx, add, filTypes.EmptyTSK, rpcClient)
+	}
+	if cache != nil {
+		addresses, ok, err := cache.Get(add.String(), int64(tipset.Height()))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return addresses, nil
+		}
+	}
+	addresses, err := resolveEquivalentAddresses(ctx, add, tipset.Key(), rpcClient)
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s at height %d: %w", add, tipset.Height(), err)
+	}
+	if cache != nil {
+		if err := cache.Set(add.String(), int64(tipset.Height()), addresses); err != nil {
+			return nil, err
+		}
+	}
+	return addresses, nil
+}
+
+func resolveEquivalentAddresses(ctx context.Context, add address.Address, tsk filTypes.TipSetKey, rpcClient api.FullNode) (map[string]bool, error) {
 	addresses := map[string]bool{
 		add.String(): true,
 	}
-	actor, err := rpcClient.StateGetActor(ctx, add, filTypes.EmptyTSK)
+	if isRobustAddress(add) {
+		// get id address, the node only reports missing actors with a typed error for this lookup
+		idAddress, err := rpcClient.StateLookupID(ctx, add, tsk)
+		if err != nil {
+			if IsActorNotFound(err) {
+				return nil, ErrActorNotFound
+			}
+			return nil, err
+		}
+		addresses[idAddress.String()] = true
+	}
+	actor, err := rpcClient.StateGetActor(ctx, add, tsk)
 	if err != nil {
+		if IsActorNotFound(err) {
+			return nil, ErrActorNotFound
+		}
 		return nil, err
 	}
 	if actor.DelegatedAddress != nil {
 		addresses[actor.DelegatedAddress.String()] = true
 	}
 	if isRobustAddress(add) {
-		// get id address
-		idAddress, err := rpcClient.StateLookupID(ctx, add, filTypes.EmptyTSK)
-		if err != nil {
-			return nil, err
-		}
-		addresses[idAddress.String()] = true
 		return addresses, nil
 	}
-	key, err := rpcClient.StateAccountKey(ctx, add, filTypes.EmptyTSK)
+	key, err := rpcClient.StateAccountKey(ctx, add, tsk)
 	if err != nil {
 		if strings.Contains(err.Error(), "actor code is not account") {
-			robustAddress, err := rpcClient.StateLookupRobustAddress(ctx, add, filTypes.EmptyTSK)
+			robustAddress, err := rpcClient.StateLookupRobustAddress(ctx, add, tsk)
 			if err != nil {
 				return nil, err
 			}
@@ -64,6 +110,17 @@ func GetEquivalentAddresses(ctx context.Context, add address.Address, rpcClient
 	return addresses, nil
 }
 
+// IsActorNotFound reports lookups of actors missing from the state tree. Over rpc the node only sends it typed for
+// StateLookupID, other lookups of missing id addresses fail with an untyped error carrying the lotus message.
+func IsActorNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	var notFound *api.ErrActorNotFound
+	return errors.As(err, &notFound) || errors.Is(err, filTypes.ErrActorNotFound) || errors.Is(err, ErrActorNotFound) ||
+		strings.Contains(err.Error(), filTypes.ErrActorNotFound.Error())
+}
+
 func isRobustAddress(add address.Address) bool {
 	switch add.Protocol() {
 	case address.BLS, address.SECP256K1, address.Actor, address.Delegated:
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal/types"
+)
+
+const (
+	AddressCacheBucket = "address-equivalence"
+	// addressCacheLockTimeout is how long to wait for another process using the cache
+	addressCacheLockTimeout = 2 * time.Second
+)
+
+// AddressCache persists equivalent addresses by address and validity range. A resolution is only valid between the
+// heights it was seen at: an actor deleted and re-created under the same robust address gets a new id, so nothing is
+// known before the first or after the last resolution. It is safe for concurrent use.
+type AddressCache struct {
+	mu     sync.Mutex
+	db     *api.DB
+	hits   int64
+	misses int64
+}
+
+// OpenAddressCache opens the cache in dbPath, it fails if another process holds it
+func OpenAddressCache(dbPath string) (*AddressCache, error) {
+	db, err := api.NewDBWithTimeout(dbPath, AddressCacheBucket, addressCacheLockTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open address cache: %w", err)
+	}
+	return &AddressCache{db: db}, nil
+}
+
+type addressCacheKey struct{}
+
+// ContextWithAddressCache passes cache to the validations run with the returned context, so that checks run
+// together share it instead of each opening the database. A nil cache runs them without one.
+func ContextWithAddressCache(ctx context.Context, cache *AddressCache) context.Context {
+	return context.WithValue(ctx, addressCacheKey{}, cache)
+}
+
+// AddressCacheFromContext returns the cache passed with ContextWithAddressCache, ok is false if none was
+func AddressCacheFromContext(ctx context.Context) (*AddressCache, bool) {
+	cache, ok := ctx.Value(addressCacheKey{}).(*AddressCache)
+	return cache, ok
+}
+
+// Get returns the equivalent addresses of addr valid at height
+func (c *AddressCache) Get(addr string, height int64) (map[string]bool, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, err := c.entry(addr)
+	if err != nil {
+		return nil, false, err
+	}
+	if index := rangeAt(entry.Ranges, height); index >= 0 {
+		c.hits++
+		addresses := map[string]bool{}
+		for _, equivalentAddress := range entry.Ranges[index].Addresses {
+			addresses[equivalentAddress] = true
+		}
+		return addresses, true, nil
+	}
+	c.misses++
+	return nil, false, nil
+}
+
+// Set stores the equivalent addresses of addr resolved at height
+func (c *AddressCache) Set(addr string, height int64, addresses map[string]bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, err := c.entry(addr)
+	if err != nil {
+		return err
+	}
+	entry.Ranges = mergeEquivalenceRange(entry.Ranges, height, slices.Sorted(maps.Keys(addresses)))
+	return c.db.Insert(addr, entry)
+}
+
+// entry returns the ranges of addr, ranges stored without their last height are dropped
+func (c *AddressCache) entry(addr string) (types.AddressEquivalence, error) {
+	entry := types.AddressEquivalence{}
+	if err := c.db.Get(addr, &entry); err != nil {
+		return entry, err
+	}
+	entry.Ranges = slices.DeleteFunc(entry.Ranges, func(r types.EquivalenceRange) bool { return r.To < r.From })
+	return entry, nil
+}
+
+// Stats returns the cache hits and misses since it was opened
+func (c *AddressCache) Stats() (int64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// HitRate returns the percentage of lookups served from the cache
+func (c *AddressCache) HitRate() float64 {
+	hits, misses := c.Stats()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) * 100 / float64(hits+misses)
+}
+
+func (c *AddressCache) Close() error {
+	return c.db.Close()
+}
+
+// rangeAt returns the index of the range valid at height or -1
+func rangeAt(ranges []types.EquivalenceRange, height int64) int {
+	index := sort.Search(len(ranges), func(i int) bool { return ranges[i].To >= height })
+	if index < len(ranges) && ranges[index].From <= height {
+		return index
+	}
+	return -1
+}
+
+// mergeEquivalenceRange adds the addresses resolved at height, extending the ranges before and after it if they
+// have the same addresses
+func mergeEquivalenceRange(ranges []types.EquivalenceRange, height int64, addresses []string) []types.EquivalenceRange {
+	// the first range ending at or after height, it starts after height unless it contains it
+	next := sort.Search(len(ranges), func(i int) bool { return ranges[i].To >= height })
+	if next < len(ranges) && ranges[next].From <= height {
+		if !slices.Equal(ranges[next].Addresses, addresses) {
+			// the node no longer agrees with what was stored, only the new resolution is kept
+			ranges[next] = types.EquivalenceRange{From: height, To: height, Addresses: addresses}
+		}
+		return ranges
+	}
+	previous := next - 1
+	extendsPrevious := previous >= 0 && slices.Equal(ranges[previous].Addresses, addresses)
+	extendsNext := next < len(ranges) && slices.Equal(ranges[next].Addresses, addresses)
+	switch {
+	case extendsPrevious && extendsNext:
+		ranges[previous].To = ranges[next].To
+		return slices.Delete(ranges, next, next+1)
+	case extendsPrevious:
+		ranges[previous].To = height
+		return ranges
+	case extendsNext:
+		ranges[next].From = height
+		return ranges
+	}
+	return slices.Insert(ranges, next, types.EquivalenceRange{From: height, To: height, Addresses: addresses})
+}
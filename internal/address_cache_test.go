@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"testing"
+
+	address "github.com/filecoin-project/go-address"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+	"github.com/zondax/fil-trace-check/internal/types"
+)
+
+func TestMergeEquivalenceRange(t *testing.T) {
+	ranges := mergeEquivalenceRange(nil, 100, []string{"f01", "f1a"})
+	assert.Equal(t, []types.EquivalenceRange{{From: 100, To: 100, Addresses: []string{"f01", "f1a"}}}, ranges)
+
+	// same addresses later extend the range up to them
+	ranges = mergeEquivalenceRange(ranges, 200, []string{"f01", "f1a"})
+	assert.Equal(t, []types.EquivalenceRange{{From: 100, To: 200, Addresses: []string{"f01", "f1a"}}}, ranges)
+
+	// same addresses earlier extend the range down to them
+	ranges = mergeEquivalenceRange(ranges, 50, []string{"f01", "f1a"})
+	assert.Equal(t, []types.EquivalenceRange{{From: 50, To: 200, Addresses: []string{"f01", "f1a"}}}, ranges)
+
+	// different addresses later, e.g. the actor was re-created, start another range
+	ranges = mergeEquivalenceRange(ranges, 300, []string{"f02", "f1a"})
+	assert.Equal(t, []types.EquivalenceRange{
+		{From: 50, To: 200, Addresses: []string{"f01", "f1a"}},
+		{From: 300, To: 300, Addresses: []string{"f02", "f1a"}},
+	}, ranges)
+
+	// nothing is known between the ranges
+	assert.Equal(t, -1, rangeAt(ranges, 49))
+	assert.Equal(t, 0, rangeAt(ranges, 200))
+	assert.Equal(t, -1, rangeAt(ranges, 250))
+	assert.Equal(t, 1, rangeAt(ranges, 300))
+	assert.Equal(t, -1, rangeAt(ranges, 301))
+
+	// a resolution between two ranges with its addresses joins them
+	ranges = mergeEquivalenceRange([]types.EquivalenceRange{
+		{From: 100, To: 100, Addresses: []string{"f01"}},
+		{From: 200, To: 250, Addresses: []string{"f01"}},
+	}, 150, []string{"f01"})
+	assert.Equal(t, []types.EquivalenceRange{{From: 100, To: 250, Addresses: []string{"f01"}}}, ranges)
+
+	// a different resolution inside a range replaces it
+	ranges = mergeEquivalenceRange(ranges, 200, []string{"f02"})
+	assert.Equal(t, []types.EquivalenceRange{{From: 200, To: 200, Addresses: []string{"f02"}}}, ranges)
+}
+
+func TestAddressCache(t *testing.T) {
+	dbPath := t.TempDir()
+	cache, err := OpenAddressCache(dbPath)
+	require.NoError(t, err)
+
+	_, ok, err := cache.Get("f1a", 100)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set("f1a", 100, map[string]bool{"f1a": true, "f01": true}))
+	require.NoError(t, cache.Set("f1a", 200, map[string]bool{"f1a": true, "f01": true}))
+	addresses, ok, err := cache.Get("f1a", 150)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]bool{"f1a": true, "f01": true}, addresses)
+
+	// not valid after the last resolution
+	_, ok, err = cache.Get("f1a", 201)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	hits, misses := cache.Stats()
+	assert.Equal(t, int64(1), hits)
+	assert.Equal(t, int64(2), misses)
+	assert.InDelta(t, 100.0/3, cache.HitRate(), 0.001)
+
+	// ranges stored without their last height are not trusted
+	require.NoError(t, cache.db.Insert("f1b", types.AddressEquivalence{Ranges: []types.EquivalenceRange{{From: 100, Addresses: []string{"f1b", "f02"}}}}))
+	_, ok, err = cache.Get("f1b", 150)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, cache.Close())
+
+	// persisted across runs
+	cache, err = OpenAddressCache(dbPath)
+	require.NoError(t, err)
+	_, ok, err = cache.Get("f1a", 100)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, cache.Close())
+}
+
+func TestGetEquivalentAddressesAtWithCache(t *testing.T) {
+	robustAddress, err := address.NewSecp256k1Address([]byte("signer"))
+	require.NoError(t, err)
+	idAddress, err := address.NewIDAddress(1234)
+	require.NoError(t, err)
+
+	cache, err := OpenAddressCache(t.TempDir())
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, cache.Close())
+	}()
+
+	fullNodeMock := mocks.NewFullNode(t)
+	fullNodeMock.On("StateGetActor", mock.Anything, robustAddress, mock.Anything).Return(&filTypes.Actor{}, nil).Once()
+	fullNodeMock.On("StateLookupID", mock.Anything, robustAddress, mock.Anything).Return(idAddress, nil).Once()
+
+	expected := map[string]bool{robustAddress.String(): true, idAddress.String(): true}
+	addresses, err := GetEquivalentAddressesAt(t.Context(), robustAddress, testTipSet(t, 100), fullNodeMock, cache)
+	require.NoError(t, err)
+	assert.Equal(t, expected, addresses)
+
+	// served from the cache without rpc calls
+	addresses, err = GetEquivalentAddressesAt(t.Context(), robustAddress, testTipSet(t, 100), fullNodeMock, cache)
+	require.NoError(t, err)
+	assert.Equal(t, expected, addresses)
+
+	hits, misses := cache.Stats()
+	assert.Equal(t, int64(1), hits)
+	assert.Equal(t, int64(1), misses)
+}
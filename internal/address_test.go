@@ -1,12 +1,20 @@
 package internal
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	lotusAPI "github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/zondax/fil-trace-check/internal/mocks"
 )
 
 func TestReadAddressFile(t *testing.T) {
@@ -91,3 +99,89 @@ f5678
 		assert.Error(t, err)
 	})
 }
+
+func TestGetEquivalentAddressesAt(t *testing.T) {
+	robustAddress, err := address.NewSecp256k1Address([]byte("signer"))
+	require.NoError(t, err)
+	idAddress, err := address.NewIDAddress(1234)
+	require.NoError(t, err)
+	tipset := testTipSet(t, 100)
+	tsk := tipset.Key()
+
+	t.Run("resolved at tipset", func(t *testing.T) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("StateGetActor", mock.Anything, robustAddress, tsk).Return(&filTypes.Actor{}, nil)
+		fullNodeMock.On("StateLookupID", mock.Anything, robustAddress, tsk).Return(idAddress, nil)
+
+		addresses, err := GetEquivalentAddressesAt(t.Context(), robustAddress, tipset, fullNodeMock, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]bool{robustAddress.String(): true, idAddress.String(): true}, addresses)
+	})
+
+	t.Run("delegated address", func(t *testing.T) {
+		delegatedAddress, err := address.NewDelegatedAddress(10, []byte("contract"))
+		require.NoError(t, err)
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("StateLookupID", mock.Anything, delegatedAddress, tsk).Return(idAddress, nil)
+		fullNodeMock.On("StateGetActor", mock.Anything, delegatedAddress, tsk).Return(&filTypes.Actor{DelegatedAddress: &delegatedAddress}, nil)
+
+		addresses, err := GetEquivalentAddressesAt(t.Context(), delegatedAddress, tipset, fullNodeMock, nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]bool{delegatedAddress.String(): true, idAddress.String(): true}, addresses)
+	})
+
+	t.Run("not created yet at tipset", func(t *testing.T) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("StateLookupID", mock.Anything, robustAddress, tsk).Return(address.Undef, &lotusAPI.ErrActorNotFound{})
+
+		// the actor is not resolved at another tipset
+		_, err := GetEquivalentAddressesAt(t.Context(), robustAddress, tipset, fullNodeMock, nil)
+		assert.ErrorIs(t, err, ErrActorNotFound)
+	})
+
+	t.Run("id address not found", func(t *testing.T) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("StateGetActor", mock.Anything, idAddress, tsk).Return(nil, filTypes.ErrActorNotFound)
+
+		_, err := GetEquivalentAddressesAt(t.Context(), idAddress, tipset, fullNodeMock, nil)
+		assert.ErrorIs(t, err, ErrActorNotFound)
+	})
+
+	t.Run("lookup error", func(t *testing.T) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("StateLookupID", mock.Anything, robustAddress, tsk).Return(address.Undef, errors.New("connection refused"))
+
+		_, err := GetEquivalentAddressesAt(t.Context(), robustAddress, tipset, fullNodeMock, nil)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrActorNotFound)
+	})
+
+	t.Run("untyped not found message", func(t *testing.T) {
+		fullNodeMock := mocks.NewFullNode(t)
+		fullNodeMock.On("StateGetActor", mock.Anything, idAddress, tsk).Return(nil, errors.New("resolution lookup failed (f01234): actor not found"))
+
+		// the node sends missing id addresses untyped over rpc
+		_, err := GetEquivalentAddressesAt(t.Context(), idAddress, tipset, fullNodeMock, nil)
+		assert.ErrorIs(t, err, ErrActorNotFound)
+	})
+}
+
+func testTipSet(t *testing.T, height int64) *filTypes.TipSet {
+	blockCid, err := cid.Decode("bafyreicmaj5hhoy5mgqvamfhgexxyergw7hdeshizghodwkjg6qmpoco7i")
+	require.NoError(t, err)
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	tipset, err := filTypes.NewTipSet([]*filTypes.BlockHeader{
+		{
+			Miner:                 miner,
+			Height:                abi.ChainEpoch(height),
+			ParentStateRoot:       blockCid,
+			ParentMessageReceipts: blockCid,
+			Messages:              blockCid,
+			ParentWeight:          filTypes.NewInt(0),
+			ParentBaseFee:         filTypes.NewInt(0),
+		},
+	})
+	require.NoError(t, err)
+	return tipset
+}
@@ -10,6 +10,22 @@ const (
 	CheckFlag              = "check"
 	EventProviderFlag      = "event-provider"
 	EventProviderTokenFlag = "event-provider-token"
+	EventStartFlag         = "event-start"
+	EventEndFlag           = "event-end"
+	ActorEventsFlag        = "actor-events"
+	CheckpointIntervalFlag = "checkpoint-interval"
+	HeightFlag             = "height"
+	ProfileFlag            = "profile"
+	ChecksFlag             = "checks"
+	FinalityFlag           = "finality"
+	F3Flag                 = "f3"
+	BatchSizeFlag          = "batch-size"
+	PollIntervalFlag       = "poll-interval"
+	PlanFlag               = "plan"
+	ListenFlag             = "listen"
+	QueueSizeFlag          = "queue-size"
+	WorkersFlag            = "workers"
+	NoResumeFlag           = "no-resume"
 
 	ValidateJSONCheck             = "validate-json"
 	NullBlocksCheck               = "validate-null-blocks"
@@ -18,4 +34,19 @@ const (
 	AddressBalanceSequentialCheck = "validate-address-balance-sequential"
 	MultisigStateCheck            = "validate-multisig-state"
 	MultisigStateSequentialCheck  = "validate-multisig-state-sequential"
+	MarketBalanceCheck            = "validate-market-balance"
+	PowerClaimsCheck              = "validate-power-claims"
+	MinerSectorsCheck             = "validate-miner-sectors"
+	EvmAccountsCheck              = "validate-evm-accounts"
+	ActorCreationCheck            = "validate-actor-creation"
+	EventCoverageCheck            = "validate-event-coverage"
+
+	PrewarmAddressCacheCommand = "prewarm-address-cache"
+	IndexTracesCommand         = "index-traces"
+	ConfigCommand              = "config"
+	ConfigCheckCommand         = "check"
+	WatchCommand               = "watch"
+	RunCommand                 = "run"
+	ValidateTracesCommand      = "validate-traces"
+	ServeCommand               = "serve"
 )
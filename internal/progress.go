@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -12,23 +13,130 @@ const (
 	ProgressOK = "ok"
 )
 
-func UpdateProgressHeight(height int64, success bool, message string, db *api.DB) {
+// Failure categories reported in the metrics and the alerts
+const (
+	// FailureTrace is a trace that cannot be downloaded
+	FailureTrace = "trace"
+	// FailureNode is a node query that fails
+	FailureNode = "node"
+	// FailureParse is a trace, transaction or state that cannot be decoded
+	FailureParse = "parse"
+	// FailureMismatch is a trace that disagrees with the chain or the event provider
+	FailureMismatch = "mismatch"
+	// FailureOther is any other failure
+	FailureOther = "other"
+)
+
+// FailureError is an error reported with its failure category
+type FailureError struct {
+	Category string
+	Err      error
+}
+
+func (e *FailureError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+// Failure gives err its failure category, unless err already has one. It returns nil if err is nil.
+func Failure(category string, err error) error {
+	var failure *FailureError
+	if err == nil || errors.As(err, &failure) {
+		return err
+	}
+	return &FailureError{Category: category, Err: err}
+}
+
+// FailureCategoryOf returns the category of the first FailureError of err, fallback if it has none
+func FailureCategoryOf(err error, fallback string) string {
+	var failure *FailureError
+	if errors.As(err, &failure) {
+		return failure.Category
+	}
+	return fallback
+}
+
+// recordResult reports a result of check to the metrics, the result subscribers and failures to the alert sinks
+func recordResult(check, address string, height int64, success bool, category, message string) {
+	if success {
+		category = ""
+	}
+	api.PublishResult(api.ResultEvent{Check: check, Address: address, Height: height, Success: success, Message: message, Category: category})
+	api.RecordResult(check, height, success, category)
+	if !success {
+		api.RecordFailure(check, address, height, category, message)
+	}
+}
+
+// SaveProgressHeight stores a result of the check of db at height, category is the failure category of a failed
+// result
+func SaveProgressHeight(height int64, success bool, category, message string, db *api.DB) error {
+	return saveProgress(strconv.FormatInt(height, 10), "", height, success, category, message, db)
+}
+
+// SaveProgressAddress stores a result of the check of db for address at height, category is the failure category of
+// a failed result
+func SaveProgressAddress(address string, height int64, success bool, category, message string, db *api.DB) error {
+	return saveProgress(address+api.AddressHeightSeparator+strconv.FormatInt(height, 10), address, height, success, category, message, db)
+}
+
+func saveProgress(key, address string, height int64, success bool, category, message string, db *api.DB) error {
+	if err := insertProgress(key, success, message, db); err != nil {
+		return err
+	}
+	recordResult(db.Bucket(), address, height, success, category, message)
+	return nil
+}
+
+func insertProgress(key string, success bool, message string, db *api.DB) error {
 	progress := types.Progress{
 		Success: success,
 		Message: message,
 	}
-	if err := db.Insert(strconv.FormatInt(height, 10), progress); err != nil {
-		panic(fmt.Errorf("failed to update progress: %s", err))
+	if err := db.Insert(key, progress); err != nil {
+		return fmt.Errorf("failed to update progress: %s", err)
+	}
+	return nil
+}
+
+// UpdateProgressHeight stores a passed result at height, or a failed one in the other category, failures with a
+// known category use FailProgressHeight
+func UpdateProgressHeight(height int64, success bool, message string, db *api.DB) {
+	if err := SaveProgressHeight(height, success, FailureOther, message, db); err != nil {
+		panic(err)
 	}
 }
 
+// UpdateProgressAddress stores a passed result of address at height, or a failed one in the other category, failures
+// with a known category use FailProgressAddress
 func UpdateProgressAddress(address string, height int64, success bool, message string, db *api.DB) {
-	progress := types.Progress{
-		Success: success,
-		Message: message,
+	if err := SaveProgressAddress(address, height, success, FailureOther, message, db); err != nil {
+		panic(err)
+	}
+}
+
+// FailProgressHeight stores a failed result at height in category
+func FailProgressHeight(height int64, category, message string, db *api.DB) {
+	if err := SaveProgressHeight(height, false, category, message, db); err != nil {
+		panic(err)
 	}
-	if err := db.Insert(address+api.AddressHeightSeparator+strconv.FormatInt(height, 10), progress); err != nil {
-		panic(fmt.Errorf("failed to update progress: %s", err))
+}
+
+// FailProgressAddress stores a failed result of address at height in category
+func FailProgressAddress(address string, height int64, category, message string, db *api.DB) {
+	if err := SaveProgressAddress(address, height, false, category, message, db); err != nil {
+		panic(err)
+	}
+}
+
+// UpdateProgressHeightMarker stores the last height a run reached without reporting it as a result, so it is not
+// counted as a validated epoch
+func UpdateProgressHeightMarker(height int64, db *api.DB) {
+	if err := insertProgress(strconv.FormatInt(height, 10), true, ProgressOK, db); err != nil {
+		panic(err)
 	}
 }
 
@@ -2,6 +2,8 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 	"testing"
 
@@ -220,3 +222,37 @@ func TestUpdateProgressMultipleEntries(t *testing.T) {
 	assert.Equal(t, true, result["f5678_100"].Success)
 	assert.Equal(t, "processed", result["f5678_100"].Message)
 }
+
+func TestFailureCategoryOf(t *testing.T) {
+	assert.NoError(t, Failure(FailureNode, nil))
+	assert.Equal(t, FailureOther, FailureCategoryOf(errors.New("balance mismatch"), FailureOther))
+	assert.Equal(t, FailureMismatch, FailureCategoryOf(errors.New("failed to get trace"), FailureMismatch))
+
+	err := Failure(FailureNode, errors.New("failed to get tipset"))
+	assert.EqualError(t, err, "failed to get tipset")
+	assert.Equal(t, FailureNode, FailureCategoryOf(err, FailureOther))
+	assert.Equal(t, FailureNode, FailureCategoryOf(fmt.Errorf("failed to compare: %w", err), FailureMismatch))
+	// the first category is kept
+	assert.Equal(t, FailureNode, FailureCategoryOf(Failure(FailureParse, fmt.Errorf("failed to apply: %w", err)), FailureOther))
+}
+
+func TestUpdateProgressHeightMarker(t *testing.T) {
+	db, err := api.NewDB(t.TempDir(), "test-bucket")
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, db.Close())
+	}()
+	results := []api.ResultEvent{}
+	unsubscribe := api.SubscribeResults("test-bucket", func(event api.ResultEvent) { results = append(results, event) })
+	defer unsubscribe()
+
+	UpdateProgressHeightMarker(100, db)
+	latestHeight, err := db.GetLatestHeight()
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), latestHeight)
+	// a marker is not a result
+	assert.Empty(t, results)
+
+	FailProgressAddress("f01", 101, FailureMismatch, "balance mismatch", db)
+	assert.Equal(t, []api.ResultEvent{{Check: "test-bucket", Address: "f01", Height: 101, Message: "balance mismatch", Category: FailureMismatch}}, results)
+}
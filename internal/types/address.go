@@ -7,3 +7,16 @@ type AddressState struct {
 	Received *big.Int
 	Sent     *big.Int
 }
+
+type AddressEquivalence struct {
+	// Ranges are sorted by From and do not overlap, heights between two ranges are unknown
+	Ranges []EquivalenceRange `json:"Ranges"`
+}
+
+// EquivalenceRange holds the addresses resolved at From and at To, and at every height in between since an id is
+// never assigned to another actor
+type EquivalenceRange struct {
+	From      int64    `json:"From"`
+	To        int64    `json:"To"`
+	Addresses []string `json:"Addresses"`
+}
@@ -8,17 +8,44 @@ import (
 )
 
 const (
-	EventProviderBeryx = "beryx"
+	EventProviderBeryx      = "beryx"
+	EventProviderTraceIndex = "trace-index"
+	EventProviderLotus      = "lotus"
 )
 
 type EventProvider interface {
 	GetAddressEventHeights(ctx context.Context, address string) ([]int64, error)
+	Close() error
 }
 
-func NewEventProvider(eventProvider string, eventProviderToken string) (EventProvider, error) {
+type EventProviderOptions struct {
+	// Token authenticates against remote providers
+	Token string
+	// Network selects the URL of remote providers
+	Network *api.NetworkProfile
+	// IndexPath is the directory of the trace index
+	IndexPath string
+	// Resolver returns the equivalent addresses of the addresses looked up in the trace index
+	Resolver api.AddressResolver
+	// Start and End bound the returned heights, the lotus provider requires both as it walks every tipset in between
+	Start int64
+	End   int64
+	// RPCClient and ActorEvents configure the lotus provider
+	RPCClient   api.RPCClientInterface
+	ActorEvents bool
+}
+
+func NewEventProvider(eventProvider string, options EventProviderOptions) (EventProvider, error) {
 	switch eventProvider {
 	case EventProviderBeryx:
-		return api.NewBeryx(eventProviderToken), nil
+		if options.Network == nil || options.Network.BeryxURL == "" {
+			return nil, fmt.Errorf("event provider %s is not available for this network", eventProvider)
+		}
+		return api.NewBeryx(options.Token, options.Network.BeryxURL, options.Start, options.End), nil
+	case EventProviderTraceIndex:
+		return api.NewTraceIndex(options.IndexPath, options.Resolver)
+	case EventProviderLotus:
+		return api.NewLotus(options.RPCClient, options.Start, options.End, options.ActorEvents, options.Resolver)
 	default:
 		return nil, fmt.Errorf("unknown event provider: %s", eventProvider)
 	}
@@ -0,0 +1,22 @@
+package types
+
+import "math/big"
+
+type EvmAccountState struct {
+	Height     int64
+	Nonce      uint64
+	Balance    *big.Int
+	IsContract bool
+	// CodeHash is the sha256 of the deployed bytecode, set on the first check after a contract is found
+	CodeHash string
+}
+
+type EamCreateReturn struct {
+	ActorId       uint64 `json:"ActorId"`
+	RobustAddress string `json:"RobustAddress"`
+	EthAddress    string `json:"EthAddress"`
+}
+
+type EamCreateMetadata struct {
+	Return EamCreateReturn `json:"Return"`
+}
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"encoding/json"
+	"math/big"
+
+	"github.com/filecoin-project/go-bitfield"
+)
+
+type MarketState struct {
+	Height int64
+	Escrow *big.Int
+	Locked *big.Int
+}
+
+type MarketTxMetadata struct {
+	Params json.RawMessage `json:"Params"`
+	Return json.RawMessage `json:"Return"`
+}
+
+type WithdrawBalanceParams struct {
+	ProviderOrClientAddress string `json:"ProviderOrClientAddress"`
+	Amount                  string `json:"Amount"`
+}
+
+type PublishStorageDealsParams struct {
+	Deals []ClientDealProposal `json:"Deals"`
+}
+
+type PublishStorageDealsReturn struct {
+	IDs        []uint64           `json:"IDs"`
+	ValidDeals *bitfield.BitField `json:"ValidDeals"`
+}
+
+type ClientDealProposal struct {
+	Proposal DealProposal `json:"Proposal"`
+}
+
+type DealProposal struct {
+	Client               string `json:"Client"`
+	Provider             string `json:"Provider"`
+	StartEpoch           int64  `json:"StartEpoch"`
+	EndEpoch             int64  `json:"EndEpoch"`
+	StoragePricePerEpoch string `json:"StoragePricePerEpoch"`
+	ProviderCollateral   string `json:"ProviderCollateral"`
+	ClientCollateral     string `json:"ClientCollateral"`
+}
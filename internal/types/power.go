@@ -0,0 +1,18 @@
+package types
+
+import "math/big"
+
+type PowerState struct {
+	Height          int64
+	RawBytePower    *big.Int
+	QualityAdjPower *big.Int
+}
+
+type UpdateClaimedPower struct {
+	RawByteDelta         string `json:"RawByteDelta"`
+	QualityAdjustedDelta string `json:"QualityAdjustedDelta"`
+}
+
+type UpdateClaimedPowerMetadata struct {
+	Params UpdateClaimedPower `json:"Params"`
+}
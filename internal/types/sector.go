@@ -0,0 +1,23 @@
+package types
+
+const (
+	SectorPreCommitted = "precommitted"
+	SectorActive       = "active"
+	SectorFaulty       = "faulty"
+	SectorRecovering   = "recovering"
+)
+
+type SectorState struct {
+	Status     string `json:"Status"`
+	Expiration int64  `json:"Expiration"`
+}
+
+type MinerSectorsState struct {
+	Height  int64                   `json:"Height"`
+	Sectors map[uint64]*SectorState `json:"Sectors"`
+}
+
+type SectorEventData struct {
+	Expiration    int64 `json:"Expiration"`
+	NewExpiration int64 `json:"NewExpiration"`
+}
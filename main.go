@@ -12,13 +12,34 @@ func main() {
 	cli := cli.New[*api.Config](appSettings)
 	defer cli.Close()
 
+	if err := cmd.AddConfigFlags(cli.GetRoot()); err != nil {
+		panic(err)
+	}
+	cmd.RemoveCLICheckCmd(cli.GetRoot())
+	cmd.AddRunSummary()
+	cmd.AddMetrics(cli.GetRoot())
+	cmd.AddAlerts(cli.GetRoot())
+
 	cli.GetRoot().AddCommand(cmd.ValidateNullBlocksCmd())
 	cli.GetRoot().AddCommand(cmd.ValidateJSONCmd())
 	cli.GetRoot().AddCommand(cmd.ValidateCanonicalChainCmd())
+	cli.GetRoot().AddCommand(cmd.ValidateTracesCmd())
 	cli.GetRoot().AddCommand(cmd.ValidateAddressBalanceCmd())
 	cli.GetRoot().AddCommand(cmd.ValidateMultisigStateCmd())
 	cli.GetRoot().AddCommand(cmd.GenerateReportCmd())
+	cli.GetRoot().AddCommand(cmd.ConfigCmd())
 	cli.GetRoot().AddCommand(cmd.ValidateAddressBalanceSequentialCmd())
 	cli.GetRoot().AddCommand(cmd.ValidateMultisigStateSequentialCmd())
+	cli.GetRoot().AddCommand(cmd.ValidateMarketBalanceCmd())
+	cli.GetRoot().AddCommand(cmd.ValidatePowerClaimsCmd())
+	cli.GetRoot().AddCommand(cmd.ValidateMinerSectorsCmd())
+	cli.GetRoot().AddCommand(cmd.ValidateEvmAccountsCmd())
+	cli.GetRoot().AddCommand(cmd.ValidateActorCreationCmd())
+	cli.GetRoot().AddCommand(cmd.ValidateEventCoverageCmd())
+	cli.GetRoot().AddCommand(cmd.PrewarmAddressCacheCmd())
+	cli.GetRoot().AddCommand(cmd.IndexTracesCmd())
+	cli.GetRoot().AddCommand(cmd.WatchCmd())
+	cli.GetRoot().AddCommand(cmd.RunCmd())
+	cli.GetRoot().AddCommand(cmd.ServeCmd())
 	cli.Run()
 }
@@ -0,0 +1,172 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/zondax/fil-parser/actors/v2/reward"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"go.uber.org/zap"
+)
+
+const (
+	methodAwardBlockReward = abi.MethodNum(2)
+	rewardActorAddr        = "f02"
+	paramKey               = "Params"
+)
+
+// JSONCheck validates the trace can be downloaded and decoded and, when created with NewJSONCheck, that it matches
+// the schema of its parser version
+type JSONCheck struct {
+	network *api.NetworkProfile
+}
+
+// NewJSONCheck validates the traces with ValidateTraceSchema, the version of a height is the one of network
+func NewJSONCheck(network *api.NetworkProfile) JSONCheck {
+	return JSONCheck{network: network}
+}
+
+func (JSONCheck) Name() string {
+	return internal.ValidateJSONCheck
+}
+
+func (c JSONCheck) Validate(_ context.Context, epoch *TraceEpoch) error {
+	if epoch.TraceErr != nil {
+		return epoch.TraceErr
+	}
+	if c.network == nil || epoch.Data == nil {
+		return nil
+	}
+	return internal.Failure(internal.FailureParse, ValidateTraceSchema(c.network.HeightToParserVersion(epoch.Height), epoch.Data))
+}
+
+// NullBlocksCheck validates the trace is empty exactly when the epoch is a null round
+type NullBlocksCheck struct{}
+
+func (NullBlocksCheck) Name() string {
+	return internal.NullBlocksCheck
+}
+
+func (NullBlocksCheck) Validate(ctx context.Context, epoch *TraceEpoch) error {
+	if epoch.TraceErr != nil {
+		return epoch.TraceErr
+	}
+	traceIsNull := len(epoch.Trace.Trace) == 0
+
+	tipset, err := epoch.Tipset(ctx)
+	if err != nil {
+		return err
+	}
+	isNull := tipset.Height() != abi.ChainEpoch(epoch.Height)
+
+	if traceIsNull != isNull {
+		return internal.Failure(internal.FailureMismatch, fmt.Errorf("trace is null but tipset is not"))
+	}
+	return nil
+}
+
+// CanonicalChainCheck validates the miners rewarded in the trace are the miners of the blocks of the tipset
+type CanonicalChainCheck struct {
+	network      *api.NetworkProfile
+	rpcClient    api.RPCClientInterface
+	addressCache *internal.AddressCache
+	log          *zap.Logger
+	rewardActor  *reward.Reward
+}
+
+// NewCanonicalChainCheck uses rpcClient to resolve the equivalent addresses of the miners, log gets the rewards
+// that cannot be parsed
+func NewCanonicalChainCheck(network *api.NetworkProfile, rpcClient api.RPCClientInterface, log *zap.Logger) *CanonicalChainCheck {
+	if log == nil {
+		log = zap.NewNop()
+	}
+	return &CanonicalChainCheck{
+		network:     network,
+		rpcClient:   rpcClient,
+		log:         log,
+		rewardActor: &reward.Reward{},
+	}
+}
+
+// WithAddressCache stores the equivalent addresses of the miners in cache, shared with the other validations
+func (c *CanonicalChainCheck) WithAddressCache(cache *internal.AddressCache) *CanonicalChainCheck {
+	c.addressCache = cache
+	return c
+}
+
+func (c *CanonicalChainCheck) Name() string {
+	return internal.CanonicalChainCheck
+}
+
+func (c *CanonicalChainCheck) Validate(ctx context.Context, epoch *TraceEpoch) error {
+	if epoch.TraceErr != nil {
+		return epoch.TraceErr
+	}
+	height := epoch.Height
+	// get miners
+	traceMiners := map[string]bool{}
+	for _, trace := range epoch.Trace.Trace {
+		if trace.Msg.To.String() == rewardActorAddr && trace.Msg.Method == methodAwardBlockReward {
+			parsedParams, err := c.rewardActor.AwardBlockReward(c.network.ActorsNetwork, height, trace.Msg.Params)
+			if err != nil {
+				c.log.Error(fmt.Sprintf("could not parse parameters for height: %d", height), zap.Error(err))
+				continue
+			}
+			// Get the miner that received the reward
+			params, ok := parsedParams[paramKey]
+			if !ok {
+				c.log.Error(fmt.Sprintf("could not get parameter '%s' for height: %d", paramKey, height), zap.Error(err))
+				continue
+			}
+			miner := reward.GetMinerFromAwardBlockRewardParams(params)
+			if miner == "" {
+				c.log.Error(fmt.Sprintf("found empty miner for height: %d", height), zap.Error(err))
+				continue
+			}
+			traceMiners[miner] = true
+		}
+	}
+
+	onchainMiners := map[string]bool{}
+	tipset, err := epoch.Tipset(ctx)
+	if err != nil {
+		return err
+	}
+	blocks := tipset.Blocks()
+	for _, block := range blocks {
+		onchainMiners[block.Miner.String()] = true
+	}
+	// check that the length of miners are the same
+	if len(traceMiners) != len(onchainMiners) {
+		return internal.Failure(internal.FailureMismatch, fmt.Errorf("length of miners do not match"))
+	}
+
+	// check that the miners are the same ( including equivalent addresses )
+	for miner := range traceMiners {
+		// get equivalent addresses for the miner
+		minerAddr, err := address.NewFromString(miner)
+		if err != nil {
+			c.log.Error(fmt.Sprintf("could not create address for miner %s at height %d", miner, height), zap.Error(err))
+			continue
+		}
+		equivalentAddresses, err := internal.GetEquivalentAddressesAt(ctx, minerAddr, tipset, c.rpcClient.FullNodeClient(), c.addressCache)
+		if err != nil {
+			c.log.Error(fmt.Sprintf("could not get equivalent addresses for miner %s at height %d", miner, height), zap.Error(err))
+			continue
+		}
+		var found bool
+		for equivalentAddress := range equivalentAddresses {
+			if _, ok := onchainMiners[equivalentAddress]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return internal.Failure(internal.FailureMismatch, fmt.Errorf("miner %s not found", miner))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package validator
+
+import (
+	"errors"
+	"testing"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	lotusAPI "github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	parserTypes "github.com/zondax/fil-parser/types"
+	"github.com/zondax/fil-trace-check/internal/mocks"
+	rosettaFilecoinLib "github.com/zondax/rosetta-filecoin-lib"
+)
+
+type testRPCClient struct {
+	client lotusAPI.FullNode
+}
+
+func (c *testRPCClient) FullNodeClient() lotusAPI.FullNode {
+	return c.client
+}
+
+func (c *testRPCClient) RosettaLib() *rosettaFilecoinLib.RosettaConstructionFilecoin {
+	return nil
+}
+
+func (c *testRPCClient) NodeInfo() parserTypes.NodeInfo {
+	return parserTypes.NodeInfo{}
+}
+
+func testTipSet(t *testing.T, height int64) *filTypes.TipSet {
+	blockCid, err := cid.Decode("bafyreicmaj5hhoy5mgqvamfhgexxyergw7hdeshizghodwkjg6qmpoco7i")
+	require.NoError(t, err)
+	miner, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	tipset, err := filTypes.NewTipSet([]*filTypes.BlockHeader{
+		{
+			Miner:                 miner,
+			Height:                abi.ChainEpoch(height),
+			ParentStateRoot:       blockCid,
+			ParentMessageReceipts: blockCid,
+			Messages:              blockCid,
+			ParentWeight:          filTypes.NewInt(0),
+			ParentBaseFee:         filTypes.NewInt(0),
+		},
+	})
+	require.NoError(t, err)
+	return tipset
+}
+
+func TestTraceEpochTipset(t *testing.T) {
+	fullNodeMock := mocks.NewFullNode(t)
+	fullNodeMock.On("ChainGetTipSetByHeight", mock.Anything, abi.ChainEpoch(10), filTypes.EmptyTSK).Return(testTipSet(t, 10), nil).Once()
+
+	epoch := &TraceEpoch{Height: 10, rpcClient: &testRPCClient{client: fullNodeMock}}
+	for range 2 {
+		tipset, err := epoch.Tipset(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, abi.ChainEpoch(10), tipset.Height())
+	}
+
+	_, err := (&TraceEpoch{Height: 10}).Tipset(t.Context())
+	assert.Error(t, err)
+}
+
+func TestJSONCheck(t *testing.T) {
+	assert.NoError(t, JSONCheck{}.Validate(t.Context(), &TraceEpoch{Height: 1, Trace: &lotusAPI.ComputeStateOutput{}}))
+	assert.Error(t, JSONCheck{}.Validate(t.Context(), &TraceEpoch{Height: 1, TraceErr: errors.New("invalid json")}))
+}
+
+func TestNullBlocksCheck(t *testing.T) {
+	fullNodeMock := mocks.NewFullNode(t)
+	rpcClient := &testRPCClient{client: fullNodeMock}
+	// 11 is a null round, the tipset at its height is the one at 10
+	fullNodeMock.On("ChainGetTipSetByHeight", mock.Anything, abi.ChainEpoch(10), filTypes.EmptyTSK).Return(testTipSet(t, 10), nil)
+	fullNodeMock.On("ChainGetTipSetByHeight", mock.Anything, abi.ChainEpoch(11), filTypes.EmptyTSK).Return(testTipSet(t, 10), nil)
+
+	emptyTrace := &lotusAPI.ComputeStateOutput{}
+	trace := &lotusAPI.ComputeStateOutput{Trace: []*lotusAPI.InvocResult{{}}}
+	tests := []struct {
+		name    string
+		epoch   *TraceEpoch
+		wantErr bool
+	}{
+		{name: "trace at non null round", epoch: &TraceEpoch{Height: 10, Trace: trace}},
+		{name: "empty trace at null round", epoch: &TraceEpoch{Height: 11, Trace: emptyTrace}},
+		{name: "empty trace at non null round", epoch: &TraceEpoch{Height: 10, Trace: emptyTrace}, wantErr: true},
+		{name: "trace at null round", epoch: &TraceEpoch{Height: 11, Trace: trace}, wantErr: true},
+		{name: "missing trace", epoch: &TraceEpoch{Height: 10, TraceErr: errors.New("not found")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.epoch.rpcClient = rpcClient
+			err := NullBlocksCheck{}.Validate(t.Context(), tt.epoch)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
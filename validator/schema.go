@@ -0,0 +1,299 @@
+package validator
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	address "github.com/filecoin-project/go-address"
+	apitypes "github.com/filecoin-project/lotus/api"
+	lotusTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	parserV1 "github.com/zondax/fil-parser/parser/v1"
+	typesV1 "github.com/zondax/fil-parser/parser/v1/types"
+	parserV2 "github.com/zondax/fil-parser/parser/v2"
+)
+
+// maxSchemaViolations bounds the violations kept in a SchemaError, the rest are only counted
+const maxSchemaViolations = 10
+
+// traceSchemas are the types the traces of every parser version are encoded from
+var traceSchemas = map[string]reflect.Type{
+	parserV1.Version: reflect.TypeOf(typesV1.ComputeStateOutputV1{}),
+	parserV2.Version: reflect.TypeOf(apitypes.ComputeStateOutput{}),
+}
+
+// messageJSON is how lotus encodes messages, with their CID
+type messageJSON struct {
+	lotusTypes.RawMessage
+	CID cid.Cid
+}
+
+// schemaOverrides are the types whose JSON is not the one of their fields
+var schemaOverrides = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(lotusTypes.Message{}): reflect.TypeOf(messageJSON{}),
+}
+
+// schemaOptional are the fields older nodes do not encode
+var schemaOptional = map[reflect.Type][]string{
+	reflect.TypeOf(lotusTypes.MessageTrace{}): {"GasLimit", "ReadOnly"},
+}
+
+// schemaExtra are the fields newer nodes encode that their type does not have, the code CID of the invoked actor
+var schemaExtra = map[reflect.Type][]schemaField{
+	reflect.TypeOf(lotusTypes.MessageTrace{}): {{name: "CodeCid", t: reflect.TypeOf(cid.Cid{})}},
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	addressType         = reflect.TypeOf(address.Address{})
+)
+
+// Violation is a part of a trace that does not match its schema, Path is its JSON path from the root $
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return v.Path + ": " + v.Message
+}
+
+// SchemaError lists the first violations of a trace against the schema of its version
+type SchemaError struct {
+	Version    string
+	Violations []Violation
+	// Total counts every violation, including those not kept
+	Total int
+}
+
+func (e *SchemaError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		violations[i] = violation.String()
+	}
+	message := fmt.Sprintf("trace does not match the %s schema, %d violations: %s", e.Version, e.Total, strings.Join(violations, "; "))
+	if e.Total > len(e.Violations) {
+		message += "; ..."
+	}
+	return message
+}
+
+// ValidateTraceSchema checks data is a compute state output of the parser version: every field its type always
+// encodes is present, except those older nodes omit, and no other but those other nodes add, values have the type of
+// their field, CIDs, addresses, big ints and byte strings parse, and every subcall is a well-formed execution trace.
+// It returns a *SchemaError with the JSON path of each violation if data does not match.
+func ValidateTraceSchema(version string, data []byte) error {
+	schema, ok := traceSchemas[version]
+	if !ok {
+		return fmt.Errorf("unknown compute state version: %s", version)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid trace json: %w", err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid trace json: unexpected data after the trace")
+	}
+
+	validator := &schemaValidator{err: &SchemaError{Version: version}}
+	validator.value("$", value, schema)
+	if validator.err.Total > 0 {
+		return validator.err
+	}
+	return nil
+}
+
+type schemaValidator struct {
+	err *SchemaError
+}
+
+func (v *schemaValidator) violation(path, format string, args ...any) {
+	v.err.Total++
+	if len(v.err.Violations) < maxSchemaViolations {
+		v.err.Violations = append(v.err.Violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// value validates a value decoded with json numbers against t
+func (v *schemaValidator) value(path string, value any, t reflect.Type) {
+	if override, ok := schemaOverrides[t]; ok {
+		t = override
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		v.unmarshaler(path, value, t)
+		return
+	}
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		default:
+			v.violation(path, "must not be null")
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		v.value(path, value, t.Elem())
+	case reflect.Struct:
+		v.object(path, value, t)
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			v.bytes(path, value)
+			return
+		}
+		array, ok := value.([]any)
+		if !ok {
+			v.violation(path, "must be an array")
+			return
+		}
+		for i, item := range array {
+			v.value(fmt.Sprintf("%s[%d]", path, i), item, t.Elem())
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]any)
+		if !ok {
+			v.violation(path, "must be an object")
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(object)) {
+			v.value(path+"."+key, object[key], t.Elem())
+		}
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			v.violation(path, "must be a string")
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			v.violation(path, "must be a boolean")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, ok := value.(json.Number)
+		if _, err := strconv.ParseInt(string(number), 10, t.Bits()); !ok || err != nil {
+			v.violation(path, "must be an integer of %d bits", t.Bits())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number, ok := value.(json.Number)
+		if _, err := strconv.ParseUint(string(number), 10, t.Bits()); !ok || err != nil {
+			v.violation(path, "must be an unsigned integer of %d bits", t.Bits())
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(json.Number); !ok {
+			v.violation(path, "must be a number")
+		}
+	case reflect.Interface:
+	default:
+		v.violation(path, "has unsupported type %s", t)
+	}
+}
+
+// object validates the fields of a struct, those its type always encodes are required and no others are allowed.
+// Fields skipped by the parser with a "-" tag are allowed by their name without validating them.
+func (v *schemaValidator) object(path string, value any, t reflect.Type) {
+	object, ok := value.(map[string]any)
+	if !ok {
+		v.violation(path, "must be an object")
+		return
+	}
+	fields := schemaFieldsOf(t)
+	for _, field := range fields {
+		if _, ok := object[field.name]; !ok && field.required {
+			v.violation(path+"."+field.name, "required field is missing")
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		index := slices.IndexFunc(fields, func(field schemaField) bool { return field.name == key })
+		if index < 0 {
+			v.violation(path+"."+key, "unknown field")
+			continue
+		}
+		if fields[index].skipped {
+			continue
+		}
+		v.value(path+"."+key, object[key], fields[index].t)
+	}
+}
+
+// unmarshaler validates a value with the json decoding of its type, the one CIDs, addresses and big ints have
+func (v *schemaValidator) unmarshaler(path string, value any, t reflect.Type) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		v.violation(path, "cannot be encoded: %s", err)
+		return
+	}
+	decoded := reflect.New(t)
+	if err := decoded.Interface().(json.Unmarshaler).UnmarshalJSON(data); err != nil {
+		v.violation(path, "invalid %s: %s", t, err)
+		return
+	}
+	if t == addressType && decoded.Elem().Interface().(address.Address) == address.Undef {
+		v.violation(path, "address is undefined")
+	}
+}
+
+func (v *schemaValidator) bytes(path string, value any) {
+	encoded, ok := value.(string)
+	if !ok {
+		v.violation(path, "must be a base64 string")
+		return
+	}
+	if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+		v.violation(path, "invalid base64: %s", err)
+	}
+}
+
+type schemaField struct {
+	name     string
+	t        reflect.Type
+	required bool
+	skipped  bool
+}
+
+var schemaFields sync.Map
+
+// schemaFieldsOf returns the json fields of a struct type, with the fields of embedded structs and those encoded by
+// other node versions
+func schemaFieldsOf(t reflect.Type) []schemaField {
+	if fields, ok := schemaFields.Load(t); ok {
+		return fields.([]schemaField)
+	}
+	fields := []schemaField{}
+	for i := range t.NumField() {
+		structField := t.Field(i)
+		tag := structField.Tag.Get("json")
+		name, options, _ := strings.Cut(tag, ",")
+		if structField.Anonymous && name == "" && structField.Type.Kind() == reflect.Struct {
+			fields = append(fields, schemaFieldsOf(structField.Type)...)
+			continue
+		}
+		if !structField.IsExported() {
+			continue
+		}
+		if tag == "-" {
+			fields = append(fields, schemaField{name: structField.Name, skipped: true})
+			continue
+		}
+		fields = append(fields, schemaField{
+			name: cmp.Or(name, structField.Name),
+			t:    structField.Type,
+			required: !slices.Contains(strings.Split(options, ","), "omitempty") &&
+				!slices.Contains(schemaOptional[t], structField.Name),
+		})
+	}
+	fields = append(fields, schemaExtra[t]...)
+	schemaFields.Store(t, fields)
+	return fields
+}
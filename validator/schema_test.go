@@ -0,0 +1,266 @@
+package validator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	address "github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	lotusAPI "github.com/filecoin-project/lotus/api"
+	filTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	parserV1 "github.com/zondax/fil-parser/parser/v1"
+	typesV1 "github.com/zondax/fil-parser/parser/v1/types"
+	parserV2 "github.com/zondax/fil-parser/parser/v2"
+	"github.com/zondax/fil-trace-check/api"
+)
+
+func testMessage(t *testing.T) *filTypes.Message {
+	from, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	to, err := address.NewIDAddress(2)
+	require.NoError(t, err)
+	return &filTypes.Message{
+		To:         to,
+		From:       from,
+		Value:      big.NewInt(10),
+		GasFeeCap:  big.NewInt(1),
+		GasPremium: big.NewInt(1),
+		GasLimit:   1000,
+		Method:     abi.MethodNum(2),
+		Params:     []byte{1, 2},
+	}
+}
+
+func testTraceV2(t *testing.T) []byte {
+	root, err := cid.Decode("bafyreicmaj5hhoy5mgqvamfhgexxyergw7hdeshizghodwkjg6qmpoco7i")
+	require.NoError(t, err)
+	message := testMessage(t)
+	messageTrace := filTypes.MessageTrace{From: message.From, To: message.To, Value: message.Value, Method: message.Method, Params: message.Params}
+	trace := lotusAPI.ComputeStateOutput{
+		Root: root,
+		Trace: []*lotusAPI.InvocResult{{
+			MsgCid: message.Cid(),
+			Msg:    message,
+			MsgRct: &filTypes.MessageReceipt{GasUsed: 10},
+			GasCost: lotusAPI.MsgGasCost{
+				Message: message.Cid(), GasUsed: big.Zero(), BaseFeeBurn: big.Zero(), OverEstimationBurn: big.Zero(),
+				MinerPenalty: big.Zero(), MinerTip: big.Zero(), Refund: big.Zero(), TotalCost: big.Zero(),
+			},
+			ExecutionTrace: filTypes.ExecutionTrace{
+				Msg:          messageTrace,
+				InvokedActor: &filTypes.ActorTrace{Id: 2, State: filTypes.Actor{Code: root, Head: root, Balance: big.Zero()}},
+				GasCharges:   []*filTypes.GasTrace{{Name: "OnChainMessage", TotalGas: 10, TimeTaken: time.Millisecond}},
+				Subcalls: []filTypes.ExecutionTrace{
+					{Msg: messageTrace, Subcalls: []filTypes.ExecutionTrace{{Msg: messageTrace}}},
+				},
+				IpldOps: []filTypes.TraceIpld{{Op: filTypes.IpldOpGet, Cid: root, Size: 10}},
+			},
+			Duration: time.Second,
+		}},
+	}
+	data, err := json.Marshal(trace)
+	require.NoError(t, err)
+	return data
+}
+
+func testTraceV1(t *testing.T) []byte {
+	message := testMessage(t)
+	trace := typesV1.ComputeStateOutputV1{
+		Trace: []*typesV1.InvocResultV1{{
+			MsgCid: message.Cid(),
+			Msg:    message,
+			MsgRct: &filTypes.MessageReceipt{},
+			GasCost: lotusAPI.MsgGasCost{
+				GasUsed: big.Zero(), BaseFeeBurn: big.Zero(), OverEstimationBurn: big.Zero(),
+				MinerPenalty: big.Zero(), MinerTip: big.Zero(), Refund: big.Zero(), TotalCost: big.Zero(),
+			},
+			ExecutionTrace: typesV1.ExecutionTraceV1{
+				Msg:      message,
+				MsgRct:   &filTypes.MessageReceipt{},
+				Subcalls: []typesV1.ExecutionTraceV1{{Msg: message, MsgRct: &filTypes.MessageReceipt{}}},
+			},
+		}},
+	}
+	data, err := json.Marshal(trace)
+	require.NoError(t, err)
+	// the traces keep the gas charges the parser skips
+	decoded := map[string]any{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	executionTrace := decoded["Trace"].([]any)[0].(map[string]any)["ExecutionTrace"].(map[string]any)
+	executionTrace["GasCharges"] = []any{map[string]any{"Name": "OnChainMessage", "loc": nil, "tg": 10, "vtg": 0}}
+	data, err = json.Marshal(decoded)
+	require.NoError(t, err)
+	return data
+}
+
+// editTrace returns data with edit applied to its first invocation
+func editTrace(t *testing.T, data []byte, edit func(invocation map[string]any)) []byte {
+	decoded := map[string]any{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	edit(decoded["Trace"].([]any)[0].(map[string]any))
+	data, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	return data
+}
+
+func schemaViolations(t *testing.T, version string, data []byte) []Violation {
+	err := ValidateTraceSchema(version, data)
+	if err == nil {
+		return nil
+	}
+	var schemaErr *SchemaError
+	require.True(t, errors.As(err, &schemaErr), err.Error())
+	return schemaErr.Violations
+}
+
+func TestValidateTraceSchema(t *testing.T) {
+	assert.NoError(t, ValidateTraceSchema(parserV2.Version, testTraceV2(t)))
+	assert.NoError(t, ValidateTraceSchema(parserV1.Version, testTraceV1(t)))
+	assert.NoError(t, ValidateTraceSchema(parserV2.Version, []byte(`{"Root":null,"Trace":[]}`)))
+
+	// a v1 trace is not a v2 one
+	violations := schemaViolations(t, parserV2.Version, testTraceV1(t))
+	assert.Contains(t, violations, Violation{Path: "$.Trace[0].ExecutionTrace.Duration", Message: "unknown field"})
+	assert.Contains(t, violations, Violation{Path: "$.Trace[0].ExecutionTrace.Msg.ParamsCodec", Message: "required field is missing"})
+
+	for name, test := range map[string]struct {
+		edit      func(invocation map[string]any)
+		violation Violation
+	}{
+		"unknown field": {
+			edit:      func(invocation map[string]any) { invocation["Extra"] = 1 },
+			violation: Violation{Path: "$.Trace[0].Extra", Message: "unknown field"},
+		},
+		"missing field": {
+			edit:      func(invocation map[string]any) { delete(invocation, "GasCost") },
+			violation: Violation{Path: "$.Trace[0].GasCost", Message: "required field is missing"},
+		},
+		"invalid cid": {
+			edit:      func(invocation map[string]any) { invocation["MsgCid"] = map[string]any{"/": "bafy"} },
+			violation: Violation{Path: "$.Trace[0].MsgCid"},
+		},
+		"invalid address": {
+			edit:      func(invocation map[string]any) { invocation["Msg"].(map[string]any)["To"] = "x01" },
+			violation: Violation{Path: "$.Trace[0].Msg.To"},
+		},
+		"undefined address": {
+			edit:      func(invocation map[string]any) { invocation["Msg"].(map[string]any)["From"] = nil },
+			violation: Violation{Path: "$.Trace[0].Msg.From", Message: "address is undefined"},
+		},
+		"invalid big int": {
+			edit:      func(invocation map[string]any) { invocation["GasCost"].(map[string]any)["Refund"] = "1.5" },
+			violation: Violation{Path: "$.Trace[0].GasCost.Refund"},
+		},
+		"number big int": {
+			edit:      func(invocation map[string]any) { invocation["GasCost"].(map[string]any)["Refund"] = 1 },
+			violation: Violation{Path: "$.Trace[0].GasCost.Refund"},
+		},
+		"invalid bytes": {
+			edit:      func(invocation map[string]any) { invocation["Msg"].(map[string]any)["Params"] = "not base64!" },
+			violation: Violation{Path: "$.Trace[0].Msg.Params"},
+		},
+		"null struct": {
+			edit:      func(invocation map[string]any) { invocation["ExecutionTrace"] = nil },
+			violation: Violation{Path: "$.Trace[0].ExecutionTrace", Message: "must not be null"},
+		},
+		"negative unsigned": {
+			edit:      func(invocation map[string]any) { invocation["Msg"].(map[string]any)["Method"] = -1 },
+			violation: Violation{Path: "$.Trace[0].Msg.Method", Message: "must be an unsigned integer of 64 bits"},
+		},
+		"subcalls not an array": {
+			edit: func(invocation map[string]any) {
+				invocation["ExecutionTrace"].(map[string]any)["Subcalls"] = map[string]any{}
+			},
+			violation: Violation{Path: "$.Trace[0].ExecutionTrace.Subcalls", Message: "must be an array"},
+		},
+		"nested subcall without receipt": {
+			edit: func(invocation map[string]any) {
+				subcall := invocation["ExecutionTrace"].(map[string]any)["Subcalls"].([]any)[0].(map[string]any)
+				delete(subcall["Subcalls"].([]any)[0].(map[string]any), "MsgRct")
+			},
+			violation: Violation{Path: "$.Trace[0].ExecutionTrace.Subcalls[0].Subcalls[0].MsgRct", Message: "required field is missing"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			violations := schemaViolations(t, parserV2.Version, editTrace(t, testTraceV2(t), test.edit))
+			require.Len(t, violations, 1)
+			assert.Equal(t, test.violation.Path, violations[0].Path)
+			if test.violation.Message != "" {
+				assert.Equal(t, test.violation.Message, violations[0].Message)
+			}
+		})
+	}
+
+	// only the first violations are kept
+	data := editTrace(t, testTraceV2(t), func(invocation map[string]any) {
+		for i := range 15 {
+			invocation[string(rune('a'+i))] = i
+		}
+	})
+	err := ValidateTraceSchema(parserV2.Version, data)
+	var schemaErr *SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+	assert.Equal(t, 15, schemaErr.Total)
+	assert.Len(t, schemaErr.Violations, maxSchemaViolations)
+	assert.Contains(t, err.Error(), "trace does not match the v2 schema, 15 violations: $.Trace[0].a: unknown field;")
+
+	assert.Error(t, ValidateTraceSchema(parserV2.Version, []byte(`{"Root":null,"Trace":[]} {}`)))
+	assert.Error(t, ValidateTraceSchema("v3", testTraceV2(t)))
+}
+
+// TestValidateTraceSchemaNodeTraces validates the first invocations of real mainnet traces with the version the
+// mainnet profile gives their height
+func TestValidateTraceSchemaNodeTraces(t *testing.T) {
+	network, err := api.GetNetworkProfile(api.MainnetNetwork)
+	require.NoError(t, err)
+	check := NewJSONCheck(network)
+	for name, test := range map[string]struct {
+		height  int64
+		version string
+	}{
+		"last v1":                 {height: 2907480, version: parserV1.Version},
+		"v2 without message gas":  {height: 2907520, version: parserV2.Version},
+		"v2 with message code id": {height: 3450305, version: parserV2.Version},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", fmt.Sprintf("traces_%d.json", test.height)))
+			require.NoError(t, err)
+			require.Equal(t, test.version, network.HeightToParserVersion(test.height))
+			assert.NoError(t, check.Validate(t.Context(), &TraceEpoch{Height: test.height, Data: data}))
+
+			// the trace of the other version is rejected
+			other := parserV1.Version
+			if test.version == parserV1.Version {
+				other = parserV2.Version
+			}
+			assert.NotEmpty(t, schemaViolations(t, other, data))
+		})
+	}
+
+	// the fields other nodes encode are still validated
+	data, err := os.ReadFile(filepath.Join("testdata", "traces_3450305.json"))
+	require.NoError(t, err)
+	data = editTrace(t, data, func(invocation map[string]any) {
+		invocation["ExecutionTrace"].(map[string]any)["Msg"].(map[string]any)["CodeCid"] = map[string]any{"/": "bafy"}
+	})
+	violations := schemaViolations(t, parserV2.Version, data)
+	require.Len(t, violations, 1)
+	assert.Equal(t, "$.Trace[0].ExecutionTrace.Msg.CodeCid", violations[0].Path)
+}
+
+func TestJSONCheckSchema(t *testing.T) {
+	network := &api.NetworkProfile{ParserV1MaxHeight: 100}
+	check := NewJSONCheck(network)
+	assert.NoError(t, check.Validate(t.Context(), &TraceEpoch{Height: 100, Trace: &lotusAPI.ComputeStateOutput{}, Data: testTraceV1(t)}))
+	assert.NoError(t, check.Validate(t.Context(), &TraceEpoch{Height: 101, Trace: &lotusAPI.ComputeStateOutput{}, Data: testTraceV2(t)}))
+	assert.ErrorContains(t, check.Validate(t.Context(), &TraceEpoch{Height: 101, Trace: &lotusAPI.ComputeStateOutput{}, Data: testTraceV1(t)}), "unknown field")
+}
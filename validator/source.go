@@ -0,0 +1,28 @@
+package validator
+
+import (
+	"context"
+
+	"github.com/Zondax/zindexer/components/connections/data_store"
+	"github.com/zondax/fil-trace-check/api"
+)
+
+// DataStoreTraceSource reads the traces from the data store of a config
+type DataStoreTraceSource struct {
+	client *data_store.DataStoreClient
+	config *api.Config
+}
+
+// NewDataStoreTraceSource connects to the trace source of config
+func NewDataStoreTraceSource(config *api.Config) (*DataStoreTraceSource, error) {
+	client, err := api.GetDataStoreClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &DataStoreTraceSource{client: client, config: config}, nil
+}
+
+// GetTrace downloads the trace of height, the data store cannot be canceled so ctx is not used
+func (s *DataStoreTraceSource) GetTrace(_ context.Context, height int64) ([]byte, error) {
+	return api.GetTraceFromDataStore(height, s.client, s.config)
+}
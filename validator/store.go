@@ -0,0 +1,71 @@
+package validator
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+)
+
+// DBProgressStore stores the results of every check in its own database in a directory, the same databases the
+// commands use, so generate-report and later commands see them
+type DBProgressStore struct {
+	path string
+	mu   sync.Mutex
+	dbs  map[string]*api.DB
+}
+
+func NewDBProgressStore(path string) *DBProgressStore {
+	return &DBProgressStore{path: path, dbs: map[string]*api.DB{}}
+}
+
+// db opens the database of check on first use
+func (s *DBProgressStore) db(check string) (*api.DB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if db, ok := s.dbs[check]; ok {
+		return db, nil
+	}
+	db, err := api.NewDB(s.path, check)
+	if err != nil {
+		return nil, err
+	}
+	s.dbs[check] = db
+	return db, nil
+}
+
+func (s *DBProgressStore) LatestHeight(check string) (int64, error) {
+	db, err := s.db(check)
+	if err != nil {
+		return 0, err
+	}
+	return db.GetLatestHeight()
+}
+
+func (s *DBProgressStore) Record(result Result) error {
+	db, err := s.db(result.Check)
+	if err != nil {
+		return err
+	}
+	message := result.Message
+	if result.Success {
+		message = internal.ProgressOK
+	}
+	if result.Address != "" {
+		return internal.SaveProgressAddress(result.Address, result.Height, result.Success, result.Category, message, db)
+	}
+	return internal.SaveProgressHeight(result.Height, result.Success, result.Category, message, db)
+}
+
+// Close closes the databases opened by the store
+func (s *DBProgressStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := []error{}
+	for check, db := range s.dbs {
+		errs = append(errs, db.Close())
+		delete(s.dbs, check)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,219 @@
+// Package validator runs the trace validations from Go code: the JSON, null blocks and canonical chain checks. The
+// TraceValidator is created with its node client, trace source and progress store, and returns typed results
+// instead of only recording them. The address and sequential validations are not part of it and only run as
+// commands.
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bytedance/sonic"
+	apitypes "github.com/filecoin-project/lotus/api"
+	lotusTypes "github.com/filecoin-project/lotus/chain/types"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"go.uber.org/zap"
+)
+
+// Check validates the trace of one epoch
+type Check interface {
+	// Name is the check name, its results are stored under it
+	Name() string
+	// Validate returns why epoch is not valid, nil if it is
+	Validate(ctx context.Context, epoch *TraceEpoch) error
+}
+
+// TraceSource returns the decompressed trace of a height, the JSON of a lotus ComputeStateOutput
+type TraceSource interface {
+	GetTrace(ctx context.Context, height int64) ([]byte, error)
+}
+
+// ProgressStore keeps the results of the checks, so validations resume after the last validated height
+type ProgressStore interface {
+	// LatestHeight returns the last height with a result of check, 0 if there are none
+	LatestHeight(check string) (int64, error)
+	Record(result Result) error
+}
+
+// Result is the outcome of a check at a height, for an address if the check validates addresses
+type Result struct {
+	Check   string `json:"check"`
+	Height  int64  `json:"height"`
+	Address string `json:"address,omitempty"`
+	Success bool   `json:"success"`
+	// Message is why the check failed
+	Message string `json:"message,omitempty"`
+	// Category is the failure category of a failed result: trace, node, parse, mismatch or other
+	Category string `json:"category,omitempty"`
+}
+
+// Report sums the results of a validation by check
+type Report struct {
+	Checks map[string]*CheckReport `json:"checks"`
+}
+
+type CheckReport struct {
+	// Start is the first height validated, after the results already in the store
+	Start    int64    `json:"start"`
+	Passed   int      `json:"passed"`
+	Failed   int      `json:"failed"`
+	Failures []Result `json:"failures,omitempty"`
+}
+
+// TraceEpoch is the decoded trace of a height, the tipset is fetched from the node on first use
+type TraceEpoch struct {
+	Height int64
+	Trace  *apitypes.ComputeStateOutput
+	// Data is the JSON the trace was decoded from, nil when it could not be downloaded or the epoch was created
+	// without it
+	Data []byte
+	// TraceErr is why the trace could not be downloaded or decoded, Trace is nil when set
+	TraceErr error
+
+	rpcClient    api.RPCClientInterface
+	tipset       *lotusTypes.TipSet
+	tipsetErr    error
+	tipsetLoaded bool
+}
+
+// NewTraceEpoch returns the epoch at height with its decoded trace or the error getting it. rpcClient is used to
+// get the tipset, it can be nil for checks that do not need it.
+func NewTraceEpoch(height int64, trace *apitypes.ComputeStateOutput, traceErr error, rpcClient api.RPCClientInterface) *TraceEpoch {
+	return &TraceEpoch{Height: height, Trace: trace, TraceErr: traceErr, rpcClient: rpcClient}
+}
+
+// Tipset returns the tipset at the height of the epoch, the last non-null one before it for null rounds
+func (e *TraceEpoch) Tipset(ctx context.Context) (*lotusTypes.TipSet, error) {
+	if !e.tipsetLoaded {
+		if e.rpcClient == nil {
+			return nil, internal.Failure(internal.FailureNode, fmt.Errorf("no node client to get the tipset at %d", e.Height))
+		}
+		tipset, err := api.ChainGetTipSetByHeight(ctx, e.Height, e.rpcClient)
+		e.tipset, e.tipsetErr = tipset, internal.Failure(internal.FailureNode, err)
+		e.tipsetLoaded = true
+	}
+	return e.tipset, e.tipsetErr
+}
+
+// TraceValidatorConfig are the dependencies of a TraceValidator
+type TraceValidatorConfig struct {
+	// RPCClient is used by the checks that query the node, it can be nil when none of them does
+	RPCClient api.RPCClientInterface
+	Traces    TraceSource
+	// Store records the results and makes every check resume after its latest height, nil only returns them
+	Store ProgressStore
+	// Log defaults to no logging
+	Log *zap.Logger
+}
+
+// TraceOptions select the range and the checks of a validation
+type TraceOptions struct {
+	Start  int64
+	End    int64
+	Checks []Check
+	// NoResume validates the whole range even if the store has results after Start
+	NoResume bool
+	// OnResult is called with every result as it is recorded
+	OnResult func(Result)
+}
+
+// TraceValidator runs checks in one pass over a range, every trace is downloaded and decoded once per epoch
+type TraceValidator struct {
+	config TraceValidatorConfig
+}
+
+func NewTraceValidator(config TraceValidatorConfig) (*TraceValidator, error) {
+	if config.Traces == nil {
+		return nil, errors.New("trace source is required")
+	}
+	if config.Log == nil {
+		config.Log = zap.NewNop()
+	}
+	return &TraceValidator{config: config}, nil
+}
+
+// Validate runs the checks of options on every height of its range. It stops early only when ctx is done or a
+// result cannot be stored, failed checks are reported in the results.
+func (v *TraceValidator) Validate(ctx context.Context, options TraceOptions) (*Report, error) {
+	if len(options.Checks) == 0 {
+		return nil, errors.New("at least one check is required")
+	}
+	if options.End < options.Start {
+		return nil, fmt.Errorf("end %d is before start %d", options.End, options.Start)
+	}
+	log := v.config.Log
+
+	report := &Report{Checks: map[string]*CheckReport{}}
+	passStart := options.End + 1
+	for _, check := range options.Checks {
+		if _, ok := report.Checks[check.Name()]; ok {
+			return nil, fmt.Errorf("check %s is selected more than once", check.Name())
+		}
+		checkReport := &CheckReport{Start: options.Start}
+		report.Checks[check.Name()] = checkReport
+		if v.config.Store != nil && !options.NoResume {
+			latestHeight, err := v.config.Store.LatestHeight(check.Name())
+			if err != nil {
+				return nil, fmt.Errorf("could not get latest height of %s: %w", check.Name(), err)
+			}
+			if latestHeight > 0 && latestHeight > options.Start {
+				log.Info("resuming from latest height", zap.Int64("latest-height", latestHeight), zap.String("check", check.Name()))
+				checkReport.Start = latestHeight
+			}
+		}
+		passStart = min(passStart, checkReport.Start)
+	}
+
+	for i := passStart; i <= options.End; i++ {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		log.Debug(fmt.Sprintf("Validating traces for height %d", i))
+		epoch := v.epoch(ctx, i)
+
+		for _, check := range options.Checks {
+			checkReport := report.Checks[check.Name()]
+			if i < checkReport.Start {
+				continue
+			}
+			result := Result{Check: check.Name(), Height: i, Success: true}
+			if err := check.Validate(ctx, epoch); err != nil {
+				log.Debug("validation failed", zap.Error(err), zap.String("check", check.Name()), zap.Int64("height", i))
+				result.Success = false
+				result.Message = err.Error()
+				result.Category = internal.FailureCategoryOf(err, internal.FailureOther)
+				checkReport.Failed++
+				checkReport.Failures = append(checkReport.Failures, result)
+			} else {
+				checkReport.Passed++
+			}
+			if v.config.Store != nil {
+				if err := v.config.Store.Record(result); err != nil {
+					return report, err
+				}
+			}
+			if options.OnResult != nil {
+				options.OnResult(result)
+			}
+		}
+	}
+	return report, nil
+}
+
+func (v *TraceValidator) epoch(ctx context.Context, height int64) *TraceEpoch {
+	data, err := v.config.Traces.GetTrace(ctx, height)
+	if err != nil {
+		v.config.Log.Error("failed to get trace", zap.Error(err), zap.Int64("height", height))
+		return NewTraceEpoch(height, nil, internal.Failure(internal.FailureTrace, err), v.config.RPCClient)
+	}
+	var computeState apitypes.ComputeStateOutput
+	if err := sonic.Unmarshal(data, &computeState); err != nil {
+		v.config.Log.Error("failed to unmarshal trace", zap.Error(err), zap.Int64("height", height))
+		return NewTraceEpoch(height, nil, internal.Failure(internal.FailureParse, err), v.config.RPCClient)
+	}
+	epoch := NewTraceEpoch(height, &computeState, nil, v.config.RPCClient)
+	epoch.Data = data
+	return epoch
+}
@@ -0,0 +1,132 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zondax/fil-trace-check/api"
+	"github.com/zondax/fil-trace-check/internal"
+	"github.com/zondax/fil-trace-check/internal/types"
+)
+
+// testTraceSource returns an empty trace at every height but the missing ones and counts the downloads
+type testTraceSource struct {
+	missing   map[int64]bool
+	downloads map[int64]int
+}
+
+func (s *testTraceSource) GetTrace(_ context.Context, height int64) ([]byte, error) {
+	s.downloads[height]++
+	if s.missing[height] {
+		return nil, fmt.Errorf("trace %d not found", height)
+	}
+	return []byte(`{"Root":null,"Trace":[]}`), nil
+}
+
+// failingCheck fails at the heights in fail
+type failingCheck struct {
+	name string
+	fail map[int64]bool
+}
+
+func (c failingCheck) Name() string {
+	return c.name
+}
+
+func (c failingCheck) Validate(_ context.Context, epoch *TraceEpoch) error {
+	if c.fail[epoch.Height] {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func TestTraceValidator(t *testing.T) {
+	dbPath := t.TempDir()
+	store := NewDBProgressStore(dbPath)
+	// the other check already validated up to 12
+	require.NoError(t, store.Record(Result{Check: "other", Height: 12, Success: true}))
+
+	traces := &testTraceSource{missing: map[int64]bool{11: true}, downloads: map[int64]int{}}
+	traceValidator, err := NewTraceValidator(TraceValidatorConfig{Traces: traces, Store: store})
+	require.NoError(t, err)
+
+	var results []Result
+	report, err := traceValidator.Validate(t.Context(), TraceOptions{
+		Start:    10,
+		End:      14,
+		Checks:   []Check{JSONCheck{}, failingCheck{name: "other", fail: map[int64]bool{13: true}}},
+		OnResult: func(result Result) { results = append(results, result) },
+	})
+	require.NoError(t, err)
+	// every trace is downloaded once for both checks
+	assert.Equal(t, map[int64]int{10: 1, 11: 1, 12: 1, 13: 1, 14: 1}, traces.downloads)
+	assert.Len(t, results, 8)
+
+	assert.Equal(t, &CheckReport{
+		Start:    10,
+		Passed:   4,
+		Failed:   1,
+		Failures: []Result{{Check: internal.ValidateJSONCheck, Height: 11, Message: "trace 11 not found", Category: internal.FailureTrace}},
+	}, report.Checks[internal.ValidateJSONCheck])
+	assert.Equal(t, &CheckReport{
+		Start:    12,
+		Passed:   2,
+		Failed:   1,
+		Failures: []Result{{Check: "other", Height: 13, Message: "failed", Category: internal.FailureOther}},
+	}, report.Checks["other"])
+	require.NoError(t, store.Close())
+
+	// results are stored in the database of each check
+	db, err := api.NewDB(dbPath, internal.ValidateJSONCheck)
+	require.NoError(t, err)
+	defer db.Close()
+	var progress types.Progress
+	require.NoError(t, db.Get("11", &progress))
+	assert.Equal(t, types.Progress{Success: false, Message: "trace 11 not found"}, progress)
+	require.NoError(t, db.Get("10", &progress))
+	assert.Equal(t, types.Progress{Success: true, Message: internal.ProgressOK}, progress)
+}
+
+func TestTraceValidatorNoResume(t *testing.T) {
+	store := NewDBProgressStore(t.TempDir())
+	defer store.Close()
+	require.NoError(t, store.Record(Result{Check: "other", Height: 20, Success: true}))
+
+	traces := &testTraceSource{downloads: map[int64]int{}}
+	traceValidator, err := NewTraceValidator(TraceValidatorConfig{Traces: traces, Store: store})
+	require.NoError(t, err)
+
+	// a range before the stored results is validated once they are ignored
+	options := TraceOptions{Start: 10, End: 12, Checks: []Check{failingCheck{name: "other"}}}
+	report, err := traceValidator.Validate(t.Context(), options)
+	require.NoError(t, err)
+	assert.Equal(t, &CheckReport{Start: 20}, report.Checks["other"])
+
+	options.NoResume = true
+	report, err = traceValidator.Validate(t.Context(), options)
+	require.NoError(t, err)
+	assert.Equal(t, &CheckReport{Start: 10, Passed: 3}, report.Checks["other"])
+}
+
+func TestTraceValidatorErrors(t *testing.T) {
+	_, err := NewTraceValidator(TraceValidatorConfig{})
+	assert.Error(t, err)
+
+	traceValidator, err := NewTraceValidator(TraceValidatorConfig{Traces: &testTraceSource{downloads: map[int64]int{}}})
+	require.NoError(t, err)
+	_, err = traceValidator.Validate(t.Context(), TraceOptions{Start: 1, End: 2})
+	assert.Error(t, err)
+	_, err = traceValidator.Validate(t.Context(), TraceOptions{Start: 2, End: 1, Checks: []Check{JSONCheck{}}})
+	assert.Error(t, err)
+	_, err = traceValidator.Validate(t.Context(), TraceOptions{Start: 1, End: 2, Checks: []Check{JSONCheck{}, JSONCheck{}}})
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err = traceValidator.Validate(ctx, TraceOptions{Start: 1, End: 2, Checks: []Check{JSONCheck{}}})
+	assert.ErrorIs(t, err, context.Canceled)
+}